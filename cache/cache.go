@@ -0,0 +1,138 @@
+// Package cache stores rendered notebooks, so that converting the same notebook again only copies the output.
+//
+// Converter wraps an nb.Notebook and keys its output on the hash of the notebook's contents and of
+// the converter's configuration. The output is kept in a Store: in memory with NewMemory, or in files
+// shared between processes with NewDir.
+//
+//	c := cache.New(nb.New(nb.WithExtensions(ext)), cache.NewMemory(64<<20))
+//	err := c.Convert(w, source)
+//
+// With WithCells, the cells of a notebook are cached too, so that a notebook with one changed cell
+// only renders that cell.
+//
+// The configuration is identified by the version of this module, the renderer and the extensions.
+// Renderers and extensions which implement Keyer describe their options, as the renderers in this module do;
+// the others are identified by their type alone. Describe the options of those with WithKey,
+// if converters with different options share a Store.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/render"
+)
+
+// Keyer is implemented by renderers and extensions whose output depends on their options.
+type Keyer = render.Keyer
+
+// Option configures a Converter.
+type Option func(*Converter)
+
+// WithKey adds parts which describe the configuration of the converter to the cache keys,
+// e.g. the options passed to the renderer.
+func WithKey(parts ...string) Option {
+	return func(c *Converter) {
+		c.parts = append(c.parts, parts...)
+	}
+}
+
+// WithCells caches the rendered cells in the store. Cells are only rendered if they are not in the store,
+// which speeds up rendering notebooks which have changed since they were last converted.
+//
+// The cell cache is added to the renderer of the nb.Notebook, which must not have rendered any notebooks yet.
+// Cells are cached with their index, as the ids of the cells rendered by the HTML renderer depend on it.
+// Only use it if the output of every cell depends on the cell alone, which is not the case for extensions
+// that render a table of contents, for example.
+func WithCells(store Store) Option {
+	return func(c *Converter) {
+		c.cells = store
+	}
+}
+
+// Converter converts notebooks with an nb.Notebook, storing the output.
+// It is safe for concurrent use if the nb.Notebook is.
+type Converter struct {
+	n     *nb.Notebook
+	store Store
+	cells Store
+	parts []string
+	key   []byte
+}
+
+var _ nb.Converter = (*Converter)(nil)
+
+// New creates a Converter which caches the output of n in the store.
+func New(n *nb.Notebook, store Store, opts ...Option) *Converter {
+	c := Converter{n: n, store: store}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.key = configKey(c.n, c.parts)
+	if c.cells != nil {
+		n.Renderer().AddOptions(render.WithCellCache(&cellCache{store: c.cells, config: c.key}))
+	}
+	return &c
+}
+
+// ConfigKey returns the hash of the configuration of n and the parts, as it is described in the cache keys.
+// Packages which store the output of n under keys of their own should include it in them.
+func ConfigKey(n *nb.Notebook, parts ...string) string {
+	return hex.EncodeToString(configKey(n, parts))
+}
+
+// configKey hashes the description of the converter's configuration.
+func configKey(n *nb.Notebook, parts []string) []byte {
+	h := sha256.New()
+	field(h, []byte(nb.Version()))
+	field(h, []byte(fmt.Sprintf("%T", n.Renderer())))
+	if k, ok := n.Renderer().(Keyer); ok {
+		field(h, []byte(k.CacheKey()))
+	}
+	for _, ext := range n.Extensions() {
+		field(h, []byte(fmt.Sprintf("%T", ext)))
+		if k, ok := ext.(Keyer); ok {
+			field(h, []byte(k.CacheKey()))
+		}
+	}
+	for _, p := range parts {
+		field(h, []byte(p))
+	}
+	return h.Sum(nil)
+}
+
+// Key returns the key under which the output for the source is stored.
+func (c *Converter) Key(source []byte) string {
+	h := sha256.New()
+	field(h, c.key)
+	field(h, source)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Convert writes the stored output for the source, or converts it and stores the output.
+func (c *Converter) Convert(w io.Writer, source []byte) error {
+	return c.ConvertContext(context.Background(), w, source)
+}
+
+// ConvertContext is like Convert, but stops once ctx is done. See nb.Notebook.ConvertContext.
+// Output is not stored if converting the notebook fails, and errors from the store are ignored.
+func (c *Converter) ConvertContext(ctx context.Context, w io.Writer, source []byte) error {
+	key := c.Key(source)
+	if b, ok := c.store.Get(key); ok {
+		_, err := w.Write(b)
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := c.n.ConvertContext(ctx, &buf, source); err != nil {
+		return err
+	}
+	_ = c.store.Put(key, buf.Bytes())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,171 @@
+package cache_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/cache"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+// notebook returns a v4.5 notebook with a markdown cell for each of the sources.
+func notebook(sources ...string) []byte {
+	var cells []string
+	for i, src := range sources {
+		cells = append(cells, `{"id": "`+string(rune('a'+i))+`", "cell_type": "markdown", "metadata": {}, "source": "`+src+`"}`)
+	}
+	return []byte(`{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [` + strings.Join(cells, ",") + `]}`)
+}
+
+// counter renders markdown cells as their text and counts how many it has rendered.
+type counter struct {
+	n int
+}
+
+func (c *counter) RegisterFuncs(reg render.RenderCellFuncRegistry) {
+	reg.Register(render.Pref{Type: schema.Markdown, MimeType: common.MarkdownText}, func(w io.Writer, cell schema.Cell) error {
+		c.n++
+		if string(cell.Text()) == "fail" {
+			return errors.New("render failed")
+		}
+		_, err := w.Write(cell.Text())
+		return err
+	})
+}
+
+func convert(t *testing.T, c nb.Converter, source []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, c.Convert(&buf, source))
+	return buf.String()
+}
+
+func TestConverter(t *testing.T) {
+	var cnt counter
+	store := cache.NewMemory(1 << 20)
+	c := cache.New(nb.New(nb.WithRenderOptions(render.WithCellRenderers(&cnt))), store)
+	source := notebook("one", "two")
+
+	first := convert(t, c, source)
+	require.Contains(t, first, "one")
+	require.Equal(t, first, convert(t, c, source))
+	require.Equal(t, 2, cnt.n, "second conversion should be read from the store")
+
+	convert(t, c, notebook("one", "three"))
+	require.Equal(t, 4, cnt.n)
+	require.Equal(t, 2, store.Len())
+
+	t.Run("errors are not stored", func(t *testing.T) {
+		require.Error(t, c.Convert(io.Discard, notebook("fail")))
+		require.Equal(t, 2, store.Len())
+	})
+}
+
+// keyer is an extension with an option.
+type keyer struct{ option string }
+
+func (k keyer) Extend(*nb.Notebook) {}
+func (k keyer) CacheKey() string    { return k.option }
+
+func TestConverter_Key(t *testing.T) {
+	source := notebook("one")
+	store := cache.NewMemory(1 << 20)
+	key := func(n *nb.Notebook, opts ...cache.Option) string {
+		return cache.New(n, store, opts...).Key(source)
+	}
+
+	base := key(nb.New())
+	require.Equal(t, base, key(nb.New()), "same configuration")
+	require.NotEqual(t, base, cache.New(nb.New(), store).Key(notebook("two")), "different source")
+	require.NotEqual(t, base, key(nb.New(), cache.WithKey("lenient")), "renderer options")
+	require.NotEqual(t, base, key(nb.New(nb.WithExtensions(keyer{"a"}))), "extension set")
+	require.NotEqual(t, key(nb.New(nb.WithExtensions(keyer{"a"}))), key(nb.New(nb.WithExtensions(keyer{"b"}))), "extension options")
+
+	t.Run("renderer options", func(t *testing.T) {
+		htmlRenderer := func(opts ...html.Option) *nb.Notebook {
+			return nb.New(nb.WithRenderer(render.NewRenderer(render.WithCellRenderers(html.NewRenderer(opts...)))))
+		}
+
+		require.Equal(t, base, key(htmlRenderer()), "default renderer")
+		require.Equal(t, base, key(htmlRenderer(html.WithCSSWriter(io.Discard))), "css writer")
+		require.NotEqual(t, base, key(htmlRenderer(html.WithIDPrefix("a-"))), "id prefix")
+		require.NotEqual(t, key(htmlRenderer(html.WithIDPrefix("a-"))), key(htmlRenderer(html.WithIDPrefix("b-"))), "different id prefixes")
+		require.NotEqual(t, base, key(nb.New(nb.WithRenderOptions(render.WithLenientErrors(nil)))), "error mode")
+		require.NotEqual(t, base, key(nb.New(nb.WithRenderOptions(render.WithCellRenderers(&counter{})))), "cell renderers")
+	})
+}
+
+func TestWithCells(t *testing.T) {
+	var cnt counter
+	cells := cache.NewMemory(1 << 20)
+	c := cache.New(nb.New(nb.WithRenderOptions(render.WithCellRenderers(&cnt))), cache.NewMemory(1<<20), cache.WithCells(cells))
+
+	convert(t, c, notebook("one", "two", "three"))
+	require.Equal(t, 3, cnt.n)
+
+	got := convert(t, c, notebook("one", "2", "three"))
+	require.Equal(t, 4, cnt.n, "only the changed cell should be rendered")
+	require.Equal(t, convert(t, nb.New(nb.WithRenderOptions(render.WithCellRenderers(&counter{}))), notebook("one", "2", "three")), got)
+
+	convert(t, c, notebook("three", "one"))
+	require.Equal(t, 6, cnt.n, "cells are cached with their index")
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	store := cache.NewDir(dir)
+
+	_, ok := store.Get("key")
+	require.False(t, ok)
+
+	require.NoError(t, store.Put("key", []byte("value")))
+	require.NoError(t, store.Put("../other key", []byte("other")))
+
+	got, ok := cache.NewDir(dir).Get("key")
+	require.True(t, ok, "values are shared between stores in the same directory")
+	require.Equal(t, "value", string(got))
+
+	got, ok = store.Get("../other key")
+	require.True(t, ok)
+	require.Equal(t, "other", string(got))
+
+	require.NoError(t, store.Put("key", []byte("new value")))
+	got, _ = store.Get("key")
+	require.Equal(t, "new value", string(got))
+}
+
+func TestMemory(t *testing.T) {
+	m := cache.NewMemory(10)
+	require.NoError(t, m.Put("a", []byte("aaaa")))
+	require.NoError(t, m.Put("b", []byte("bbbb")))
+	_, _ = m.Get("a") // b is now the least recently used
+	require.NoError(t, m.Put("c", []byte("cccc")))
+
+	_, ok := m.Get("b")
+	require.False(t, ok, "least recently used value should be evicted")
+	for _, key := range []string{"a", "c"} {
+		_, ok := m.Get(key)
+		require.True(t, ok, key)
+	}
+
+	require.NoError(t, m.Put("big", []byte("larger than the limit")))
+	_, ok = m.Get("big")
+	require.False(t, ok)
+	require.Equal(t, 2, m.Len())
+
+	t.Run("disabled", func(t *testing.T) {
+		m := cache.NewMemory(0)
+		require.NoError(t, m.Put("empty", nil))
+		require.Equal(t, 0, m.Len())
+	})
+}
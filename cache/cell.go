@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+)
+
+// cellCache stores the rendered cells of the notebooks converted with the same configuration.
+type cellCache struct {
+	store  Store
+	config []byte
+}
+
+var _ render.CellCache = (*cellCache)(nil)
+
+// Key hashes the configuration, the cell's index and everything a renderer can read from the cell.
+// Cells whose attachments cannot be encoded are not cached.
+func (c *cellCache) Key(i int, cell schema.Cell) (string, bool) {
+	h := sha256.New()
+	field(h, c.config)
+	field(h, []byte("cell"))
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], uint64(i))
+	field(h, idx[:])
+	if !hashCell(h, cell) {
+		return "", false
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (c *cellCache) Get(key string) ([]byte, bool) {
+	return c.store.Get(key)
+}
+
+func (c *cellCache) Put(key string, b []byte) {
+	// The renderer reuses the buffer only after Put returns, but the store may keep the value.
+	_ = c.store.Put(key, append([]byte(nil), b...))
+}
+
+// hashCell writes the contents of the cell and its outputs to h.
+func hashCell(h hash.Hash, cell schema.Cell) bool {
+	field(h, []byte(cell.Type().String()))
+	field(h, []byte(cell.MimeType()))
+	field(h, cell.Text())
+	if c, ok := cell.(schema.HasID); ok {
+		field(h, []byte(c.ID()))
+	}
+	if c, ok := cell.(schema.HasMetadata); ok {
+		field(h, c.RawMetadata())
+	}
+	if c, ok := cell.(schema.CodeCell); ok {
+		field(h, []byte(c.Language()))
+	}
+	if c, ok := cell.(schema.ExecutionCounter); ok {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(c.ExecutionCount()))
+		field(h, n[:])
+	}
+	if c, ok := cell.(schema.HasAttachments); ok && c.Attachments() != nil {
+		b, err := json.Marshal(c.Attachments())
+		if err != nil {
+			return false
+		}
+		field(h, b)
+	}
+	// Renderers may choose any of the representations in a mime-bundle.
+	if mb, ok := cell.(interface {
+		MimeTypes() []string
+		Data(string) []byte
+	}); ok {
+		for _, mime := range mb.MimeTypes() {
+			field(h, []byte(mime))
+			field(h, mb.Data(mime))
+		}
+	}
+	if c, ok := cell.(schema.Outputter); ok {
+		outs := c.Outputs()
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(outs)))
+		field(h, n[:])
+		for _, out := range outs {
+			if !hashCell(h, out) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// field writes the length-prefixed value to h, so that the boundaries between the values are unambiguous.
+func field(h hash.Hash, b []byte) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store keeps rendered output by key. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value stored for the key.
+	Get(key string) ([]byte, bool)
+
+	// Put stores the value for the key. Callers must not modify the value afterwards.
+	Put(key string, value []byte) error
+}
+
+// Memory is a Store which keeps the most recently used values up to a limit on their total size.
+type Memory struct {
+	mu      sync.Mutex
+	limit   int
+	size    int
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+var _ Store = (*Memory)(nil)
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+// NewMemory creates a Memory store which holds up to limit bytes. Nothing is stored if the limit is not positive.
+func NewMemory(limit int) *Memory {
+	return &Memory{
+		limit:   limit,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for the key and marks it as recently used.
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+// Put stores the value, evicting the least recently used ones to stay within the limit.
+// Values larger than the limit are not stored.
+func (m *Memory) Put(key string, value []byte) error {
+	if m.limit <= 0 || len(value) > m.limit {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.size += len(value) - len(e.Value.(*entry).value)
+		e.Value.(*entry).value = value
+		m.order.MoveToFront(e)
+	} else {
+		m.entries[key] = m.order.PushFront(&entry{key: key, value: value})
+		m.size += len(value)
+	}
+	for m.size > m.limit {
+		e := m.order.Remove(m.order.Back()).(*entry)
+		delete(m.entries, e.key)
+		m.size -= len(e.value)
+	}
+	return nil
+}
+
+// Len returns the number of stored values.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// Dir is a Store which keeps every value in a file in a directory, so that they are shared
+// between processes and survive restarts. Nothing is ever removed from the directory.
+type Dir struct {
+	dir string
+}
+
+var _ Store = (*Dir)(nil)
+
+// NewDir creates a Dir store in dir. The directory is created when the first value is stored.
+func NewDir(dir string) *Dir {
+	return &Dir{dir: dir}
+}
+
+// Get reads the value from its file. Files which cannot be read are treated as missing.
+func (d *Dir) Get(key string) ([]byte, bool) {
+	b, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Put writes the value to a temporary file and moves it in place, so that readers
+// never see a partially written value.
+func (d *Dir) Put(key string, value []byte) error {
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("cache: put: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cache: put: %w", err)
+	}
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("cache: put: %w", err)
+	}
+	return nil
+}
+
+// path hashes the key, so that any key is a valid file name,
+// and spreads the files over subdirectories named after the first byte of the hash.
+func (d *Dir) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.dir, name[:2], name[2:])
+}
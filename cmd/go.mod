@@ -0,0 +1,14 @@
+module github.com/bevzzz/nb/cmd
+
+go 1.18
+
+require (
+	github.com/bevzzz/nb v0.2.0
+	github.com/robert-nix/ansihtml v1.0.1
+	github.com/yuin/goldmark v1.6.0
+)
+
+require golang.org/x/net v0.20.0 // indirect
+
+// The commands are built against the library in this repository.
+replace github.com/bevzzz/nb => ../
@@ -0,0 +1,83 @@
+// Package ext configures the extensions of the nb commands from the -ext flag.
+//
+// The commands render notebooks like example/nbee does: markdown cells are converted with [goldmark]
+// and ANSI escape sequences in stream and error outputs with [ansihtml]. The flag takes a comma-separated
+// list of the extensions to enable:
+//
+//   - markdown: render markdown cells with goldmark (GitHub Flavored Markdown, raw HTML is kept)
+//   - ansi: convert ANSI colors in stream and error outputs to HTML
+//   - attachment: inline the cell attachments referenced in markdown (see package extension/attachment)
+//   - toc: add anchors to the headings and a table of contents after a cell tagged "toc" (see package extension/toc);
+//     markdown cells are rendered with goldmark
+//
+// "none" disables all extensions, which leaves the source of markdown cells unrendered.
+//
+// [goldmark]: https://github.com/yuin/goldmark
+// [ansihtml]: https://github.com/robert-nix/ansihtml
+package ext
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/robert-nix/ansihtml"
+	"github.com/yuin/goldmark"
+	gmext "github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/extension"
+	"github.com/bevzzz/nb/extension/adapter"
+	"github.com/bevzzz/nb/extension/attachment"
+	"github.com/bevzzz/nb/extension/toc"
+	"github.com/bevzzz/nb/render"
+)
+
+// Default is the value of the -ext flag if it is not set.
+const Default = "markdown,ansi,attachment"
+
+// Usage describes the -ext flag.
+const Usage = "comma-separated list of extensions: markdown, ansi, attachment, toc, or none"
+
+// Parse returns the extensions in the comma-separated list.
+func Parse(list string) ([]nb.Extension, error) {
+	enabled := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "markdown", "ansi", "attachment", "toc":
+			enabled[name] = true
+		case "none", "":
+		default:
+			return nil, fmt.Errorf("unknown extension %q", name)
+		}
+	}
+
+	var exts []nb.Extension
+	switch {
+	case enabled["toc"]:
+		exts = append(exts, toc.New(Markdown()))
+	case enabled["markdown"]:
+		exts = append(exts, extension.NewMarkdown(Markdown()))
+	}
+	if enabled["ansi"] {
+		exts = append(exts, extension.NewStream(adapter.AnsiHtml(ansihtml.ConvertToHTML)))
+	}
+	if enabled["attachment"] {
+		exts = append(exts, attachment.New())
+	}
+	return exts, nil
+}
+
+// md converts GitHub Flavored Markdown. Raw HTML is rendered as is, like in Jupyter.
+var md = goldmark.New(
+	goldmark.WithExtensions(gmext.GFM),
+	goldmark.WithRendererOptions(gmhtml.WithUnsafe()),
+)
+
+// Markdown renders markdown cells with goldmark.
+func Markdown() render.RenderCellFunc {
+	return adapter.Goldmark(func(b []byte, w io.Writer) error {
+		return md.Convert(b, w)
+	})
+}
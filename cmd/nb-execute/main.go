@@ -0,0 +1,101 @@
+// Command nb-execute runs the code cells of Jupyter notebooks and saves their outputs.
+//
+// The kernel is chosen by the kernelspec in the notebook's metadata unless -kernel is set,
+// and started from the kernelspecs installed in the Jupyter data directories (see package execute).
+// Executed notebooks are written to OUTPUT, or back to FILE with -inplace.
+//
+// nb-execute exits with status 1 if a cell raises an exception or times out, and with status 2
+// on any other error. This makes it a drop-in replacement for
+// "jupyter nbconvert --to notebook --execute" in CI pipelines.
+//
+// Usage:
+//
+//	nb-execute [-timeout DURATION] [-allow-errors] [-kernel NAME] (-inplace | -o OUTPUT) FILE
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/execute"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 0, "maximum execution time of a cell (default: no limit)")
+	startup := flag.Duration("startup-timeout", time.Minute, "maximum time to wait for the kernel to start")
+	allowErrors := flag.Bool("allow-errors", false, "continue executing after a cell raises an exception")
+	kernel := flag.String("kernel", "", "kernelspec name (default: from notebook metadata)")
+	inplace := flag.Bool("inplace", false, "overwrite FILE with the executed notebook")
+	out := flag.String("o", "", "output file")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: nb-execute [-timeout DURATION] [-allow-errors] [-kernel NAME] (-inplace | -o OUTPUT) FILE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || (*out == "") == !*inplace {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *inplace {
+		*out = flag.Arg(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, flag.Arg(0), *out,
+		execute.WithTimeout(*timeout),
+		execute.WithStartupTimeout(*startup),
+		execute.WithAllowErrors(*allowErrors),
+		execute.WithKernelName(*kernel),
+		execute.WithStderr(os.Stderr),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nb-execute:", err)
+		var ce *schema.CellError
+		if errors.As(err, &ce) {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+}
+
+// run executes the notebook and writes the result. A partially executed notebook
+// is still written if a cell fails, so that the error can be inspected.
+func run(ctx context.Context, in, out string, opts ...execute.Option) error {
+	b, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	nb, err := decode.Bytes(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+
+	executed, execErr := execute.Execute(ctx, nb, opts...)
+	if executed == nil {
+		return fmt.Errorf("%s: %w", in, execErr)
+	}
+	res, err := encode.Bytes(executed)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, res, 0o644); err != nil {
+		return err
+	}
+	if execErr != nil {
+		return fmt.Errorf("%s: %w", in, execErr)
+	}
+	return nil
+}
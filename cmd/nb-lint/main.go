@@ -0,0 +1,118 @@
+// Command nb-lint checks Jupyter notebooks for problems like out-of-order execution counts,
+// error outputs, oversized outputs and attachments, and broken attachment links (see package lint).
+//
+// Findings are printed to stdout one per line, or as a JSON array with -format json:
+//
+//	analysis.ipynb: cell 4 (f2a9c1): error: output 0 is an error: ValueError: oops [error-output]
+//
+// nb-lint exits with status 1 if any finding is at least as severe as -fail-on, and with status 2
+// if a notebook cannot be read. This makes it suitable as a pre-commit hook.
+//
+// Usage:
+//
+//	nb-lint [-format text|json] [-fail-on SEVERITY] [-disable RULE,...] [-max-output-size BYTES] [-max-attachment-size BYTES] FILE...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/lint"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+func main() {
+	format := flag.String("format", "text", "output format: text or json")
+	failOn := lint.Warning
+	flag.Func("fail-on", "minimum severity of findings which fail the check: info, warning, or error (default warning)", func(s string) error {
+		return failOn.UnmarshalText([]byte(s))
+	})
+	disable := flag.String("disable", "", "comma-separated list of rules to disable")
+	maxOutput := flag.Int("max-output-size", lint.DefaultMaxOutputSize, "maximum size of an output in bytes")
+	maxAttachment := flag.Int("max-attachment-size", lint.DefaultMaxAttachmentSize, "maximum size of an attachment in bytes")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: nb-lint [-format text|json] [-fail-on SEVERITY] [-disable RULE,...] [-max-output-size BYTES] [-max-attachment-size BYTES] FILE...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*format != "text" && *format != "json") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []lint.Option{
+		lint.WithRules(lint.OutputSize(*maxOutput), lint.AttachmentSize(*maxAttachment)),
+	}
+	if *disable != "" {
+		opts = append(opts, lint.WithDisabled(strings.Split(*disable, ",")...))
+	}
+	l := lint.New(opts...)
+
+	var results []result
+	failed := false
+	for _, file := range flag.Args() {
+		findings, err := check(l, file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "nb-lint:", err)
+			os.Exit(2)
+		}
+		for _, f := range findings {
+			results = append(results, result{File: file, Finding: f})
+			failed = failed || f.Severity >= failOn
+		}
+	}
+
+	if err := write(os.Stdout, *format, results); err != nil {
+		fmt.Fprintln(os.Stderr, "nb-lint:", err)
+		os.Exit(2)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// result is a finding in one of the notebooks.
+type result struct {
+	File string `json:"file"`
+	lint.Finding
+}
+
+func check(l *lint.Linter, file string) ([]lint.Finding, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	nb, err := decode.Bytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	findings, err := l.Notebook(nb)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return findings, nil
+}
+
+func write(w io.Writer, format string, results []result) error {
+	if format == "json" {
+		if results == nil {
+			results = []result{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", r.File, r.Finding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Command nb-merge is a git merge driver for Jupyter notebooks.
+//
+// It merges notebooks cell by cell (see package merge) and writes the result to the local file,
+// exiting with status 1 if some of the changes could not be merged. To use it in a repository, run:
+//
+//	git config merge.nb.name "Jupyter notebook merge driver"
+//	git config merge.nb.driver "nb-merge %O %A %B"
+//	echo "*.ipynb merge=nb" >> .gitattributes
+//
+// Usage:
+//
+//	nb-merge [-outputs local|remote|clear] BASE LOCAL REMOTE
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+func main() {
+	outputs := flag.String("outputs", "local", "resolve conflicting outputs: local, remote, or clear")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: nb-merge [-outputs local|remote|clear] BASE LOCAL REMOTE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conflicts, err := run(*outputs, flag.Arg(0), flag.Arg(1), flag.Arg(2))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nb-merge:", err)
+		os.Exit(2)
+	}
+	if len(conflicts) > 0 {
+		for _, c := range conflicts {
+			fmt.Fprintf(os.Stderr, "nb-merge: conflict in %s: %s\n", flag.Arg(1), c)
+		}
+		os.Exit(1)
+	}
+}
+
+// run merges the notebooks and overwrites the local file with the result.
+func run(outputs, base, local, remote string) ([]merge.Conflict, error) {
+	strategy, err := merge.ParseOutputStrategy(outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	var nbs [3]schema.Notebook
+	for i, path := range []string{base, local, remote} {
+		if nbs[i], err = decodeFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := merge.Notebooks(nbs[0], nbs[1], nbs[2], merge.WithOutputStrategy(strategy))
+	if err != nil {
+		return nil, err
+	}
+	b, err := encode.Bytes(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(local, b, 0o644); err != nil {
+		return nil, err
+	}
+	return m.Conflicts, nil
+}
+
+func decodeFile(path string) (schema.Notebook, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// An empty base means the file was added in both branches.
+	if len(b) == 0 {
+		b = []byte(`{"nbformat": 4, "nbformat_minor": 5, "metadata": {}, "cells": []}`)
+	}
+	nb, err := decode.Bytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return nb, nil
+}
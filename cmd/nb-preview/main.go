@@ -0,0 +1,107 @@
+// Command nb-preview serves a notebook or a directory of notebooks over HTTP, rendered as nb renders them,
+// and reloads the page in the browser whenever the files change (see package server).
+//
+// Markdown is rendered with goldmark, ANSI colors in the outputs are converted to HTML, and cell attachments
+// are inlined. Like in nb, the extensions are selected with -ext (see package cmd/internal/ext for the list).
+//
+// The files are polled for changes every -interval. Pages listen to the changes with Server-Sent Events,
+// so a notebook saved in the editor shows up in the browser shortly after. With -scrub, credentials and
+// personal data are redacted from the notebooks before rendering (see package scrub).
+//
+// Usage:
+//
+//	nb-preview [-addr HOST:PORT] [-interval DURATION] [-ext NAME,...] [-scrub] [FILE|DIR]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/cmd/internal/ext"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/scrub"
+	"github.com/bevzzz/nb/server"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8000", "address to listen on")
+	interval := flag.Duration("interval", 500*time.Millisecond, "how often to check the files for changes")
+	extensions := flag.String("ext", ext.Default, ext.Usage)
+	redact := flag.Bool("scrub", false, "redact credentials and personal data")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: nb-preview [-addr HOST:PORT] [-interval DURATION] [-ext NAME,...] [-scrub] [FILE|DIR]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	exts, err := ext.Parse(*extensions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nb-preview:", err)
+	}
+	root := "."
+	if err != nil || flag.NArg() > 1 || *interval <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	} else if flag.NArg() == 1 {
+		root = flag.Arg(0)
+	}
+
+	// A single notebook is served from its directory, so that the files it references are available too.
+	dir, page := root, ""
+	info, err := os.Stat(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !info.IsDir() {
+		dir, page = filepath.Dir(root), filepath.Base(root)
+	}
+
+	if *redact {
+		exts = append(exts, scrub.New())
+	}
+	reloader := server.NewReloader()
+	fsys := os.DirFS(dir)
+	h := server.New(fsys, server.WithNotebook(nb.New(nb.WithExtensions(exts...))), server.WithLiveReload(reloader))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		err := server.Watch(ctx, fsys, *interval, func(names []string) {
+			log.Printf("changed: %v", names)
+			reloader.Reload()
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err)
+		}
+	}()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	u := url.URL{Scheme: "http", Host: ln.Addr().String(), Path: "/" + filepath.ToSlash(page)}
+	log.Printf("serving %s at %s", dir, u.String())
+
+	srv := http.Server{Handler: h}
+	go func() {
+		<-ctx.Done()
+		// Event streams stay open until the clients disconnect, so they are closed rather than drained.
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
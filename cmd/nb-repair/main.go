@@ -0,0 +1,74 @@
+// Command nb-repair recovers Jupyter notebooks which contain git conflict markers.
+//
+// It rebuilds both versions of the notebook and merges them cell by cell (see package repair),
+// overwriting the file with a valid notebook unless -o is set. Conflicting cells are listed
+// on stderr and annotated with a "merge_conflict" key in their metadata.
+//
+// Usage:
+//
+//	nb-repair [-mode both|mark] [-o OUTPUT] FILE
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/repair"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+func main() {
+	mode := flag.String("mode", "both", "resolve conflicting cells: both (keep both versions) or mark (add conflict markers)")
+	out := flag.String("o", "", "output file (default: overwrite FILE)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: nb-repair [-mode both|mark] [-o OUTPUT] FILE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = flag.Arg(0)
+	}
+
+	if err := run(*mode, flag.Arg(0), *out); err != nil {
+		fmt.Fprintln(os.Stderr, "nb-repair:", err)
+		os.Exit(1)
+	}
+}
+
+func run(mode, in, out string) error {
+	var m repair.Mode
+	switch mode {
+	case "both":
+		m = repair.KeepBoth
+	case "mark":
+		m = repair.Mark
+	default:
+		return fmt.Errorf("unknown mode %q", mode)
+	}
+
+	b, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	nb, err := repair.Bytes(b, repair.WithMode(m))
+	if err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+	for _, c := range nb.Conflicts {
+		fmt.Fprintf(os.Stderr, "nb-repair: %s: %s\n", in, c)
+	}
+
+	repaired, err := encode.Bytes(nb)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, repaired, 0o644)
+}
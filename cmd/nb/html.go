@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"path/filepath"
+
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/site"
+)
+
+// page is passed to the HTML template.
+type page struct {
+	// Title is the notebook's title from its metadata, its first heading, or the file name.
+	Title string
+
+	// CSS is the stylesheet of the theme.
+	CSS template.CSS
+
+	// Body is the rendered notebook.
+	Body template.HTML
+}
+
+func (c *converter) html(w io.Writer, nb schema.Notebook, name string) error {
+	var body bytes.Buffer
+	// The renderer does not call WrapAll, which opens the notebook container.
+	err := c.wrap.WrapAll(&body, func(w io.Writer) error {
+		return c.n.Renderer().Render(w, nb)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.tmpl.Execute(w, page{
+		Title: title(nb, name),
+		CSS:   template.CSS(c.css),
+		Body:  template.HTML(body.String()),
+	})
+}
+
+// title is the notebook's title (see site.Title), which falls back to the file name.
+func title(nb schema.Notebook, name string) string {
+	if name == "-" {
+		return site.Title(nb, "Notebook")
+	}
+	return site.Title(nb, filepath.ToSlash(name))
+}
+
+// filter wraps the cells in cw, leaving out the source or outputs of code cells as configured with -no-input and -no-output.
+func (c *converter) filter(cw render.CellWrapper) *filter {
+	return &filter{CellWrapper: cw, noInput: c.opt.noInput, noOutput: c.opt.noOutput}
+}
+
+// filter leaves out the source or outputs of code cells. Cells with neither are skipped entirely.
+type filter struct {
+	render.CellWrapper
+	noInput, noOutput bool
+}
+
+var _ render.IndexedWrapper = (*filter)(nil)
+
+func (*filter) RegisterFuncs(render.RenderCellFuncRegistry) {}
+
+func (f *filter) WithIndex(i int) render.CellWrapper {
+	cw := f.CellWrapper
+	if iw, ok := cw.(render.IndexedWrapper); ok {
+		cw = iw.WithIndex(i)
+	}
+	return &filter{CellWrapper: cw, noInput: f.noInput, noOutput: f.noOutput}
+}
+
+func (f *filter) Wrap(w io.Writer, cell schema.Cell, r render.RenderCellFunc) error {
+	if cell.Type() == schema.Code && f.noInput && f.noOutput {
+		return nil
+	}
+	return f.CellWrapper.Wrap(w, cell, r)
+}
+
+func (f *filter) WrapInput(w io.Writer, cell schema.Cell, r render.RenderCellFunc) error {
+	if cell.Type() == schema.Code && f.noInput {
+		return nil
+	}
+	return f.CellWrapper.WrapInput(w, cell, r)
+}
+
+func (f *filter) WrapOutput(w io.Writer, out schema.Outputter, r render.RenderCellFunc) error {
+	if f.noOutput {
+		return nil
+	}
+	return f.CellWrapper.WrapOutput(w, out, r)
+}
@@ -0,0 +1,308 @@
+// Command nb converts Jupyter notebooks to standalone HTML pages or markdown documents, or re-encodes them as nbformat v4.5.
+//
+// Notebooks are read from the files and glob patterns given as arguments, or from stdin if there are none
+// or the argument is "-". Each notebook is written next to its source with the extension of the format,
+// or into the -o directory, mirroring the relative paths of the inputs. Use "-o -" to write to stdout.
+//
+// HTML pages are rendered with the html/template given in -template, which receives the page's .Title,
+// .CSS, and .Body, and styled with a -theme: light (default), dark, none, or a path to a CSS file,
+// which is added to the light theme. The extensions used to render the pages are selected with -ext:
+// by default, markdown is rendered with goldmark, ANSI colors in the outputs are converted to HTML,
+// and cell attachments are inlined (see package cmd/internal/ext for the list).
+//
+// Markdown documents keep the markdown cells as is, fence the code and text outputs, and inline the images
+// and cell attachments as data URIs. Code cells and outputs can be left out with -no-input and -no-output.
+// With -scrub, credentials and personal data are redacted from the notebooks before conversion (see package scrub).
+//
+// nb converts as many notebooks as it can and exits with status 1 if any of them fails,
+// and with status 2 on invalid flags or if no files match the patterns.
+//
+// Usage:
+//
+//	nb [-to html|md|ipynb] [-o DIR] [-template FILE] [-theme NAME] [-ext NAME,...] [-no-input] [-no-output] [-scrub] [FILE|PATTERN ...]
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/cmd/internal/ext"
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/extension/attachment"
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/scrub"
+)
+
+const (
+	exitFailed = 1 // some notebooks could not be converted
+	exitUsage  = 2 // invalid flags or no input files
+)
+
+//go:embed page.html
+var defaultTemplate string
+
+//go:embed dark.css
+var darkCSS string
+
+// options are the command-line flags.
+type options struct {
+	to       string
+	out      string
+	template string
+	theme    string
+	ext      string
+	noInput  bool
+	noOutput bool
+	scrub    bool
+}
+
+func main() {
+	var opt options
+	flag.StringVar(&opt.to, "to", "html", "output format: html, md, or ipynb")
+	flag.StringVar(&opt.out, "o", "", "output directory, or - for stdout (default: next to each input file)")
+	flag.StringVar(&opt.template, "template", "", "html/template file for HTML pages")
+	flag.StringVar(&opt.theme, "theme", "light", "HTML theme: light, dark, none, or a CSS file")
+	flag.StringVar(&opt.ext, "ext", ext.Default, "HTML extensions: "+ext.Usage)
+	flag.BoolVar(&opt.noInput, "no-input", false, "exclude the source of code cells")
+	flag.BoolVar(&opt.noOutput, "no-output", false, "exclude the outputs of code cells")
+	flag.BoolVar(&opt.scrub, "scrub", false, "redact credentials and personal data")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: nb [-to html|md|ipynb] [-o DIR] [-template FILE] [-theme NAME] [-ext NAME,...] [-no-input] [-no-output] [-scrub] [FILE|PATTERN ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files, err := expand(flag.Args())
+	if err == nil && opt.out == "-" && len(files) > 1 {
+		err = errors.New("cannot write more than one notebook to stdout")
+	}
+	var c *converter
+	if err == nil {
+		c, err = newConverter(opt)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nb:", err)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	failed := false
+	for _, file := range files {
+		if err := c.convertFile(file); err != nil {
+			fmt.Fprintln(os.Stderr, "nb:", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(exitFailed)
+	}
+}
+
+// expand resolves glob patterns. Arguments without glob metacharacters are kept as is,
+// so that a missing file is reported when it is converted. No arguments means stdin.
+func expand(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	var files []string
+	for _, arg := range args {
+		if arg == "-" || !strings.ContainsAny(arg, "*?[") {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no matching files", arg)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// converter converts notebooks to the selected format.
+type converter struct {
+	opt  options
+	n    *nb.Notebook       // renders the cells in HTML and markdown
+	wrap render.CellWrapper // opens the notebook container in HTML pages
+	tmpl *template.Template
+	css  string // stylesheet of the theme
+}
+
+func newConverter(opt options) (*converter, error) {
+	c := converter{opt: opt}
+	switch opt.to {
+	case "html":
+		if err := c.initHTML(); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	case "md":
+		md := &markdown{}
+		c.n = nb.New(
+			nb.WithRenderer(render.NewRenderer(render.WithCellRenderers(md, c.filter(md)))),
+			nb.WithExtensions(attachment.New()),
+		)
+		return &c, nil
+	case "ipynb":
+		if opt.noInput {
+			return nil, errors.New("-no-input is not supported for ipynb")
+		}
+		return &c, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", opt.to)
+	}
+}
+
+// initHTML configures the renderer, the template, and the theme of HTML pages.
+func (c *converter) initHTML() error {
+	exts, err := ext.Parse(c.opt.ext)
+	if err != nil {
+		return err
+	}
+	hr := html.NewRenderer()
+	c.n = nb.New(
+		nb.WithRenderOptions(render.WithCellRenderers(hr, c.filter(hr))),
+		nb.WithExtensions(exts...),
+	)
+	c.wrap = hr
+
+	if c.opt.template == "" {
+		c.tmpl, err = template.New("page").Parse(defaultTemplate)
+	} else {
+		c.tmpl, err = template.ParseFiles(c.opt.template)
+	}
+	if err != nil {
+		return err
+	}
+
+	var baseCSS bool // include the light Jupyter theme
+	var themeCSS string
+	switch c.opt.theme {
+	case "light":
+		baseCSS = true
+	case "dark":
+		baseCSS, themeCSS = true, darkCSS
+	case "none":
+	default:
+		b, err := os.ReadFile(c.opt.theme)
+		if err != nil {
+			return fmt.Errorf("theme: %w", err)
+		}
+		baseCSS, themeCSS = true, string(b)
+	}
+	if baseCSS {
+		c.css = string(html.CSS())
+	}
+	c.css += themeCSS
+	return nil
+}
+
+// convertFile converts the notebook and writes it to the output path.
+func (c *converter) convertFile(in string) error {
+	out := c.outputPath(in)
+	if out != "-" && filepath.Clean(out) == filepath.Clean(in) {
+		return fmt.Errorf("%s: output would overwrite the input, use -o to choose another directory", in)
+	}
+
+	var b []byte
+	var err error
+	if in == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(in)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := c.convert(&buf, b, in); err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+
+	if out == "-" {
+		_, err = buf.WriteTo(os.Stdout)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(out, buf.Bytes(), 0o644)
+}
+
+// outputPath replaces the extension of the input file with that of the format.
+// Relative paths are mirrored in the output directory, absolute paths and those outside
+// of the working directory are written to the top level of it.
+func (c *converter) outputPath(in string) string {
+	if in == "-" || c.opt.out == "-" {
+		return "-"
+	}
+	name := strings.TrimSuffix(filepath.Base(in), filepath.Ext(in)) + "." + c.opt.to
+	if c.opt.out == "" {
+		return filepath.Join(filepath.Dir(in), name)
+	}
+	dir := filepath.Dir(filepath.Clean(in))
+	if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		dir = ""
+	}
+	return filepath.Join(c.opt.out, dir, name)
+}
+
+func (c *converter) convert(w io.Writer, b []byte, name string) error {
+	nb, err := decode.Bytes(b)
+	if err != nil {
+		return err
+	}
+	if c.opt.scrub {
+		var findings []scrub.Finding
+		if nb, findings, err = scrub.Notebook(nb); err != nil {
+			return err
+		}
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "nb: %s: redacted %s\n", name, f)
+		}
+	}
+
+	switch c.opt.to {
+	case "ipynb":
+		if c.opt.noOutput {
+			if nb, err = clearOutputs(nb); err != nil {
+				return err
+			}
+		}
+		return encode.Write(w, nb)
+	case "md":
+		return c.n.Renderer().Render(w, nb)
+	}
+	return c.html(w, nb, name)
+}
+
+// clearOutputs copies the notebook, removing the outputs and execution counts of code cells.
+func clearOutputs(nb schema.Notebook) (schema.Notebook, error) {
+	return schema.MapCells(nb, func(_ int, cell schema.Cell) (schema.Cell, error) {
+		if cell.Type() != schema.Code {
+			return cell, nil
+		}
+		c := merge.NewCodeCell(cell)
+		c.Out, c.Count = nil, 0
+		return c, nil
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+)
+
+// markdown renders the notebook as a markdown document. Markdown cells are copied as is,
+// code is written in fenced blocks, images are inlined as data URIs, and HTML outputs are kept as raw HTML.
+type markdown struct{}
+
+var _ render.CellRenderer = (*markdown)(nil)
+var _ render.CellWrapper = (*markdown)(nil)
+
+func (md *markdown) RegisterFuncs(reg render.RenderCellFuncRegistry) {
+	reg.Register(render.Pref{Type: schema.Markdown, MimeType: common.MarkdownText}, md.renderText)
+	reg.Register(render.Pref{Type: schema.Code}, md.renderCode)
+	reg.Register(render.Pref{Type: schema.Raw}, md.renderText)
+
+	reg.Register(render.Pref{Type: schema.Stream}, md.renderPre)
+	reg.Register(render.Pref{MimeType: common.Stderr}, md.renderPre)
+	reg.Register(render.Pref{MimeType: "application/json"}, md.renderPre)
+	reg.Register(render.Pref{MimeType: "text/*"}, md.renderPre)
+	reg.Register(render.Pref{MimeType: "text/html"}, md.renderText)
+	reg.Register(render.Pref{MimeType: common.MarkdownText}, md.renderText)
+	reg.Register(render.Pref{MimeType: "image/*"}, md.renderImage)
+}
+
+// renderText writes the contents of the cell as is.
+func (md *markdown) renderText(w io.Writer, cell schema.Cell) error {
+	_, err := w.Write(bytes.TrimRight(cell.Text(), "\n"))
+	return err
+}
+
+// renderCode writes the source in a block fenced with the language of the cell.
+func (md *markdown) renderCode(w io.Writer, cell schema.Cell) error {
+	var lang string
+	if code, ok := cell.(schema.CodeCell); ok {
+		lang = code.Language()
+	}
+	return fence(w, lang, cell.Text())
+}
+
+// ansi matches the ANSI escape sequences which color stream and error outputs.
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// renderPre writes the text output in a fenced block, removing ANSI escape sequences.
+func (md *markdown) renderPre(w io.Writer, cell schema.Cell) error {
+	return fence(w, "", ansi.ReplaceAll(cell.Text(), nil))
+}
+
+// renderImage inlines the base64-encoded image.
+func (md *markdown) renderImage(w io.Writer, cell schema.Cell) error {
+	data := strings.Join(strings.Fields(string(cell.Text())), "")
+	_, err := io.WriteString(w, "![](data:"+cell.MimeType()+";base64,"+data+")")
+	return err
+}
+
+// fence writes the text in a fenced code block, which is longer than any run of backticks in the text.
+func fence(w io.Writer, lang string, text []byte) error {
+	f := "```"
+	for bytes.Contains(text, []byte(f)) {
+		f += "`"
+	}
+	_, err := io.WriteString(w, f+lang+"\n"+strings.TrimRight(string(text), "\n")+"\n"+f)
+	return err
+}
+
+// WrapAll writes the cells.
+func (md *markdown) WrapAll(w io.Writer, render func(io.Writer) error) error {
+	return render(w)
+}
+
+// Wrap separates the cells with blank lines.
+func (md *markdown) Wrap(w io.Writer, cell schema.Cell, render render.RenderCellFunc) error {
+	if err := render(w, cell); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (md *markdown) WrapInput(w io.Writer, cell schema.Cell, render render.RenderCellFunc) error {
+	if err := render(w, cell); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WrapOutput separates the outputs with blank lines.
+func (md *markdown) WrapOutput(w io.Writer, cell schema.Outputter, render render.RenderCellFunc) error {
+	for _, out := range cell.Outputs() {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		if err := render(w, out); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package nb
 
 import (
+	"context"
 	"io"
 
 	"github.com/bevzzz/nb/decode"
@@ -13,6 +14,16 @@ func Convert(w io.Writer, source []byte) error {
 	return defaultNotebook.Convert(w, source)
 }
 
+// ConvertContext converts a Jupyter notebook using default converter and stops once ctx is done.
+func ConvertContext(ctx context.Context, w io.Writer, source []byte) error {
+	return defaultNotebook.ConvertContext(ctx, w, source)
+}
+
+// ConvertReader converts a Jupyter notebook read from r using default converter.
+func ConvertReader(w io.Writer, r io.Reader) error {
+	return defaultNotebook.ConvertReader(w, r)
+}
+
 var defaultNotebook = New()
 
 // Converter converts raw Jupyter Notebook JSON to the selected format.
@@ -42,10 +53,24 @@ func WithRenderOptions(opts ...render.Option) Option {
 	}
 }
 
+// WithDecodeOptions configures how notebooks are decoded, e.g. to validate them before rendering.
+func WithDecodeOptions(opts ...decode.Option) Option {
+	return func(n *Notebook) {
+		n.decodeOptions = append(n.decodeOptions, opts...)
+	}
+}
+
+// WithDecoders uses decoders from the registry instead of the default one.
+// This allows overriding how some versions are decoded without affecting other users of the default registry.
+func WithDecoders(r *decode.Registry) Option {
+	return WithDecodeOptions(decode.WithRegistry(r))
+}
+
 // Notebook is an extensible Converter implementation.
 type Notebook struct {
-	renderer   render.Renderer
-	extensions []Extension
+	renderer      render.Renderer
+	decodeOptions []decode.Option
+	extensions    []Extension
 }
 
 var _ Converter = (*Notebook)(nil)
@@ -75,19 +100,61 @@ func DefaultRenderer() render.Renderer {
 
 // Сonvert raw Jupyter Notebook JSON and write the output.
 func (n *Notebook) Convert(w io.Writer, source []byte) error {
-	// nb, err := decode.Decode(source)
-	nb, err := decode.Bytes(source)
+	nb, err := decode.Bytes(source, n.decodeOptions...)
 	if err != nil {
 		return err
 	}
 	return n.renderer.Render(w, nb)
 }
 
+// ConvertContext is like Convert, but stops once ctx is done.
+// If the renderer implements render.ContextRenderer, cancellation is checked between
+// cells and their outputs, and ctx is passed down to context-aware RenderCellFuncs.
+// Otherwise ctx is only checked before rendering.
+func (n *Notebook) ConvertContext(ctx context.Context, w io.Writer, source []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nb, err := decode.Bytes(source, n.decodeOptions...)
+	if err != nil {
+		return err
+	}
+	if r, ok := n.renderer.(render.ContextRenderer); ok {
+		return r.RenderContext(ctx, w, nb)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return n.renderer.Render(w, nb)
+}
+
+// ConvertReader decodes Jupyter Notebook JSON from r one cell at a time and writes the output.
+// Prefer it to Convert for large notebooks, as it does not hold the entire document in memory.
+func (n *Notebook) ConvertReader(w io.Writer, r io.Reader) error {
+	nb, err := decode.Reader(r, n.decodeOptions...)
+	if err != nil {
+		return err
+	}
+	defer nb.Close()
+	return n.renderer.Render(w, nb)
+}
+
 // Renderer exposes current renderer, allowing it to be further configured and/or extended.
 func (n *Notebook) Renderer() render.Renderer {
 	return n.renderer
 }
 
+// Extensions returns the extensions the converter was created with.
+func (n *Notebook) Extensions() []Extension {
+	return n.extensions
+}
+
+// WrapRenderer replaces the current renderer with the one returned by wrap.
+// It allows extensions to inspect the entire notebook before its cells are rendered.
+func (n *Notebook) WrapRenderer(wrap func(render.Renderer) render.Renderer) {
+	n.renderer = wrap(n.renderer)
+}
+
 // Extension adds new capabilities to the base Notebook.
 type Extension interface {
 	Extend(n *Notebook)
@@ -2,6 +2,8 @@ package nb_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"io"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/decode"
 	"github.com/bevzzz/nb/render"
 	"github.com/bevzzz/nb/render/html"
 	"github.com/bevzzz/nb/schema"
@@ -58,6 +61,63 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+func TestConvertContext(t *testing.T) {
+	// Arrange
+	ipynb, err := os.ReadFile("testdata/notebook.ipynb")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	var got bytes.Buffer
+	err = nb.ConvertContext(ctx, &got, ipynb)
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, got.String(), "rendered output")
+}
+
+func TestConvertReader(t *testing.T) {
+	// Arrange
+	f, err := os.Open("testdata/notebook.ipynb")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Act
+	var got bytes.Buffer
+	err = nb.ConvertReader(&got, f)
+	require.NoError(t, err)
+
+	// Assert
+	cmpGolden(t, "testdata/notebook.golden", got.Bytes(), false)
+}
+
+func BenchmarkConvert(b *testing.B) {
+	ipynb, err := os.ReadFile("testdata/notebook.ipynb")
+	require.NoError(b, err)
+
+	b.Run("Convert", func(b *testing.B) {
+		b.SetBytes(int64(len(ipynb)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := nb.Convert(io.Discard, ipynb); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ConvertReader", func(b *testing.B) {
+		b.SetBytes(int64(len(ipynb)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := nb.ConvertReader(io.Discard, bytes.NewReader(ipynb)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 // cmpGolden compares the result of the test run with a golden file.
 // If the contents don't match and upd == true, it will update the golden file
 // with the current value instead of failing the test.
@@ -159,6 +219,23 @@ func TestOptions(t *testing.T) {
 			t.Errorf("option not applied or applied incorrectly")
 		}
 	})
+
+	t.Run("WithDecoders", func(t *testing.T) {
+		// Arrange
+		reg := decode.NewRegistry()
+		source := []byte(`{"nbformat": 4, "nbformat_minor": 4, "metadata": {}, "cells": []}`)
+
+		// Act
+		err := nb.New(nb.WithDecoders(reg)).Convert(io.Discard, source)
+
+		// Assert
+		if !errors.Is(err, decode.ErrUnsupportedVersion) {
+			t.Errorf("expected %v, got %v", decode.ErrUnsupportedVersion, err)
+		}
+		if err := nb.Convert(io.Discard, source); err != nil {
+			t.Errorf("default registry is affected: %v", err)
+		}
+	})
 }
 
 // spyRenderer records info about options that were applied to it.
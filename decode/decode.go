@@ -3,16 +3,39 @@ package decode
 import (
 	"encoding/json"
 	"fmt"
-	"sync"
 
 	"github.com/bevzzz/nb/schema"
 	"github.com/bevzzz/nb/schema/common"
 )
 
 // Bytes decodes raw JSON bytes into a version-specific notebook representation.
-func Bytes(b []byte) (schema.Notebook, error) {
+//
+// Errors specific to a cell or an output are reported as *schema.CellError.
+// Malformed JSON is reported as *DecodeError with the line and column at which it occurred.
+func Bytes(b []byte, opts ...Option) (schema.Notebook, error) {
+	return New(opts...).Bytes(b)
+}
+
+// Parser decodes notebooks using its own configuration and decoder registry.
+// It is safe for concurrent use.
+type Parser struct {
+	cfg Config
+}
+
+// New returns a Parser configured with the options.
+// Unless WithRegistry is passed, it uses decoders from the default registry.
+func New(opts ...Option) *Parser {
+	return &Parser{cfg: newConfig(opts)}
+}
+
+// Bytes is like the package-level Bytes, but uses the parser's configuration.
+func (p *Parser) Bytes(b []byte) (schema.Notebook, error) {
+	if err := p.cfg.validate(b); err != nil {
+		return nil, fmt.Errorf("decode: bytes: %w", err)
+	}
+
 	var nb notebook
-	if err := json.Unmarshal(b, &nb); err != nil {
+	if err := nb.decode(b, p.cfg); err != nil {
 		return nil, fmt.Errorf("decode: bytes: %w", err)
 	}
 	return &nb, nil
@@ -28,93 +51,93 @@ func (n *notebook) Cells() []schema.Cell {
 	return n.cells
 }
 
+// rawNotebook captures notebook header and raw cells in a single pass.
+//
+// Prior to v4.0 cells were not a part of the top level structure,
+// and were contained in "worksheets" instead.
+type rawNotebook struct {
+	common.Notebook
+	Major      *int              `json:"nbformat"`
+	Minor      *int              `json:"nbformat_minor"`
+	Cells      []json.RawMessage `json:"cells"`
+	Worksheets []struct {
+		Cells []json.RawMessage `json:"cells"`
+	} `json:"worksheets"`
+}
+
 func (n *notebook) UnmarshalJSON(data []byte) error {
-	if err := json.Unmarshal(data, &n.Notebook); err != nil {
-		return err
+	return n.decode(data, Config{})
+}
+
+// decode decodes the notebook from src, locating errors in the document.
+func (n *notebook) decode(src []byte, cfg Config) error {
+	var raw rawNotebook
+	if err := json.Unmarshal(src, &raw); err != nil {
+		return locate(err, 0, src)
 	}
 
-	ver := n.Version()
-	d, ok := getDecoder(ver)
-	if !ok {
-		return fmt.Errorf("schema %s is not supported", ver)
+	var h header
+	if h.hasMajor = raw.Major != nil; h.hasMajor {
+		h.major = *raw.Major
+	}
+	if h.hasMinor = raw.Minor != nil; h.hasMinor {
+		h.minor = *raw.Minor
 	}
+	d, ver, err := cfg.decoder(h)
+	if err != nil {
+		return err
+	}
+	n.Notebook = raw.Notebook
+	n.VersionMajor, n.VersionMinor = ver.Major, ver.Minor
 
 	meta, err := d.DecodeMeta(n.Notebook.Metadata)
 	if err != nil {
 		return fmt.Errorf("%s: notebook metadata: %w", ver, err)
 	}
 
-	cells, err := d.ExtractCells(data)
-	if err != nil {
-		return fmt.Errorf("%s: extract cells: %w", ver, err)
+	cells := raw.Cells
+	for i := range raw.Worksheets {
+		cells = append(cells, raw.Worksheets[i].Cells...)
 	}
 
-	n.cells = make([]schema.Cell, len(cells))
-	for i, raw := range cells {
-		c := cell{meta: meta, decoder: d}
-		if err := json.Unmarshal(raw, &c); err != nil {
-			return fmt.Errorf("%s: %w", ver, err)
+	// offsets are only looked up if the cells need to be located in the document.
+	var offsets []int64
+	offset := func(i int) int64 {
+		if offsets == nil {
+			offsets = cellOffsets(src, len(cells))
 		}
-		n.cells[i] = c.cell
+		return offsets[i]
 	}
-	return nil
-}
-
-// cell unmarshals cell bytes according to the notebook version.
-type cell struct {
-	decoder Decoder
-	meta    schema.NotebookMetadata
-	cell    schema.Cell
-}
 
-func (c *cell) UnmarshalJSON(data []byte) error {
-	var v map[string]interface{}
-	if err := json.Unmarshal(data, &v); err != nil {
-		return err
-	}
-	cell, err := c.decoder.DecodeCell(v, data, c.meta)
-	if err != nil {
-		return fmt.Errorf("cell content: %w", err)
+	n.cells = make([]schema.Cell, len(cells))
+	for i, data := range cells {
+		c, err := d.DecodeCell(data, meta)
+		if err == nil {
+			err = cfg.check(data, c)
+		}
+		if err := cfg.report(i, data, err, offset, src); err != nil {
+			return fmt.Errorf("%s: %w", ver, err)
+		}
+		n.cells[i] = c
 	}
-	c.cell = cell
 	return nil
 }
 
 // Decoder implementations are version-aware and decode cell contents and metadata
 // based on the respective JSON schema definition.
 type Decoder interface {
-	// ExtractCells accesses the array of notebook cells.
-	//
-	// Prior to v4.0 cells were not a part of the top level structure,
-	// and were contained in "worksheets" instead.
-	ExtractCells(data []byte) ([]json.RawMessage, error)
-
 	// DecodeMeta decodes version-specific metadata.
 	DecodeMeta(data []byte) (schema.NotebookMetadata, error)
 
 	// DecodeCell decodes raw cell data to a version-specific implementation.
-	DecodeCell(v map[string]interface{}, data []byte, meta schema.NotebookMetadata) (schema.Cell, error)
+	// Implementations should determine the cell type and decode its contents in a single pass.
+	//
+	// Malformed outputs should be reported with LocateOutputError.
+	// The caller adds the cell's index and location in the document to the returned error.
+	DecodeCell(data []byte, meta schema.NotebookMetadata) (schema.Cell, error)
 }
 
-var (
-	mutex    = new(sync.RWMutex)
-	decoders = make(map[schema.Version]Decoder)
-)
-
-// RegisterDecoder for a schema version.
+// RegisterDecoder for a schema version in the default registry.
 func RegisterDecoder(v schema.Version, d Decoder) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	if d == nil {
-		panic("invalid nil decoder")
-	}
-	decoders[v] = d
-}
-
-// getDecoder by schema version.
-func getDecoder(v schema.Version) (d Decoder, ok bool) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-	d, ok = decoders[v]
-	return
+	defaultRegistry.Register(v, d)
 }
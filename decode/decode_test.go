@@ -2,12 +2,16 @@ package decode_test
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/bevzzz/nb/schema"
 	"github.com/bevzzz/nb/schema/common"
 	_ "github.com/bevzzz/nb/schema/v3"
-	_ "github.com/bevzzz/nb/schema/v4"
+	v4 "github.com/bevzzz/nb/schema/v4"
 
 	"github.com/bevzzz/nb/decode"
 	"github.com/stretchr/testify/require"
@@ -565,6 +569,9 @@ func TestDecodeBytes(t *testing.T) {
 								{"output_type": "display_data", "metadata": {},
 									"json": ["{\"foo\": \"bar\"}"]
 								},
+								{"output_type": "display_data", "metadata": {},
+									"json": ["{'foo': 'bar'}"]
+								},
 								{"output_type": "display_data", "metadata": {},
 									"pdf": ["some-raw-pdf-data"]
 								},
@@ -609,6 +616,11 @@ func TestDecodeBytes(t *testing.T) {
 						MimeType: "application/json",
 						Text:     []byte("{\"foo\": \"bar\"}"), // ????
 					}},
+					{Cell: Cell{
+						Type:     schema.DisplayData,
+						MimeType: "application/json",
+						Text:     []byte(`"{'foo': 'bar'}"`), // not valid JSON, kept as a string
+					}},
 					{Cell: Cell{
 						Type:     schema.DisplayData,
 						MimeType: "application/pdf",
@@ -755,6 +767,86 @@ func TestDecodeBytes(t *testing.T) {
 					}},
 				},
 			},
+			{
+				name: "v4.4: mime-bundle with multiline strings and JSON values",
+				json: `{
+					"nbformat": 4, "nbformat_minor": 4, "metadata": {},
+					"cells": [
+						{"cell_type": "code", "outputs": [
+							{"output_type": "display_data", "metadata": {},
+								"data": {
+									"text/html": ["<ul>\n", "  <li>One</li>\n", "</ul>"],
+									"text/plain": ["One"]
+								}
+							},
+							{"output_type": "display_data", "metadata": {},
+								"data": {
+									"text/plain": ["<Figure size 640x480>", "\n"]
+								}
+							},
+							{"output_type": "execute_result", "metadata": {}, "execution_count": 1,
+								"data": {
+									"application/json": {"zeta": [1, 2], "alpha": {"b": null, "a": "\u00e9"}},
+									"text/plain": ["{'zeta': [1, 2]}"]
+								}
+							},
+							{"output_type": "display_data", "metadata": {},
+								"data": {
+									"application/vnd.vegalite.v5+json": {"mark": "bar"},
+									"text/plain": "<VegaLite 5 object>"
+								}
+							}
+						]}
+					]
+				}`,
+				want: []output{
+					{Cell: Cell{
+						Type:     schema.DisplayData,
+						MimeType: "text/html",
+						Text:     []byte("<ul>\n  <li>One</li>\n</ul>"),
+					}},
+					{Cell: Cell{
+						Type:     schema.DisplayData,
+						MimeType: common.PlainText,
+						Text:     []byte("<Figure size 640x480>\n"),
+					}},
+					{ExecutionCount: 1, Cell: Cell{
+						Type:     schema.ExecuteResult,
+						MimeType: "application/json",
+						Text:     []byte(`{"zeta": [1, 2], "alpha": {"b": null, "a": "\u00e9"}}`),
+					}},
+					{Cell: Cell{
+						Type:     schema.DisplayData,
+						MimeType: "application/vnd.vegalite.v5+json",
+						Text:     []byte(`{"mark": "bar"}`),
+					}},
+				},
+			},
+			{
+				name: "v4.4: richer mime-type is preferred",
+				json: `{
+					"nbformat": 4, "nbformat_minor": 4, "metadata": {},
+					"cells": [
+						{"cell_type": "code", "outputs": [
+							{"output_type": "display_data", "metadata": {},
+								"data": {
+									"text/plain": "<DataFrame>",
+									"text/latex": "\\begin{tabular}\\end{tabular}",
+									"image/png": "base64-encoded-png-image",
+									"text/html": "<table></table>"
+								}
+							}
+						]}
+					]
+				}`,
+				want: []output{
+					{Cell: Cell{
+						Type:     schema.DisplayData,
+						MimeType: "text/html",
+						Text:     []byte("<table></table>"),
+					}},
+				},
+			},
 			{
 				name: "v4.4: error output",
 				json: `{
@@ -863,6 +955,454 @@ func TestDecodeBytes(t *testing.T) {
 	})
 }
 
+func TestDecodeReader(t *testing.T) {
+	const (
+		// v4 notebook with its cells preceding the header, as Jupyter writes them.
+		v4 = `{
+			"cells": [
+				{"cell_type": "markdown", "metadata": {}, "source": ["# Title"]},
+				{"cell_type": "code", "execution_count": 1, "metadata": {}, "outputs": [
+					{"output_type": "stream", "name": "stdout", "text": ["Hi, mom!\n"]}
+				], "source": ["print('Hi, mom!')"]},
+				{"cell_type": "raw", "metadata": {"format": "text/html"}, "source": ["<b>\u00e9</b>"]}
+			],
+			"metadata": {"language_info": {"name": "python"}},
+			"nbformat": 4,
+			"nbformat_minor": 5
+		}`
+
+		// v4 notebook with its header preceding the cells.
+		v4HeaderFirst = `{
+			"nbformat": 4, "nbformat_minor": 4, "metadata": {"language_info": {"name": "python"}},
+			"cells": [
+				{"cell_type": "markdown", "metadata": {}, "source": ["# Title"]},
+				{"cell_type": "code", "execution_count": 1, "metadata": {}, "outputs": [
+					{"output_type": "stream", "name": "stdout", "text": ["Hi, mom!\n"]}
+				], "source": ["print('Hi, mom!')"]},
+				{"cell_type": "raw", "metadata": {"format": "text/html"}, "source": ["<b>\u00e9</b>"]}
+			],
+			"extra": {"ignored": [1, 2.5, true, null]}
+		}`
+
+		// v3 notebook with cells in several worksheets.
+		v3 = `{
+			"worksheets": [
+				{"cells": [
+					{"cell_type": "heading", "level": 1, "metadata": {}, "source": ["Title"]},
+					{"cell_type": "code", "language": "python", "input": ["print('Hi, mom!')"], "outputs": []}
+				], "metadata": {}},
+				{"metadata": {}, "cells": [
+					{"cell_type": "raw", "source": ["raw"]}
+				]}
+			],
+			"metadata": {}, "nbformat": 3, "nbformat_minor": 0
+		}`
+	)
+
+	// nonSeeker hides io.Seeker implementation of the underlying reader.
+	type nonSeeker struct{ io.Reader }
+
+	for _, tt := range []struct {
+		name string
+		json string
+		r    func(string) io.Reader
+	}{
+		{
+			name: "v4.5 cells before header, seekable",
+			json: v4,
+			r:    func(s string) io.Reader { return strings.NewReader(s) },
+		},
+		{
+			name: "v4.5 cells before header, not seekable",
+			json: v4,
+			r:    func(s string) io.Reader { return nonSeeker{strings.NewReader(s)} },
+		},
+		{
+			name: "v4.4 header before cells",
+			json: v4HeaderFirst,
+			r:    func(s string) io.Reader { return nonSeeker{strings.NewReader(s)} },
+		},
+		{
+			name: "v3.0 worksheets, seekable",
+			json: v3,
+			r:    func(s string) io.Reader { return strings.NewReader(s) },
+		},
+		{
+			name: "v3.0 worksheets, not seekable",
+			json: v3,
+			r:    func(s string) io.Reader { return nonSeeker{strings.NewReader(s)} },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			want, err := decode.Bytes([]byte(tt.json))
+			require.NoError(t, err)
+
+			// Act
+			s, err := decode.Reader(tt.r(tt.json))
+			require.NoError(t, err)
+			defer s.Close()
+
+			var got []schema.Cell
+			for {
+				c, err := s.ReadCell()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, c)
+			}
+
+			// Assert
+			require.Equal(t, want.Version(), s.Version(), "version")
+			require.Len(t, got, len(want.Cells()), "number of cells")
+			for i, c := range want.Cells() {
+				checkCell(t, got[i], Cell{Type: c.Type(), MimeType: c.MimeType(), Text: c.Text()})
+
+				if code, ok := c.(schema.CodeCell); ok {
+					got := toCodeCell(t, got[i])
+					require.Equal(t, code.Language(), got.Language(), "language")
+					require.Len(t, got.Outputs(), len(code.Outputs()), "number of outputs")
+				}
+			}
+		})
+	}
+
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := decode.Reader(strings.NewReader(`{"cells": [], "metadata": {}, "nbformat": 0, "nbformat_minor": 1}`))
+		require.Error(t, err)
+	})
+
+	t.Run("malformed cell", func(t *testing.T) {
+		s, err := decode.Reader(strings.NewReader(`{"cells": [{"cell_type": "markdown", "source": []}, {"cell_type": 1}], "metadata": {}, "nbformat": 4, "nbformat_minor": 4}`))
+		require.NoError(t, err)
+		defer s.Close()
+
+		require.Len(t, s.Cells(), 1, "cells decoded before the error")
+		require.Error(t, s.Err())
+	})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	// notebook has a malformed output at line 6, column 4.
+	notebook := func(output string) string {
+		return `{
+ "cells": [
+  {"cell_type": "markdown", "id": "first", "source": []},
+  {"cell_type": "code", "id": "abc", "source": [], "execution_count": 1, "outputs": [
+   {"output_type": "stream", "name": "stdout", "text": []},
+   ` + output + `
+  ]}
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+	}
+
+	// decoders decode the notebook with Bytes and Reader, returning the first error.
+	decoders := map[string]func(string) error{
+		"bytes": func(s string) error {
+			_, err := decode.Bytes([]byte(s))
+			return err
+		},
+		"reader": func(s string) error {
+			nb, err := decode.Reader(strings.NewReader(s))
+			if err != nil {
+				return err
+			}
+			defer nb.Close()
+			nb.Cells()
+			return nb.Err()
+		},
+	}
+
+	for name, decodeString := range decoders {
+		decodeString := decodeString
+		t.Run(name, func(t *testing.T) {
+			t.Run("unknown output type", func(t *testing.T) {
+				nb := notebook(`{"output_type": "unknown"}`)
+				err := decodeString(nb)
+
+				var cellErr *schema.CellError
+				require.ErrorAs(t, err, &cellErr)
+				require.Equal(t, 1, cellErr.Index, "cell index")
+				require.Equal(t, "abc", cellErr.ID, "cell id")
+				require.Equal(t, 1, cellErr.OutputIndex, "output index")
+				require.ErrorContains(t, err, `cell 1 (id "abc"): output 1`)
+
+				var decodeErr *decode.DecodeError
+				require.ErrorAs(t, err, &decodeErr)
+				require.EqualValues(t, strings.Index(nb, `{"output_type": "unknown"}`), decodeErr.Offset, "offset")
+			})
+
+			t.Run("wrong type in output", func(t *testing.T) {
+				err := decodeString(notebook(`{"output_type": "stream", "name": 42}`))
+
+				var cellErr *schema.CellError
+				require.ErrorAs(t, err, &cellErr)
+				require.Equal(t, 1, cellErr.OutputIndex, "output index")
+			})
+
+			t.Run("wrong type in cell", func(t *testing.T) {
+				nb := notebook(`{"output_type": "error", "ename": "", "evalue": "", "traceback": []}`)
+				err := decodeString(strings.Replace(nb, `"execution_count": 1`, `"execution_count": "1"`, 1))
+
+				var cellErr *schema.CellError
+				require.ErrorAs(t, err, &cellErr)
+				require.Equal(t, 1, cellErr.Index, "cell index")
+				require.Equal(t, -1, cellErr.OutputIndex, "output index")
+			})
+
+			t.Run("unsupported version", func(t *testing.T) {
+				err := decodeString(strings.Replace(notebook(`{}`), `"nbformat": 4`, `"nbformat": 0`, 1))
+
+				require.ErrorIs(t, err, decode.ErrUnsupportedVersion)
+			})
+		})
+	}
+
+	t.Run("bytes reports line and column", func(t *testing.T) {
+		_, err := decode.Bytes([]byte(notebook(`{"output_type": "unknown"}`)))
+
+		var decodeErr *decode.DecodeError
+		require.ErrorAs(t, err, &decodeErr)
+		require.Equal(t, 6, decodeErr.Line, "line")
+		require.Equal(t, 4, decodeErr.Column, "column")
+	})
+
+	t.Run("bytes reports syntax errors", func(t *testing.T) {
+		_, err := decode.Bytes([]byte("{\n \"cells\": [,]\n}"))
+
+		var decodeErr *decode.DecodeError
+		require.ErrorAs(t, err, &decodeErr)
+		require.Equal(t, 2, decodeErr.Line, "line")
+	})
+}
+
+func TestDecodeLenient(t *testing.T) {
+	const (
+		exoticCell   = `{"cell_type": "exotic", "metadata": {}, "source": "?"}`
+		exoticOutput = `{"output_type": "exotic", "data": 1}`
+	)
+	notebook := `{"nbformat": 4, "nbformat_minor": 5, "metadata": {}, "cells": [
+		{"cell_type": "markdown", "metadata": {}, "source": ""},
+		` + exoticCell + `,
+		{"cell_type": "code", "metadata": {}, "source": "", "execution_count": 1, "outputs": [` + exoticOutput + `]}
+	]}`
+
+	// decoders decode the notebook with Bytes and Reader, reading all cells.
+	decoders := map[string]func(string, ...decode.Option) (schema.Notebook, []schema.Cell, error){
+		"bytes": func(s string, opts ...decode.Option) (schema.Notebook, []schema.Cell, error) {
+			nb, err := decode.Bytes([]byte(s), opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nb, nb.Cells(), nil
+		},
+		"reader": func(s string, opts ...decode.Option) (schema.Notebook, []schema.Cell, error) {
+			nb, err := decode.Reader(strings.NewReader(s), opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			defer nb.Close()
+			cells := nb.Cells()
+			return nb, cells, nb.Err()
+		},
+	}
+
+	for name, decodeString := range decoders {
+		decodeString := decodeString
+		t.Run(name, func(t *testing.T) {
+			t.Run("unknown cell type fails by default", func(t *testing.T) {
+				_, _, err := decodeString(notebook)
+
+				require.ErrorIs(t, err, decode.ErrUnknownCellType)
+				var cellErr *schema.CellError
+				require.ErrorAs(t, err, &cellErr)
+				require.Equal(t, 1, cellErr.Index)
+			})
+
+			t.Run("unknown cells and outputs are unrecognized", func(t *testing.T) {
+				var report decode.Report
+				_, cells, err := decodeString(notebook, decode.WithLenient(&report))
+				require.NoError(t, err)
+				require.Len(t, cells, 3)
+
+				cell, ok := cells[1].(*common.Unrecognized)
+				require.True(t, ok, "cell is %T", cells[1])
+				require.Equal(t, schema.Unrecognized, cell.Type())
+				require.Equal(t, "exotic", cell.Kind)
+				require.JSONEq(t, exoticCell, string(cell.Raw))
+
+				out, ok := toCodeCell(t, cells[2]).Outputs()[0].(*common.Unrecognized)
+				require.True(t, ok, "output is %T", toCodeCell(t, cells[2]).Outputs()[0])
+				require.JSONEq(t, exoticOutput, string(out.Raw))
+
+				warnings := report.Warnings()
+				require.Len(t, warnings, 2)
+				require.ErrorIs(t, warnings[0], decode.ErrUnknownCellType)
+				require.ErrorIs(t, warnings[1], decode.ErrUnknownOutputType)
+				var cellErr *schema.CellError
+				require.ErrorAs(t, warnings[1], &cellErr)
+				require.Equal(t, 2, cellErr.Index, "cell index")
+				require.Equal(t, 0, cellErr.OutputIndex, "output index")
+			})
+
+			t.Run("missing nbformat_minor", func(t *testing.T) {
+				nb := strings.Replace(notebook, `"nbformat_minor": 5, `, "", 1)
+
+				_, _, err := decodeString(nb)
+				require.ErrorIs(t, err, decode.ErrMissingVersion)
+
+				var report decode.Report
+				got, _, err := decodeString(nb, decode.WithLenient(&report))
+				require.NoError(t, err)
+				require.Equal(t, schema.Version{Major: 4, Minor: 5}, got.Version(), "latest minor version")
+				require.ErrorIs(t, report.Warnings()[0], decode.ErrMissingVersion)
+			})
+
+			t.Run("unknown minor version", func(t *testing.T) {
+				nb := strings.Replace(notebook, `"nbformat_minor": 5`, `"nbformat_minor": 99`, 1)
+
+				_, _, err := decodeString(nb)
+				require.ErrorIs(t, err, decode.ErrUnsupportedVersion)
+
+				var report decode.Report
+				got, cells, err := decodeString(nb, decode.WithLenient(&report))
+				require.NoError(t, err)
+				require.Len(t, cells, 3)
+				require.Equal(t, schema.Version{Major: 4, Minor: 99}, got.Version(), "declared version")
+				require.ErrorIs(t, report.Warnings()[0], decode.ErrUnsupportedVersion)
+			})
+
+			t.Run("unknown major version", func(t *testing.T) {
+				nb := strings.Replace(notebook, `"nbformat": 4`, `"nbformat": 99`, 1)
+
+				_, _, err := decodeString(nb, decode.WithLenient(nil))
+				require.ErrorIs(t, err, decode.ErrUnsupportedVersion)
+			})
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	source := []byte(`{"nbformat": 4, "nbformat_minor": 5, "metadata": {}, "cells": [{"cell_type": "markdown", "metadata": {}, "source": "a"}]}`)
+
+	t.Run("overrides do not affect the default registry", func(t *testing.T) {
+		// Arrange
+		reg := decode.DefaultRegistry().Clone()
+		reg.Register(schema.Version{Major: 4, Minor: 5}, fakeDecoder{})
+
+		// Act
+		custom, err := decode.New(decode.WithRegistry(reg)).Bytes(source)
+		require.NoError(t, err)
+		def, err := decode.Bytes(source)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, "fake", string(custom.Cells()[0].Text()), "custom decoder")
+		require.Equal(t, "a", string(def.Cells()[0].Text()), "default decoder")
+	})
+
+	t.Run("empty registry", func(t *testing.T) {
+		_, err := decode.New(decode.WithRegistry(decode.NewRegistry())).Bytes(source)
+
+		require.ErrorIs(t, err, decode.ErrUnsupportedVersion)
+	})
+
+	t.Run("packages register decoders in any registry", func(t *testing.T) {
+		// Arrange
+		reg := decode.NewRegistry()
+		v4.Register(reg)
+
+		// Act
+		s, err := decode.New(decode.WithRegistry(reg)).Reader(bytes.NewReader(source))
+		require.NoError(t, err)
+		defer s.Close()
+
+		// Assert
+		require.Len(t, s.Cells(), 1)
+		require.NoError(t, s.Err())
+	})
+}
+
+// fakeDecoder decodes every cell as a markdown cell with "fake" text.
+type fakeDecoder struct{}
+
+func (fakeDecoder) DecodeMeta([]byte) (schema.NotebookMetadata, error) { return nil, nil }
+
+func (fakeDecoder) DecodeCell([]byte, schema.NotebookMetadata) (schema.Cell, error) {
+	return &common.Markdown{Source: common.MultilineString{"fake"}}, nil
+}
+
+func BenchmarkDecode(b *testing.B) {
+	small, err := os.ReadFile("../testdata/notebook.ipynb")
+	require.NoError(b, err)
+
+	for _, bb := range []struct {
+		name string
+		json []byte
+	}{
+		{name: "testdata", json: small},
+		{name: "large", json: largeNotebook(200)},
+	} {
+		b.Run(bb.name+"/Bytes", func(b *testing.B) {
+			b.SetBytes(int64(len(bb.json)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decode.Bytes(bb.json); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(bb.name+"/Reader", func(b *testing.B) {
+			b.SetBytes(int64(len(bb.json)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s, err := decode.Reader(bytes.NewReader(bb.json))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for {
+					if _, err = s.ReadCell(); err != nil {
+						break
+					}
+				}
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				s.Close()
+			}
+		})
+	}
+}
+
+// largeNotebook generates a v4.5 notebook with n groups of markdown and code cells.
+// Each code cell has a stream output, a JSON output, and an image output of about 16KB.
+func largeNotebook(n int) []byte {
+	img := strings.Repeat("iVBORw0KGgoAAAANSUhEUgAAA", 16<<10/25)
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"cells": [`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `
+			{"cell_type": "markdown", "id": "md-%[1]d", "metadata": {}, "source": ["## Section %[1]d\n", "\n", "Some *text*."]},
+			{"cell_type": "code", "id": "code-%[1]d", "execution_count": %[1]d, "metadata": {}, "source": ["import json\n", "print(%[1]d)"],
+			 "outputs": [
+				{"output_type": "stream", "name": "stdout", "text": ["%[1]d\n"]},
+				{"output_type": "execute_result", "execution_count": %[1]d, "metadata": {}, "data": {"application/json": {"b": [1, 2], "a": "c"}, "text/plain": ["{'b': [1, 2],", " 'a': 'c'}"]}},
+				{"output_type": "display_data", "metadata": {}, "data": {"image/png": "%[2]s", "text/plain": ["<Figure>"]}}
+			 ]}`, i, img)
+	}
+	buf.WriteString(`], "metadata": {"language_info": {"name": "python"}}, "nbformat": 4, "nbformat_minor": 5}`)
+	return buf.Bytes()
+}
+
 // checkCell compares the cell's type and content to expected.
 func checkCell(tb testing.TB, got schema.Cell, want Cell) {
 	tb.Helper()
@@ -0,0 +1,217 @@
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// ErrUnsupportedVersion is returned for notebooks whose version has no registered Decoder.
+var ErrUnsupportedVersion = errors.New("unsupported version")
+
+// DecodeError reports malformed JSON and its location in the document.
+type DecodeError struct {
+	// Offset is the number of bytes read before the error occurred, or -1 if the location is unknown.
+	Offset int64
+
+	// Line and Column are the 1-based position of the Offset in the document.
+	// They are only available if the entire document is held in memory, i.e. for Bytes, and are zero otherwise.
+	Line, Column int
+
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	switch {
+	case e.Line > 0:
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	case e.Offset >= 0:
+		return fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// LocateOutputError finds the first of the cell's "outputs" which fails to decode with unmarshal
+// and returns a *schema.CellError describing its location. Decoders should use it to report malformed outputs.
+// If all outputs can be decoded, err is returned unchanged.
+func LocateOutputError(data []byte, err error, unmarshal func([]byte) error) error {
+	located := err
+	walkOutputs(data, func(i int, out json.RawMessage, off int64) bool {
+		outErr := unmarshal(out)
+		if outErr == nil {
+			return true
+		}
+		inner, _ := jsonOffset(outErr)
+		located = &schema.CellError{OutputIndex: i, Err: &DecodeError{Offset: off + inner, Err: outErr}}
+		return false
+	})
+	return located
+}
+
+// walkOutputs calls fn for each of the cell's "outputs" with its offset in the cell data until fn returns false.
+// Malformed data is ignored, as walkOutputs is only used to locate errors.
+func walkOutputs(data []byte, fn func(i int, out json.RawMessage, offset int64) bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if expectDelim(dec, '{') != nil {
+		return
+	}
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return
+		}
+		if key != "outputs" {
+			if skipValue(dec) != nil {
+				return
+			}
+			continue
+		}
+
+		if expectDelim(dec, '[') != nil {
+			return
+		}
+		for i := 0; dec.More(); i++ {
+			var out json.RawMessage
+			if dec.Decode(&out) != nil {
+				return
+			}
+			if !fn(i, out, dec.InputOffset()-int64(len(out))) {
+				return
+			}
+		}
+		return
+	}
+}
+
+// locate wraps JSON syntax and type errors in a *DecodeError.
+// base is the offset of the decoded value in the document and src, if not nil, is the entire document.
+func locate(err error, base int64, src []byte) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return err
+	}
+
+	off, ok := jsonOffset(err)
+	if !ok {
+		return err
+	}
+	de = &DecodeError{Offset: off, Err: err}
+	de.move(base, src)
+	return de
+}
+
+// cellError records the index and the ID of the i-th cell in the error returned by the Decoder.
+// Offsets reported for the cell's data are translated to the offsets in the document, see locate.
+func cellError(i int, data []byte, err error, base int64, src []byte) error {
+	var ce *schema.CellError
+	if !errors.As(err, &ce) {
+		ce = &schema.CellError{OutputIndex: -1, Err: err}
+		err = ce
+	}
+	ce.Index = i
+
+	var id struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(data, &id) == nil {
+		ce.ID = id.ID
+	}
+
+	var de *DecodeError
+	if !errors.As(ce.Err, &de) {
+		off, ok := jsonOffset(ce.Err)
+		if !ok {
+			return err
+		}
+		de = &DecodeError{Offset: off, Err: ce.Err}
+		ce.Err = de
+	}
+	de.move(base, src)
+	return err
+}
+
+// move translates the error's offset relative to a value which starts at base. Negative base means unknown location.
+func (e *DecodeError) move(base int64, src []byte) {
+	if base < 0 || e.Offset < 0 {
+		e.Offset = -1
+		return
+	}
+	e.Offset += base
+	if src != nil && e.Offset <= int64(len(src)) {
+		e.Line, e.Column = position(src, e.Offset)
+	}
+}
+
+// jsonOffset reports the offset of JSON syntax and type errors.
+func jsonOffset(err error) (int64, bool) {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset > 0 {
+		// Offset counts the invalid character, but should point to it instead.
+		return syntaxErr.Offset - 1, true
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset, true
+	}
+	return 0, false
+}
+
+// position converts the offset in src to 1-based line and column numbers.
+func position(src []byte, offset int64) (line, col int) {
+	line, col = 1, 1
+	for _, b := range src[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+			continue
+		}
+		col++
+	}
+	return
+}
+
+// cellOffsets reports the offsets of all cells in src. Offsets of the cells which cannot be found are -1.
+// It is only used to locate errors, so that the cells need not be tracked while decoding.
+func cellOffsets(src []byte, n int) []int64 {
+	offsets := make([]int64, n)
+	for i := range offsets {
+		offsets[i] = -1
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(src))
+	if expectDelim(dec, '{') != nil {
+		return offsets
+	}
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return offsets
+		}
+		if key != "cells" && key != "worksheets" {
+			if skipValue(dec) != nil {
+				return offsets
+			}
+			continue
+		}
+
+		sc, err := newCellScanner(dec, key, 0)
+		if err != nil {
+			return offsets
+		}
+		for i := range offsets {
+			if _, offsets[i], err = sc.Next(); err != nil {
+				offsets[i] = -1
+				return offsets
+			}
+		}
+		return offsets
+	}
+	return offsets
+}
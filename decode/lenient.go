@@ -0,0 +1,190 @@
+package decode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+)
+
+var (
+	// ErrUnknownCellType is reported for cells whose type is not defined in the notebook's schema.
+	ErrUnknownCellType = errors.New("unknown cell type")
+
+	// ErrUnknownOutputType is reported for outputs whose type is not defined in the notebook's schema.
+	ErrUnknownOutputType = errors.New("unknown output type")
+
+	// ErrMissingVersion is returned for notebooks which do not declare their nbformat version.
+	ErrMissingVersion = errors.New("missing nbformat version")
+)
+
+// WithLenient decodes notebooks which do not fully conform to their schema, recording warnings in the report.
+//
+// In lenient mode cells and outputs of unknown types are decoded as *common.Unrecognized,
+// a missing "nbformat_minor" is tolerated, and notebooks with an unknown minor version are decoded
+// with the decoder registered for the nearest minor version of the same major version.
+// The report may be nil if the warnings are not needed.
+func WithLenient(report *Report) Option {
+	return func(cfg *Config) {
+		cfg.Lenient = true
+		cfg.Report = report
+	}
+}
+
+// Report collects warnings about the problems tolerated in lenient mode.
+// It is safe for concurrent use.
+type Report struct {
+	mu       sync.Mutex
+	warnings []error
+}
+
+// Warnings returns all reported warnings in the order they occurred.
+func (r *Report) Warnings() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.warnings...)
+}
+
+// add appends the warning to the report.
+func (r *Report) add(warning error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, warning)
+}
+
+// header is the notebook's declared version.
+type header struct {
+	major, minor       int
+	hasMajor, hasMinor bool
+}
+
+// decoder selects a decoder for the declared version and returns the version of the notebook.
+func (cfg Config) decoder(h header) (Decoder, schema.Version, error) {
+	ver := schema.Version{Major: h.major, Minor: h.minor}
+	switch {
+	case !h.hasMajor:
+		return nil, ver, fmt.Errorf("nbformat: %w", ErrMissingVersion)
+	case !h.hasMinor && !cfg.Lenient:
+		return nil, ver, fmt.Errorf("nbformat_minor: %w", ErrMissingVersion)
+	}
+
+	if h.hasMinor {
+		if d, ok := cfg.registry().Lookup(ver); ok {
+			return d, ver, nil
+		}
+	}
+	if !cfg.Lenient {
+		return nil, ver, fmt.Errorf("schema %s: %w", ver, ErrUnsupportedVersion)
+	}
+
+	target := ver
+	if !h.hasMinor {
+		// Without a minor version the latest decoder is the best guess.
+		target.Minor = int(^uint(0) >> 1)
+	}
+	d, nearest, ok := cfg.registry().nearest(target)
+	if !ok {
+		return nil, ver, fmt.Errorf("schema %s: %w", ver, ErrUnsupportedVersion)
+	}
+	if !h.hasMinor {
+		cfg.Report.add(fmt.Errorf("nbformat_minor: %w, using %s", ErrMissingVersion, nearest))
+		return d, nearest, nil
+	}
+	cfg.Report.add(fmt.Errorf("schema %s: %w, using %s", ver, ErrUnsupportedVersion, nearest))
+	return d, ver, nil
+}
+
+// check reports cells and outputs of unknown types. In lenient mode they are recorded as warnings,
+// otherwise the first one is returned as an error. Errors are located within the cell's data.
+func (cfg Config) check(data []byte, cell schema.Cell) error {
+	var errs []error
+	if u, ok := cell.(*common.Unrecognized); ok {
+		errs = append(errs, &schema.CellError{
+			OutputIndex: -1,
+			Err:         &DecodeError{Err: fmt.Errorf("%w %q", ErrUnknownCellType, u.Kind)},
+		})
+	}
+	if code, ok := cell.(schema.Outputter); ok {
+		for i, out := range code.Outputs() {
+			u, ok := out.(*common.Unrecognized)
+			if !ok {
+				continue
+			}
+			errs = append(errs, &schema.CellError{
+				OutputIndex: i,
+				Err:         &DecodeError{Offset: outputOffset(data, i), Err: fmt.Errorf("%w %q", ErrUnknownOutputType, u.Kind)},
+			})
+			if !cfg.Lenient {
+				break
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if !cfg.Lenient {
+		return errs[0]
+	}
+	return &warnings{errs: errs}
+}
+
+// warnings are cell errors which should be reported without failing.
+type warnings struct {
+	errs []error
+}
+
+func (w *warnings) Error() string {
+	return fmt.Sprintf("%d warnings", len(w.errs))
+}
+
+// report locates and records warnings, or returns err if it is not a warning.
+// offset returns the offset of the i-th cell in the document.
+func (cfg Config) report(i int, data []byte, err error, offset func(int) int64, src []byte) error {
+	if err == nil {
+		return nil
+	}
+	w, ok := err.(*warnings)
+	if !ok {
+		return cellError(i, data, err, offset(i), src)
+	}
+	for _, err := range w.errs {
+		cfg.Report.add(cellError(i, data, err, offset(i), src))
+	}
+	return nil
+}
+
+// closer reports whether minor a is closer to the target than minor b.
+func closer(target, a, b int) bool {
+	da, db := distance(target, a), distance(target, b)
+	if da != db {
+		return da < db
+	}
+	return a < b
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// outputOffset reports the offset of the i-th output in the cell data.
+func outputOffset(data []byte, i int) (offset int64) {
+	offset = -1
+	walkOutputs(data, func(j int, _ json.RawMessage, off int64) bool {
+		if j == i {
+			offset = off
+			return false
+		}
+		return true
+	})
+	return offset
+}
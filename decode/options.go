@@ -0,0 +1,68 @@
+package decode
+
+// Config controls how notebooks are decoded.
+type Config struct {
+	// Registry provides decoders for the supported versions. The default registry is used if it is nil.
+	Registry *Registry
+
+	// Validator checks the raw document before it is decoded.
+	Validator Validator
+
+	// Lenient tolerates unknown cell and output types and version mismatches.
+	Lenient bool
+
+	// Report collects warnings in lenient mode.
+	Report *Report
+}
+
+type Option func(*Config)
+
+// WithRegistry uses decoders from the registry instead of the default one.
+func WithRegistry(r *Registry) Option {
+	return func(cfg *Config) {
+		cfg.Registry = r
+	}
+}
+
+// WithValidator validates the raw document before decoding it.
+// See package validate for the validator based on the official nbformat JSON schemas.
+func WithValidator(v Validator) Option {
+	return func(cfg *Config) {
+		cfg.Validator = v
+	}
+}
+
+// Validator checks that the document is a valid notebook.
+type Validator interface {
+	Validate(data []byte) error
+}
+
+// ValidatorFunc is an adapter to use ordinary functions as Validators.
+type ValidatorFunc func(data []byte) error
+
+func (f ValidatorFunc) Validate(data []byte) error {
+	return f(data)
+}
+
+func newConfig(opts []Option) Config {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// validate runs the validator, if one is configured.
+func (cfg Config) validate(data []byte) error {
+	if cfg.Validator == nil {
+		return nil
+	}
+	return cfg.Validator.Validate(data)
+}
+
+func (cfg Config) registry() *Registry {
+	if cfg.Registry == nil {
+		return defaultRegistry
+	}
+	return cfg.Registry
+}
@@ -0,0 +1,478 @@
+package decode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+)
+
+// Reader decodes a notebook from r, reading its cells lazily one at a time.
+// Unlike Bytes, it does not require the whole document to be in memory and
+// is better suited for large notebooks (e.g. ones with a lot of image outputs).
+//
+// Cells can only be decoded once the notebook's version and metadata are known.
+// Jupyter sorts the keys of the notebook object, so "cells" will usually precede both.
+// In that case Reader will skip the cells on the first pass and seek back to them
+// if r implements io.Seeker, or spool them to a temporary file otherwise.
+//
+// Errors are reported in the same way as by Bytes, except that the *DecodeError
+// only contains the offset at which the error occurred, counting from the current position of r.
+//
+// If a Validator is configured, the entire document is read into memory to be validated before decoding.
+//
+// The caller should Close the returned Stream to release the associated resources.
+func Reader(r io.Reader, opts ...Option) (*Stream, error) {
+	return New(opts...).Reader(r)
+}
+
+// Reader is like the package-level Reader, but uses the parser's configuration.
+func (p *Parser) Reader(r io.Reader) (*Stream, error) {
+	cfg := p.cfg
+	if cfg.Validator != nil {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("decode: reader: %w", err)
+		}
+		if err := cfg.validate(b); err != nil {
+			return nil, fmt.Errorf("decode: reader: %w", err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	s, err := newStream(r, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("decode: reader: %w", locate(err, 0, nil))
+	}
+	return s, nil
+}
+
+// Stream is a notebook whose cells are decoded on demand.
+// It implements schema.CellReader, which renderers should prefer to Cells().
+type Stream struct {
+	common.Notebook
+	cfg     Config
+	header  header
+	decoder Decoder
+	meta    schema.NotebookMetadata
+
+	scanner *cellScanner
+	spool   *os.File // spool holds cells which could not be decoded on the first pass.
+	index   int      // index of the next cell.
+	err     error
+}
+
+var _ schema.Notebook = (*Stream)(nil)
+var _ schema.CellReader = (*Stream)(nil)
+
+// ReadCell decodes the next cell in the notebook. It returns io.EOF once all cells have been read.
+func (s *Stream) ReadCell() (schema.Cell, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	raw, offset, err := s.scanner.Next()
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("decode: reader: %w", err)
+		}
+		s.err = err
+		return nil, err
+	}
+
+	i := s.index
+	s.index++
+	c, err := s.decoder.DecodeCell(raw, s.meta)
+	if err == nil {
+		err = s.cfg.check(raw, c)
+	}
+	located := func(int) int64 { return offset }
+	if err := s.cfg.report(i, raw, err, located, nil); err != nil {
+		s.err = fmt.Errorf("decode: reader: %s: %w", s.Version(), err)
+		return nil, s.err
+	}
+	return c, nil
+}
+
+// Cells reads all remaining cells into memory. Any error that occurs
+// in the process can be retrieved by calling Err.
+func (s *Stream) Cells() (cells []schema.Cell) {
+	for {
+		c, err := s.ReadCell()
+		if err != nil {
+			return
+		}
+		cells = append(cells, c)
+	}
+}
+
+// Err returns the first non-EOF error encountered while reading cells.
+func (s *Stream) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// Close releases the resources associated with the stream.
+// It does not close the underlying reader.
+func (s *Stream) Close() error {
+	if s.spool == nil {
+		return nil
+	}
+	f := s.spool
+	s.spool = nil
+	err := f.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// newStream reads the notebook header and positions the stream at the first cell.
+func newStream(r io.Reader, cfg Config) (_ *Stream, err error) {
+	s := &Stream{cfg: cfg}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	var base int64
+	rs, seekable := r.(io.ReadSeeker)
+	if seekable {
+		var seekErr error
+		base, seekErr = rs.Seek(0, io.SeekCurrent)
+		seekable = seekErr == nil
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var hasMeta bool
+	var cellsKey string
+	var cellsOffset int64
+
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "nbformat":
+			err = dec.Decode(&s.header.major)
+			s.header.hasMajor = true
+		case "nbformat_minor":
+			err = dec.Decode(&s.header.minor)
+			s.header.hasMinor = true
+		case "metadata":
+			err = dec.Decode(&s.Metadata)
+			hasMeta = true
+		case "cells", "worksheets":
+			cellsKey = key
+			if s.header.hasMajor && s.header.hasMinor && hasMeta {
+				// Header is complete, cells can be decoded directly from the input.
+				if err := s.init(); err != nil {
+					return nil, err
+				}
+				s.scanner, err = newCellScanner(dec, key, 0)
+				return s, err
+			}
+
+			if seekable {
+				cellsOffset = dec.InputOffset()
+				err = skipValue(dec)
+			} else {
+				err = s.spoolValue(dec)
+			}
+		default:
+			err = skipValue(dec)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", key, err)
+		}
+	}
+
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cellsKey == "":
+		s.scanner = &cellScanner{}
+		return s, nil
+	case seekable:
+		if _, err := rs.Seek(base+cellsOffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		br := bufio.NewReader(rs)
+		n, err := skipColon(br)
+		if err != nil {
+			return nil, err
+		}
+		s.scanner, err = newCellScanner(json.NewDecoder(br), cellsKey, cellsOffset+n)
+		return s, err
+	default:
+		if _, err := s.spool.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		// Spooled cells are reformatted, so their offsets do not match the ones in the document.
+		s.scanner, err = newCellScanner(json.NewDecoder(bufio.NewReader(s.spool)), cellsKey, -1)
+		return s, err
+	}
+}
+
+// init selects a decoder for the notebook version and decodes its metadata.
+func (s *Stream) init() error {
+	d, ver, err := s.cfg.decoder(s.header)
+	if err != nil {
+		return err
+	}
+	s.VersionMajor, s.VersionMinor = ver.Major, ver.Minor
+
+	meta, err := d.DecodeMeta(s.Metadata)
+	if err != nil {
+		return fmt.Errorf("%s: notebook metadata: %w", ver, err)
+	}
+
+	s.decoder = d
+	s.meta = meta
+	return nil
+}
+
+// spoolValue copies the next JSON value to a temporary file.
+func (s *Stream) spoolValue(dec *json.Decoder) error {
+	f, err := os.CreateTemp("", "nb-*.json")
+	if err != nil {
+		return err
+	}
+	s.spool = f
+
+	w := bufio.NewWriter(f)
+	if err := copyValue(dec, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// cellScanner reads raw cells one at a time from the "cells" array (v4.0 and later)
+// or from the "cells" of each worksheet in the "worksheets" array (prior to v4.0).
+type cellScanner struct {
+	dec        *json.Decoder
+	base       int64 // base is the offset of the decoder's input in the document, or -1 if unknown.
+	worksheets bool  // worksheets is true if cells are nested in "worksheets".
+
+	inWorksheet bool
+	inCells     bool
+	done        bool
+}
+
+// newCellScanner expects dec to be positioned at the start of the key's value.
+func newCellScanner(dec *json.Decoder, key string, base int64) (*cellScanner, error) {
+	s := cellScanner{dec: dec, base: base, worksheets: key == "worksheets"}
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, fmt.Errorf("%q: %w", key, s.locate(err))
+	}
+	s.inCells = !s.worksheets
+	return &s, nil
+}
+
+// Next returns raw JSON of the next cell and its offset in the document, or io.EOF if there are no more cells.
+func (s *cellScanner) Next() (json.RawMessage, int64, error) {
+	if s.dec == nil || s.done {
+		return nil, 0, io.EOF
+	}
+	raw, err := s.next()
+	if err != nil {
+		if err != io.EOF {
+			err = s.locate(err)
+		}
+		return nil, 0, err
+	}
+	if s.base < 0 {
+		return raw, -1, nil
+	}
+	return raw, s.base + s.dec.InputOffset() - int64(len(raw)), nil
+}
+
+// locate reports the error's offset in the document.
+func (s *cellScanner) locate(err error) error {
+	return locate(err, s.base, nil)
+}
+
+func (s *cellScanner) next() (json.RawMessage, error) {
+
+	for {
+		switch {
+		case s.inCells:
+			if s.dec.More() {
+				var raw json.RawMessage
+				if err := s.dec.Decode(&raw); err != nil {
+					return nil, err
+				}
+				return raw, nil
+			}
+			if err := expectDelim(s.dec, ']'); err != nil {
+				return nil, err
+			}
+			s.inCells = false
+			if !s.worksheets {
+				s.done = true
+				return nil, io.EOF
+			}
+
+		case s.inWorksheet:
+			if !s.dec.More() {
+				if err := expectDelim(s.dec, '}'); err != nil {
+					return nil, err
+				}
+				s.inWorksheet = false
+				continue
+			}
+
+			key, err := readKey(s.dec)
+			if err != nil {
+				return nil, err
+			}
+			if key != "cells" {
+				if err := skipValue(s.dec); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := expectDelim(s.dec, '['); err != nil {
+				return nil, err
+			}
+			s.inCells = true
+
+		default:
+			if !s.dec.More() {
+				s.done = true
+				return nil, io.EOF
+			}
+			if err := expectDelim(s.dec, '{'); err != nil {
+				return nil, err
+			}
+			s.inWorksheet = true
+		}
+	}
+}
+
+// expectDelim reads the next token and checks that it is the expected delimiter.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// readKey reads the next object key.
+func readKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected object key, got %v", tok)
+	}
+	return key, nil
+}
+
+// skipValue discards the next JSON value token by token,
+// so that at most one string is held in memory at a time.
+func skipValue(dec *json.Decoder) error {
+	var depth int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// copyValue writes the next JSON value to w token by token.
+// The output is semantically equivalent to the input, but may differ in formatting.
+func copyValue(dec *json.Decoder, w *bufio.Writer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	open, ok := tok.(json.Delim)
+	if !ok {
+		b, err := json.Marshal(tok)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	w.WriteByte(byte(open))
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if open == '{' {
+			key, err := readKey(dec)
+			if err != nil {
+				return err
+			}
+			b, _ := json.Marshal(key)
+			w.Write(b)
+			w.WriteByte(':')
+		}
+		if err := copyValue(dec, w); err != nil {
+			return err
+		}
+	}
+
+	if tok, err = dec.Token(); err != nil {
+		return err
+	}
+	return w.WriteByte(byte(tok.(json.Delim)))
+}
+
+// skipColon advances r past the colon which separates an object key from its value
+// and reports the number of bytes read.
+func skipColon(r io.ByteReader) (n int64, err error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		n++
+		switch b {
+		case ':':
+			return n, nil
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		return n, errors.New("expected ':' after object key")
+	}
+}
@@ -0,0 +1,78 @@
+package decode
+
+import (
+	"sync"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// Registry maps schema versions to their decoders. It is safe for concurrent use.
+//
+// Decoders for the supported versions are registered in the default registry when
+// their packages (schema/v3, schema/v4) are imported. A separate registry allows
+// overriding some of them without affecting other users of the default registry:
+//
+//	reg := decode.DefaultRegistry().Clone()
+//	reg.Register(schema.Version{Major: 4, Minor: 5}, myDecoder)
+//	nb, err := decode.New(decode.WithRegistry(reg)).Bytes(b)
+type Registry struct {
+	mu       sync.RWMutex
+	decoders map[schema.Version]Decoder
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry used by RegisterDecoder and, unless configured otherwise, by Bytes and Reader.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{decoders: make(map[schema.Version]Decoder)}
+}
+
+// Register a decoder for the schema version, replacing the previous one.
+func (r *Registry) Register(v schema.Version, d Decoder) {
+	if d == nil {
+		panic("invalid nil decoder")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[v] = d
+}
+
+// Lookup returns the decoder registered for the schema version.
+func (r *Registry) Lookup(v schema.Version) (d Decoder, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok = r.decoders[v]
+	return
+}
+
+// Clone returns a copy of the registry. Changes to the copy do not affect the original.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := NewRegistry()
+	for v, d := range r.decoders {
+		c.decoders[v] = d
+	}
+	return c
+}
+
+// nearest finds a decoder for the closest minor version of the same major version,
+// preferring older minor versions to newer ones.
+func (r *Registry) nearest(v schema.Version) (d Decoder, nearest schema.Version, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for ver, dec := range r.decoders {
+		if ver.Major != v.Major {
+			continue
+		}
+		if !ok || closer(v.Minor, ver.Minor, nearest.Minor) {
+			d, nearest, ok = dec, ver, true
+		}
+	}
+	return
+}
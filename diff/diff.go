@@ -0,0 +1,343 @@
+// Package diff compares Jupyter notebooks cell by cell, in the spirit of [nbdime].
+//
+// Cells of the two notebooks are first matched with each other: cells with v4.5 ids are
+// matched by id and cells without one are matched by the similarity of their contents.
+// Matched cells are then compared line by line (source), by output type and mime-type (outputs),
+// and key by key (metadata):
+//
+//	d := diff.Notebooks(old, new)
+//	for _, c := range d.Cells {
+//		fmt.Println(c.Op, c.OldIndex, c.NewIndex)
+//	}
+//
+// The result can be rendered side by side with HTMLRenderer.
+//
+// [nbdime]: https://nbdime.readthedocs.io/en/latest/
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+)
+
+// Op describes how an element changed between the two versions.
+type Op int
+
+const (
+	Equal  Op = iota // element is present in both versions and is unchanged
+	Insert           // element is only present in the new version
+	Delete           // element is only present in the old version
+	Modify           // element is present in both versions and has changed
+)
+
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	case Modify:
+		return "modify"
+	}
+	return "equal"
+}
+
+// Notebook is a cell-level diff of two notebooks.
+type Notebook struct {
+	// Metadata is a line diff of the notebook metadata, formatted as indented JSON with sorted keys.
+	// It is empty if neither notebook implements schema.HasMetadata.
+	Metadata []Line
+
+	// Cells lists the cells of both notebooks in order. Deleted cells precede
+	// the inserted cells which replaced them.
+	Cells []Cell
+}
+
+// Changed reports whether the notebooks differ.
+func (d *Notebook) Changed() bool {
+	if changed(d.Metadata) {
+		return true
+	}
+	for i := range d.Cells {
+		if d.Cells[i].Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Cell describes changes to a single cell.
+type Cell struct {
+	Op Op
+
+	// Old and New are the two versions of the cell. Old is nil for inserted cells and New is nil for deleted cells.
+	Old, New schema.Cell
+
+	// OldIndex and NewIndex are the cell's positions in each notebook or -1 if the cell is absent from it.
+	OldIndex, NewIndex int
+
+	// Source is a line diff of the cell's source.
+	Source []Line
+
+	// Metadata is a line diff of the cell metadata, formatted as indented JSON with sorted keys.
+	Metadata []Line
+
+	// Outputs are the outputs of both versions of a code cell.
+	Outputs []Output
+}
+
+// Output describes changes to a single output of a code cell.
+// Outputs are matched by their output type and mime-type.
+type Output struct {
+	Op Op
+
+	// Old and New are the two versions of the output. Old is nil for inserted outputs and New is nil for deleted outputs.
+	Old, New schema.Cell
+
+	// Lines is a line diff of text-based outputs. It is nil for binary data,
+	// such as images, which can only be compared visually.
+	Lines []Line
+}
+
+// Line is a single line of text in a line diff. Lines are either Equal, Inserted or Deleted.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns a line diff of two texts. A trailing newline does not produce an empty line.
+func Lines(old, new string) []Line {
+	return diffLines(splitLines(old), splitLines(new))
+}
+
+type config struct {
+	threshold float64
+}
+
+// Option configures the diff.
+type Option func(*config)
+
+// WithThreshold sets the minimal similarity of the cells without ids, for them
+// to be considered two versions of the same cell rather than a deleted and an inserted one.
+// Similarity is a value between 0 (no common lines) and 1 (same lines). The default is 0.5.
+func WithThreshold(t float64) Option {
+	return func(cfg *config) {
+		cfg.threshold = t
+	}
+}
+
+// Notebooks compares two notebooks at the cell level.
+func Notebooks(old, new schema.Notebook, opts ...Option) *Notebook {
+	cfg := config{threshold: .5}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	d := Notebook{
+		Metadata: diffLines(metadataLines(old), metadataLines(new)),
+	}
+
+	a, b := cellsOf(old), cellsOf(new)
+	pairs := align(len(a), len(b), func(i, j int) float64 {
+		return cfg.score(a[i], b[j])
+	})
+	merge(len(a), len(b), pairs, func(i, j int) {
+		d.Cells = append(d.Cells, diffCell(a, b, i, j))
+	})
+	return &d
+}
+
+// cell caches the properties of a cell used for matching.
+type cell struct {
+	schema.Cell
+	id    string
+	lines []string
+	count map[string]int
+}
+
+func cellsOf(nb schema.Notebook) []cell {
+	if nb == nil {
+		return nil
+	}
+	var cells []cell
+	for _, c := range nb.Cells() {
+		cc := cell{Cell: c, lines: splitLines(string(c.Text())), count: make(map[string]int)}
+		if hasID, ok := c.(schema.HasID); ok {
+			cc.id = hasID.ID()
+		}
+		for _, l := range cc.lines {
+			cc.count[l]++
+		}
+		cells = append(cells, cc)
+	}
+	return cells
+}
+
+// score rates how likely it is that a and b are two versions of the same cell.
+// Cells which cannot be matched score 0.
+func (cfg *config) score(a, b cell) float64 {
+	if a.id != "" && b.id != "" {
+		if a.id != b.id {
+			return 0
+		}
+		return 2 + similarity(a, b)
+	}
+	if a.Type() != b.Type() {
+		return 0
+	}
+	if s := similarity(a, b); s >= cfg.threshold {
+		return 1 + s
+	}
+	return 0
+}
+
+// similarity is the Dice coefficient of the cells' lines.
+func similarity(a, b cell) float64 {
+	if len(a.lines)+len(b.lines) == 0 {
+		return 1
+	}
+	var common int
+	for l, n := range a.count {
+		if m := b.count[l]; m < n {
+			common += m
+		} else {
+			common += n
+		}
+	}
+	return 2 * float64(common) / float64(len(a.lines)+len(b.lines))
+}
+
+// diffCell compares a[i] and b[j]. A negative index means the cell is absent from that notebook.
+func diffCell(a, b []cell, i, j int) Cell {
+	c := Cell{OldIndex: i, NewIndex: j}
+	var oldLines, newLines []string
+	var oldOut, newOut []schema.Cell
+	var oldMeta, newMeta []string
+	if i >= 0 {
+		c.Old = a[i].Cell
+		oldLines, oldOut, oldMeta = a[i].lines, outputsOf(c.Old), metadataLines(c.Old)
+	}
+	if j >= 0 {
+		c.New = b[j].Cell
+		newLines, newOut, newMeta = b[j].lines, outputsOf(c.New), metadataLines(c.New)
+	}
+
+	c.Source = diffLines(oldLines, newLines)
+	c.Metadata = diffLines(oldMeta, newMeta)
+	c.Outputs = diffOutputs(oldOut, newOut)
+
+	switch {
+	case i < 0:
+		c.Op = Insert
+	case j < 0:
+		c.Op = Delete
+	case c.Old.Type() != c.New.Type() || changed(c.Source) || changed(c.Metadata):
+		c.Op = Modify
+	default:
+		for _, out := range c.Outputs {
+			if out.Op != Equal {
+				c.Op = Modify
+				break
+			}
+		}
+	}
+	return c
+}
+
+func outputsOf(c schema.Cell) []schema.Cell {
+	if out, ok := c.(schema.Outputter); ok {
+		return out.Outputs()
+	}
+	return nil
+}
+
+// diffOutputs matches outputs of the same type and mime-type, preferring identical ones.
+func diffOutputs(a, b []schema.Cell) (outs []Output) {
+	pairs := align(len(a), len(b), func(i, j int) float64 {
+		if a[i].Type() != b[j].Type() || a[i].MimeType() != b[j].MimeType() {
+			return 0
+		}
+		if bytes.Equal(a[i].Text(), b[j].Text()) {
+			return 2
+		}
+		return 1
+	})
+	merge(len(a), len(b), pairs, func(i, j int) {
+		var out Output
+		var old, new string
+		switch {
+		case i < 0:
+			out = Output{Op: Insert, New: b[j]}
+			new = string(b[j].Text())
+		case j < 0:
+			out = Output{Op: Delete, Old: a[i]}
+			old = string(a[i].Text())
+		default:
+			out = Output{Old: a[i], New: b[j]}
+			old, new = string(a[i].Text()), string(b[j].Text())
+			if old != new {
+				out.Op = Modify
+			}
+		}
+
+		c := out.New
+		if c == nil {
+			c = out.Old
+		}
+		if isText(c.MimeType()) {
+			out.Lines = Lines(old, new)
+		}
+		outs = append(outs, out)
+	})
+	return outs
+}
+
+// isText reports whether data of this mime-type can be compared line by line.
+func isText(mime string) bool {
+	switch mime {
+	case common.Stdout, common.Stderr, "application/json", "application/javascript", "application/x-latex":
+		return true
+	}
+	return strings.HasPrefix(mime, "text/") || strings.HasSuffix(mime, "+json")
+}
+
+// metadataLines formats the metadata of v as indented JSON with sorted keys,
+// so that reordering the keys does not produce a diff.
+func metadataLines(v interface{}) []string {
+	meta, ok := v.(schema.HasMetadata)
+	if !ok || len(meta.RawMetadata()) == 0 {
+		return nil
+	}
+
+	var obj interface{}
+	dec := json.NewDecoder(bytes.NewReader(meta.RawMetadata()))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return splitLines(string(meta.RawMetadata()))
+	}
+	if m, ok := obj.(map[string]interface{}); ok && len(m) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(obj); err != nil {
+		return splitLines(string(meta.RawMetadata()))
+	}
+	return splitLines(buf.String())
+}
+
+func changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
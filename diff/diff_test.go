@@ -0,0 +1,263 @@
+package diff_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/diff"
+	"github.com/bevzzz/nb/pkg/test"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+// v45 decodes a v4.5 notebook with the cells.
+func v45(t *testing.T, metadata string, cells ...string) schema.Notebook {
+	t.Helper()
+	nb, err := decode.Bytes([]byte(`{"metadata": ` + metadata + `, "nbformat": 4, "nbformat_minor": 5, "cells": [` + strings.Join(cells, ",") + `]}`))
+	require.NoError(t, err)
+	return nb
+}
+
+// ops lists the operation and the old and new indices of each cell.
+func ops(d *diff.Notebook) (got [][3]interface{}) {
+	for _, c := range d.Cells {
+		got = append(got, [3]interface{}{c.Op, c.OldIndex, c.NewIndex})
+	}
+	return
+}
+
+func TestNotebooks(t *testing.T) {
+	t.Run("cells are matched by id", func(t *testing.T) {
+		old := v45(t, `{}`,
+			`{"id": "a", "cell_type": "markdown", "metadata": {}, "source": "# Title"}`,
+			`{"id": "b", "cell_type": "markdown", "metadata": {}, "source": "same"}`,
+			`{"id": "c", "cell_type": "markdown", "metadata": {}, "source": "text"}`,
+		)
+		new := v45(t, `{}`,
+			`{"id": "a", "cell_type": "markdown", "metadata": {}, "source": "# New title"}`,
+			`{"id": "x", "cell_type": "markdown", "metadata": {}, "source": "same"}`,
+			`{"id": "c", "cell_type": "markdown", "metadata": {}, "source": "text"}`,
+		)
+
+		d := diff.Notebooks(old, new)
+
+		require.Equal(t, [][3]interface{}{
+			{diff.Modify, 0, 0},
+			{diff.Delete, 1, -1},
+			{diff.Insert, -1, 1},
+			{diff.Equal, 2, 2},
+		}, ops(d))
+		require.Equal(t, []diff.Line{
+			{Op: diff.Delete, Text: "# Title"},
+			{Op: diff.Insert, Text: "# New title"},
+		}, d.Cells[0].Source)
+		require.True(t, d.Changed())
+	})
+
+	t.Run("cells without ids are matched by similarity", func(t *testing.T) {
+		old := test.Notebook(
+			test.Markdown("intro"),
+			test.Markdown("a\nb\nc\nd"),
+			test.Markdown("removed"),
+		)
+		new := test.Notebook(
+			test.Markdown("added"),
+			test.Markdown("intro"),
+			test.Markdown("a\nb\nc\ne"),
+		)
+
+		d := diff.Notebooks(old, new)
+
+		require.Equal(t, [][3]interface{}{
+			{diff.Insert, -1, 0},
+			{diff.Equal, 0, 1},
+			{diff.Modify, 1, 2},
+			{diff.Delete, 2, -1},
+		}, ops(d))
+	})
+
+	t.Run("threshold", func(t *testing.T) {
+		old := test.Notebook(test.Markdown("a\nb\nc\nd"))
+		new := test.Notebook(test.Markdown("a\nb\nc\ne"))
+
+		d := diff.Notebooks(old, new, diff.WithThreshold(.9))
+
+		require.Equal(t, [][3]interface{}{
+			{diff.Delete, 0, -1},
+			{diff.Insert, -1, 0},
+		}, ops(d))
+	})
+
+	t.Run("cells of different types are not matched", func(t *testing.T) {
+		d := diff.Notebooks(
+			test.Notebook(test.Markdown("x")),
+			test.Notebook(test.Raw("x", common.PlainText)),
+		)
+
+		require.Equal(t, [][3]interface{}{
+			{diff.Delete, 0, -1},
+			{diff.Insert, -1, 0},
+		}, ops(d))
+	})
+
+	t.Run("outputs are matched by type and mime-type", func(t *testing.T) {
+		code := func(outs ...schema.Cell) schema.Cell {
+			return &test.CodeCell{Cell: test.Cell{CellType: schema.Code, Source: []byte("print(x)")}, Out: outs}
+		}
+		old := test.Notebook(code(
+			test.Stdout("1\n2\n"),
+			test.DisplayData("iVBOR", "image/png"),
+			test.ErrorOutput("boom"),
+		))
+		new := test.Notebook(code(
+			test.Stdout("1\n3\n"),
+			test.DisplayData("iVBOX", "image/png"),
+			test.DisplayData("<b>hi</b>", "text/html"),
+		))
+
+		d := diff.Notebooks(old, new)
+
+		require.Equal(t, [][3]interface{}{{diff.Modify, 0, 0}}, ops(d))
+		outs := d.Cells[0].Outputs
+		require.Len(t, outs, 4)
+
+		require.Equal(t, diff.Modify, outs[0].Op, "stdout")
+		require.Equal(t, []diff.Line{
+			{Op: diff.Equal, Text: "1"},
+			{Op: diff.Delete, Text: "2"},
+			{Op: diff.Insert, Text: "3"},
+		}, outs[0].Lines)
+
+		require.Equal(t, diff.Modify, outs[1].Op, "image")
+		require.Nil(t, outs[1].Lines, "images are not diffed line by line")
+
+		require.Equal(t, diff.Delete, outs[2].Op, "error")
+		require.Equal(t, diff.Insert, outs[3].Op, "html")
+		require.Equal(t, []diff.Line{{Op: diff.Insert, Text: "<b>hi</b>"}}, outs[3].Lines)
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		old := v45(t, `{"kernelspec": {"name": "python3"}, "a": 1}`,
+			`{"id": "a", "cell_type": "code", "metadata": {"tags": ["x"], "collapsed": true}, "source": "1", "execution_count": 1, "outputs": []}`,
+		)
+		new := v45(t, `{"a": 1, "kernelspec": {"name": "python3"}}`,
+			`{"id": "a", "cell_type": "code", "metadata": {"collapsed": true, "tags": ["y"]}, "source": "1", "execution_count": 1, "outputs": []}`,
+		)
+
+		d := diff.Notebooks(old, new)
+
+		require.Empty(t, changedLines(d.Metadata), "reordered keys")
+		require.Equal(t, [][3]interface{}{{diff.Modify, 0, 0}}, ops(d))
+		require.Equal(t, []diff.Line{
+			{Op: diff.Delete, Text: `    "x"`},
+			{Op: diff.Insert, Text: `    "y"`},
+		}, changedLines(d.Cells[0].Metadata))
+	})
+
+	t.Run("identical notebooks", func(t *testing.T) {
+		cell := `{"id": "a", "cell_type": "markdown", "metadata": {}, "source": "text"}`
+
+		d := diff.Notebooks(v45(t, `{}`, cell), v45(t, `{}`, cell))
+
+		require.False(t, d.Changed())
+	})
+}
+
+func changedLines(lines []diff.Line) (changed []diff.Line) {
+	for _, l := range lines {
+		if l.Op != diff.Equal {
+			changed = append(changed, l)
+		}
+	}
+	return
+}
+
+func TestLines(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		old, new string
+		want     []diff.Line
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "inserted",
+			new:  "a\nb\n",
+			want: []diff.Line{{Op: diff.Insert, Text: "a"}, {Op: diff.Insert, Text: "b"}},
+		},
+		{
+			name: "common prefix and suffix",
+			old:  "a\nb\nc\nd",
+			new:  "a\nx\nc\ny\nd",
+			want: []diff.Line{
+				{Op: diff.Equal, Text: "a"},
+				{Op: diff.Delete, Text: "b"},
+				{Op: diff.Insert, Text: "x"},
+				{Op: diff.Equal, Text: "c"},
+				{Op: diff.Insert, Text: "y"},
+				{Op: diff.Equal, Text: "d"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, diff.Lines(tt.old, tt.new))
+		})
+	}
+}
+
+func TestHTMLRenderer(t *testing.T) {
+	old := test.Notebook(
+		test.Markdown("same"),
+		test.Markdown("a\nb\nc\nd"),
+		test.Raw("old", common.PlainText),
+	)
+	new := test.Notebook(
+		test.Markdown("same"),
+		test.Markdown("a\nb\nc\n<e>"),
+		test.Raw("new", "text/html"),
+	)
+	var buf bytes.Buffer
+
+	err := diff.NewHTMLRenderer().Render(&buf, diff.Notebooks(old, new))
+	require.NoError(t, err)
+
+	got := buf.String()
+	require.True(t, strings.HasPrefix(got, `<div class="jp-Notebook">`), "wrapped in a notebook container")
+	require.Equal(t, 1, strings.Count(got, `class="jp-Notebook"`), "cells are not wrapped in a notebook container")
+	require.Contains(t, got, `<div class="nb-Diff-cell nb-Diff-equal" data-old-index="0" data-new-index="0">`)
+	require.Contains(t, got, `<div class="nb-Diff-cell nb-Diff-modify" data-old-index="1" data-new-index="1">`)
+	require.Contains(t, got, `<span class="nb-Diff-line nb-Diff-insert">+ &lt;e&gt;</span>`)
+	require.Contains(t, got, `<div class="nb-Diff-cell nb-Diff-insert" data-old-index="-1" data-new-index="2">`)
+	require.Contains(t, got, `<div class="nb-Diff-cell nb-Diff-delete" data-old-index="2" data-new-index="-1">`)
+	require.Equal(t, 1, strings.Count(got, "<pre>same</pre>"), "unchanged cells are rendered once")
+	require.Equal(t, 6, strings.Count(got, `<div class="nb-Diff-side nb-Diff-`), "changed cells are rendered side by side")
+}
+
+func TestHTMLRenderer_ids(t *testing.T) {
+	code := func(source string, n int) schema.Cell {
+		return &test.CodeCell{Cell: test.Cell{CellType: schema.Code, Source: []byte(source)}, TimesExecuted: n}
+	}
+	old := test.Notebook(code("a", 1), code("b", 2), code("c", 3))
+	new := test.Notebook(code("a", 1), code("x", 2), code("b", 3), code("c changed", 4))
+	var buf bytes.Buffer
+
+	err := diff.NewHTMLRenderer().Render(&buf, diff.Notebooks(old, new))
+	require.NoError(t, err)
+
+	got := buf.String()
+	var ids []string
+	for _, m := range regexp.MustCompile(` id="([^"]+)"`).FindAllStringSubmatch(got, -1) {
+		ids = append(ids, m[1])
+	}
+	require.Equal(t, []string{"cell-0", "new-cell-1", "cell-2", "old-cell-2", "new-cell-3"}, ids, "ids are unique")
+	require.Contains(t, got, `data-cell-index="3" data-cell-type="code" data-execution-count="4" id="new-cell-3"`)
+	require.Contains(t, got, "<a href=\"#old-cell-2\">In\u00a0[3]:</a>", "prompts link to their cell")
+	require.Contains(t, got, "<a href=\"#new-cell-3\">In\u00a0[4]:</a>", "prompts link to their cell")
+}
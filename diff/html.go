@@ -0,0 +1,209 @@
+package diff
+
+import (
+	"fmt"
+	stdhtml "html"
+	"io"
+
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+	"github.com/bevzzz/nb/schema"
+)
+
+// HTMLRenderer renders a notebook diff as HTML.
+//
+// Changed cells are shown side by side, old version on the left and new version on the right,
+// preceded by a line diff of their source and metadata. Both versions are rendered in full,
+// so that images and other rich outputs can be compared visually. Unchanged cells are only rendered once.
+//
+// Cells are rendered with html.Renderer and wrapped by html.Wrapper. Every cell keeps the index
+// it has in its notebook, and the ids of the old and new versions of changed cells are prefixed
+// with "old-" and "new-" respectively, so that the ids on the page are unique.
+// HTMLRenderer is safe for concurrent use if the configured cell renderers are.
+type HTMLRenderer struct {
+	wrapper *html.Wrapper
+	opts    []render.Option
+}
+
+// NewHTMLRenderer creates a new HTMLRenderer. The options are passed to the renderer
+// used for individual cells, so that it can be extended to support other cell types, e.g.:
+//
+//	diff.NewHTMLRenderer(render.WithCellRenderers(adapter.Goldmark(md.Convert)))
+func NewHTMLRenderer(opts ...render.Option) *HTMLRenderer {
+	return &HTMLRenderer{
+		wrapper: new(html.Wrapper),
+		opts:    opts,
+	}
+}
+
+// Render writes the diff to w.
+func (r *HTMLRenderer) Render(w io.Writer, d *Notebook) error {
+	err := r.wrapper.WrapAll(w, func(w io.Writer) error {
+		hw := htmlWriter{w: w}
+		hw.WriteString("<style>")
+		hw.WriteString(diffCSS)
+		hw.WriteString("</style>\n")
+		hw.WriteString("<div class=\"nb-Diff\">\n")
+		if changed(d.Metadata) {
+			hw.WriteString("<div class=\"nb-Diff-metadata\">\n")
+			hw.WriteLines(d.Metadata)
+			hw.WriteString("</div>\n")
+		}
+		if err := hw.Err(); err != nil {
+			return err
+		}
+
+		for i := range d.Cells {
+			if err := r.renderCell(w, &d.Cells[i]); err != nil {
+				return err
+			}
+		}
+		hw.WriteString("</div>\n")
+		return hw.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("diff: %w", err)
+	}
+	return nil
+}
+
+func (r *HTMLRenderer) renderCell(w io.Writer, c *Cell) error {
+	hw := htmlWriter{w: w}
+	hw.Printf("<div class=\"nb-Diff-cell nb-Diff-%s\" data-old-index=\"%d\" data-new-index=\"%d\">\n", c.Op, c.OldIndex, c.NewIndex)
+	if c.Op == Modify {
+		if changed(c.Source) {
+			hw.WriteString("<div class=\"nb-Diff-source\">\n")
+			hw.WriteLines(c.Source)
+			hw.WriteString("</div>\n")
+		}
+		if changed(c.Metadata) {
+			hw.WriteString("<div class=\"nb-Diff-metadata\">\n")
+			hw.WriteLines(c.Metadata)
+			hw.WriteString("</div>\n")
+		}
+	}
+	hw.WriteString("<div class=\"nb-Diff-sides\">\n")
+	if err := hw.Err(); err != nil {
+		return err
+	}
+
+	if c.Op == Equal {
+		if err := r.renderSide(w, "nb-Diff-side", "", c.NewIndex, c.New); err != nil {
+			return fmt.Errorf("cell %d: %w", c.NewIndex, err)
+		}
+	} else {
+		if err := r.renderSide(w, "nb-Diff-side nb-Diff-old", "old-", c.OldIndex, c.Old); err != nil {
+			return fmt.Errorf("old cell %d: %w", c.OldIndex, err)
+		}
+		if err := r.renderSide(w, "nb-Diff-side nb-Diff-new", "new-", c.NewIndex, c.New); err != nil {
+			return fmt.Errorf("new cell %d: %w", c.NewIndex, err)
+		}
+	}
+
+	hw.WriteString("</div>\n</div>\n")
+	return hw.Err()
+}
+
+// renderSide renders one version of the cell, which is the i-th cell in its notebook.
+// The ids of its elements are prefixed with prefix. A nil cell leaves an empty placeholder.
+func (r *HTMLRenderer) renderSide(w io.Writer, class, prefix string, i int, cell schema.Cell) error {
+	hw := htmlWriter{w: w}
+	hw.Printf("<div class=\"%s\">\n", class)
+	if err := hw.Err(); err != nil {
+		return err
+	}
+	if cell != nil {
+		// The cell is rendered as a notebook of its own, so the wrapper is given its index.
+		wr := cellWrapper{Wrapper: &html.Wrapper{Config: html.Config{IDPrefix: prefix}}, index: i}
+		cells := render.NewRenderer(render.WithCellRenderers(html.NewRenderer()))
+		cells.AddOptions(r.opts...)
+		cells.AddOptions(render.WithCellRenderers(wr))
+		if err := cells.Render(w, single{cell}); err != nil {
+			return err
+		}
+	}
+	hw.WriteString("</div>\n")
+	return hw.Err()
+}
+
+// cellWrapper wraps cells in the same HTML as html.Wrapper, but omits the notebook container,
+// as each cell is rendered separately within the diff. For the same reason, it uses the index
+// of the cell in its notebook rather than the one it is given by the renderer.
+type cellWrapper struct {
+	*html.Wrapper
+	index int
+}
+
+var _ render.IndexedWrapper = cellWrapper{}
+
+func (cw cellWrapper) WithIndex(int) render.CellWrapper {
+	return cw.Wrapper.WithIndex(cw.index)
+}
+
+func (cellWrapper) RegisterFuncs(render.RenderCellFuncRegistry) {}
+
+func (cellWrapper) WrapAll(w io.Writer, render func(io.Writer) error) error {
+	return render(w)
+}
+
+// single is a notebook with a single cell.
+type single [1]schema.Cell
+
+func (single) Version() (v schema.Version) { return }
+
+func (n single) Cells() []schema.Cell { return n[:] }
+
+// htmlWriter stops writing after the first error and reports it in Err.
+type htmlWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (hw *htmlWriter) WriteString(s string) {
+	if hw.err != nil {
+		return
+	}
+	_, hw.err = io.WriteString(hw.w, s)
+}
+
+func (hw *htmlWriter) Printf(format string, args ...interface{}) {
+	if hw.err != nil {
+		return
+	}
+	_, hw.err = fmt.Fprintf(hw.w, format, args...)
+}
+
+// WriteLines writes a line diff as preformatted text.
+func (hw *htmlWriter) WriteLines(lines []Line) {
+	hw.WriteString("<pre class=\"nb-Diff-lines\">")
+	for _, l := range lines {
+		marker := " "
+		switch l.Op {
+		case Insert:
+			marker = "+"
+		case Delete:
+			marker = "-"
+		}
+		hw.Printf("<span class=\"nb-Diff-line nb-Diff-%s\">%s %s</span>\n", l.Op, marker, stdhtml.EscapeString(l.Text))
+	}
+	hw.WriteString("</pre>\n")
+}
+
+func (hw *htmlWriter) Err() error {
+	return hw.err
+}
+
+const diffCSS = `
+.nb-Diff-cell { margin: 1em 0; border-left: 4px solid transparent; }
+.nb-Diff-cell.nb-Diff-insert { border-left-color: #2da44e; }
+.nb-Diff-cell.nb-Diff-delete { border-left-color: #cf222e; }
+.nb-Diff-cell.nb-Diff-modify { border-left-color: #bf8700; }
+.nb-Diff-sides { display: flex; gap: 1em; }
+.nb-Diff-side { flex: 1; min-width: 0; overflow-x: auto; }
+.nb-Diff-insert .nb-Diff-new { background: #e6ffec; }
+.nb-Diff-delete .nb-Diff-old { background: #ffebe9; }
+.nb-Diff-lines { margin: 0; }
+.nb-Diff-line { display: block; }
+.nb-Diff-line.nb-Diff-insert { background: #e6ffec; }
+.nb-Diff-line.nb-Diff-delete { background: #ffebe9; }
+`
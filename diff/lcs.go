@@ -0,0 +1,123 @@
+package diff
+
+import "strings"
+
+// maxTable limits the size of the dynamic programming tables.
+// Larger inputs are diffed after trimming their common prefix and suffix only.
+const maxTable = 1 << 22
+
+// align finds pairs (i, j) of matching elements of two sequences of lengths n and m
+// which preserve the order of both sequences and maximize the total score.
+// Elements with a score of 0 or less are never matched.
+func align(n, m int, score func(i, j int) float64) [][2]int {
+	if n == 0 || m == 0 || n*m > maxTable {
+		return nil
+	}
+
+	// best[i][j] is the highest total score for the suffixes starting at i and j.
+	w := m + 1
+	best := make([]float64, (n+1)*w)
+	scores := make([]float64, n*m)
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			s := score(i, j)
+			scores[i*m+j] = s
+
+			b := best[(i+1)*w+j]
+			if r := best[i*w+j+1]; r > b {
+				b = r
+			}
+			if s > 0 {
+				if d := s + best[(i+1)*w+j+1]; d > b {
+					b = d
+				}
+			}
+			best[i*w+j] = b
+		}
+	}
+
+	var pairs [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		switch s := scores[i*m+j]; {
+		case s > 0 && best[i*w+j] == s+best[(i+1)*w+j+1]:
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case best[i*w+j] == best[(i+1)*w+j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// merge walks two sequences of lengths n and m, calling fn for every matched pair
+// and with a negative index for the unmatched elements. Between two matches,
+// unmatched elements of the first sequence are visited before those of the second.
+func merge(n, m int, pairs [][2]int, fn func(i, j int)) {
+	var i, j int
+	for _, p := range append(pairs, [2]int{n, m}) {
+		for ; i < p[0]; i++ {
+			fn(i, -1)
+		}
+		for ; j < p[1]; j++ {
+			fn(-1, j)
+		}
+		if i < n && j < m {
+			fn(i, j)
+			i++
+			j++
+		}
+	}
+}
+
+// diffLines computes a line diff based on the longest common subsequence of lines.
+func diffLines(a, b []string) []Line {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b)-prefix-suffix)
+	for _, l := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: l})
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	pairs := align(len(ma), len(mb), func(i, j int) float64 {
+		if ma[i] == mb[j] {
+			return 1
+		}
+		return 0
+	})
+	merge(len(ma), len(mb), pairs, func(i, j int) {
+		switch {
+		case i < 0:
+			lines = append(lines, Line{Op: Insert, Text: mb[j]})
+		case j < 0:
+			lines = append(lines, Line{Op: Delete, Text: ma[i]})
+		default:
+			lines = append(lines, Line{Op: Equal, Text: ma[i]})
+		}
+	})
+
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: l})
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return lines
+}
+
+// splitLines splits the text into lines, ignoring the trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,311 @@
+// Package encode writes notebooks in the [nbformat v4.5] JSON format.
+//
+// Any schema.Notebook can be encoded, regardless of the version it was decoded from:
+// older notebooks are upgraded to v4.5 and cells without an id are assigned one.
+// Data which is not exposed by the schema interfaces is only preserved
+// for the types which make it available through the optional interfaces,
+// such as schema.HasID, schema.HasMetadata, and schema.HasAttachments.
+// Cells and outputs of unrecognized types are written back unchanged.
+//
+// The output follows the formatting of Jupyter, which makes the encoded
+// notebooks friendlier to version control.
+//
+// [nbformat v4.5]: https://github.com/jupyter/nbformat/blob/main/nbformat/v4/nbformat.v4.5.schema.json
+package encode
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v3 "github.com/bevzzz/nb/schema/v3"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+// Version is the nbformat version of the encoded notebooks.
+var Version = schema.Version{Major: 4, Minor: 5}
+
+// Bytes encodes the notebook.
+func Bytes(nb schema.Notebook) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, nb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write encodes the notebook to w.
+func Write(w io.Writer, nb schema.Notebook) error {
+	doc, err := notebook(nb)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return nil
+}
+
+// object is a JSON object. encoding/json writes its keys in alphabetical order, same as Jupyter.
+type object map[string]interface{}
+
+func notebook(nb schema.Notebook) (object, error) {
+	meta, err := metadata(nb)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	ids := make(map[string]bool)
+	cells := make([]interface{}, 0)
+	for i, c := range nb.Cells() {
+		obj, err := cell(c, i, ids)
+		if err != nil {
+			return nil, &schema.CellError{Index: i, ID: idOf(c), OutputIndex: -1, Err: err}
+		}
+		cells = append(cells, obj)
+	}
+
+	return object{
+		"cells":          cells,
+		"metadata":       meta,
+		"nbformat":       Version.Major,
+		"nbformat_minor": Version.Minor,
+	}, nil
+}
+
+func cell(c schema.Cell, i int, ids map[string]bool) (interface{}, error) {
+	if raw, ok := unrecognized(c); ok {
+		return raw, nil
+	}
+
+	meta, err := metadata(c)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	obj := object{
+		"id":       uniqueID(c, i, ids),
+		"metadata": meta,
+		"source":   multiline(c.Text()),
+	}
+
+	switch c.Type() {
+	case schema.Markdown:
+		obj["cell_type"] = "markdown"
+	case schema.Raw:
+		obj["cell_type"] = "raw"
+		if _, ok := c.(schema.HasMetadata); !ok && c.MimeType() != "" && c.MimeType() != common.PlainText {
+			obj["metadata"] = object{"format": c.MimeType()}
+		}
+	case schema.Code:
+		obj["cell_type"] = "code"
+		obj["execution_count"] = executionCount(c)
+		outputs := make([]interface{}, 0)
+		if outputter, ok := c.(schema.Outputter); ok {
+			for j, out := range outputter.Outputs() {
+				o, err := output(out)
+				if err != nil {
+					return nil, &schema.CellError{OutputIndex: j, Err: err}
+				}
+				outputs = append(outputs, o)
+			}
+		}
+		obj["outputs"] = outputs
+	default:
+		return nil, fmt.Errorf("cannot encode %s cell", c.Type())
+	}
+
+	if c.Type() != schema.Code {
+		if att, err := attachments(c); err != nil {
+			return nil, fmt.Errorf("attachments: %w", err)
+		} else if att != nil {
+			obj["attachments"] = att
+		}
+	}
+	return obj, nil
+}
+
+func output(out schema.Cell) (interface{}, error) {
+	if raw, ok := unrecognized(out); ok {
+		return raw, nil
+	}
+
+	switch out := out.(type) {
+	case *v4.ErrorOutput:
+		return errorOutput(out.ExceptionName, out.ExceptionValue, out.Traceback), nil
+	case *v3.ErrorOutput:
+		return errorOutput(out.ExceptionName, out.ExceptionValue, out.Traceback), nil
+	}
+
+	switch out.Type() {
+	case schema.Stream:
+		name := "stdout"
+		if out.MimeType() == common.Stderr {
+			name = "stderr"
+		}
+		return object{
+			"output_type": "stream",
+			"name":        name,
+			"text":        multiline(out.Text()),
+		}, nil
+	case schema.DisplayData, schema.ExecuteResult:
+		meta, err := metadata(out)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: %w", err)
+		}
+		obj := object{
+			"output_type": "display_data",
+			"data":        mimeBundle(out),
+			"metadata":    meta,
+		}
+		if out.Type() == schema.ExecuteResult {
+			obj["output_type"] = "execute_result"
+			obj["execution_count"] = executionCount(out)
+		}
+		return obj, nil
+	case schema.Error:
+		return errorOutput("", "", strings.Split(string(out.Text()), "\n")), nil
+	}
+	return nil, fmt.Errorf("cannot encode %s output", out.Type())
+}
+
+// unrecognized returns the original JSON of the cells and outputs of unrecognized types,
+// which common.Unrecognized reports as their text.
+func unrecognized(c schema.Cell) (json.RawMessage, bool) {
+	if c.Type() != schema.Unrecognized || c.MimeType() != common.UnrecognizedJSON || !json.Valid(c.Text()) {
+		return nil, false
+	}
+	return c.Text(), true
+}
+
+func errorOutput(name, value string, traceback []string) object {
+	if traceback == nil {
+		traceback = make([]string, 0)
+	}
+	return object{
+		"output_type": "error",
+		"ename":       name,
+		"evalue":      value,
+		"traceback":   traceback,
+	}
+}
+
+// bundle is implemented by mime-bundles which give access to all of their representations, e.g. common.MimeBundle.
+type bundle interface {
+	MimeTypes() []string
+	Raw(mime string) json.RawMessage
+}
+
+func mimeBundle(out schema.Cell) object {
+	data := make(object)
+	if mb, ok := out.(bundle); ok {
+		for _, mime := range mb.MimeTypes() {
+			data[mime] = mb.Raw(mime)
+		}
+		return data
+	}
+
+	data[out.MimeType()] = mimeData(out.MimeType(), out.Text())
+	if mb, ok := out.(schema.MimeBundle); ok && out.MimeType() != common.PlainText {
+		if txt := mb.PlainText(); txt != nil {
+			data[common.PlainText] = multiline(txt)
+		}
+	}
+	return data
+}
+
+// mimeData stores JSON data verbatim and text data as a multiline string.
+func mimeData(mime string, b []byte) interface{} {
+	if common.IsJSON(mime) && json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	return multiline(b)
+}
+
+func attachments(c schema.Cell) (interface{}, error) {
+	ha, ok := c.(schema.HasAttachments)
+	if !ok {
+		return nil, nil
+	}
+	// Attachments interface does not allow listing the files, so only those
+	// which can be marshaled directly, like v4.Attachments, are preserved.
+	att, ok := ha.Attachments().(v4.Attachments)
+	if !ok || len(att) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(att)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
+
+// metadata returns the raw metadata of v or an empty object.
+func metadata(v interface{}) (interface{}, error) {
+	if m, ok := v.(schema.HasMetadata); ok {
+		if raw := m.RawMetadata(); len(bytes.TrimSpace(raw)) > 0 && string(raw) != "null" {
+			if !json.Valid(raw) {
+				return nil, fmt.Errorf("invalid JSON")
+			}
+			return json.RawMessage(raw), nil
+		}
+	}
+	return make(object), nil
+}
+
+// executionCount returns nil for cells that have not been executed.
+func executionCount(c schema.Cell) interface{} {
+	if ex, ok := c.(schema.ExecutionCounter); ok && ex.ExecutionCount() > 0 {
+		return ex.ExecutionCount()
+	}
+	return nil
+}
+
+// multiline splits the text into lines, keeping the line endings.
+func multiline(b []byte) []string {
+	lines := make([]string, 0)
+	for s := string(b); s != ""; {
+		i := strings.IndexByte(s, '\n')
+		if i == -1 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+func idOf(c schema.Cell) string {
+	if hasID, ok := c.(schema.HasID); ok {
+		return hasID.ID()
+	}
+	return ""
+}
+
+// uniqueID returns the cell's id or derives one from its position and contents.
+// Duplicate ids are made unique by adding a numeric suffix.
+func uniqueID(c schema.Cell, i int, ids map[string]bool) string {
+	id := idOf(c)
+	if id == "" {
+		h := sha1.New()
+		fmt.Fprintf(h, "%d:", i)
+		h.Write(c.Text())
+		id = hex.EncodeToString(h.Sum(nil))[:8]
+	}
+	for base, n := id, 1; ids[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	ids[id] = true
+	return id
+}
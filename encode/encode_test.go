@@ -0,0 +1,140 @@
+package encode_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/pkg/test"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/validate"
+)
+
+func TestBytes(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		src := `{"metadata": {"kernelspec": {"name": "python3"}}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+			{"id": "md", "cell_type": "markdown", "metadata": {"tags": ["intro"]}, "source": ["# Title\n", "text"],
+				"attachments": {"a.png": {"image/png": "iVBOR"}}},
+			{"id": "raw", "cell_type": "raw", "metadata": {"format": "text/html"}, "source": ["<b>raw</b>"]},
+			{"id": "code", "cell_type": "code", "metadata": {}, "source": ["print(1)"], "execution_count": 3, "outputs": [
+				{"output_type": "stream", "name": "stderr", "text": ["warning\n"]},
+				{"output_type": "execute_result", "execution_count": 3, "metadata": {"isolated": true},
+					"data": {"text/plain": ["1"], "application/json": {"a": [1, 2]}}},
+				{"output_type": "error", "ename": "ValueError", "evalue": "bad", "traceback": ["line 1", "line 2"]},
+				{"output_type": "exotic", "payload": 42}
+			]},
+			{"id": "new", "cell_type": "exotic", "metadata": {}, "source": ""}
+		]}`
+		nb, err := decode.Bytes([]byte(src), decode.WithLenient(new(decode.Report)))
+		require.NoError(t, err)
+
+		got, err := encode.Bytes(nb)
+		require.NoError(t, err)
+
+		require.JSONEq(t, src, string(got))
+	})
+
+	t.Run("v3 notebook is upgraded", func(t *testing.T) {
+		nb, err := decode.Bytes([]byte(`{"metadata": {}, "nbformat": 3, "nbformat_minor": 0, "worksheets": [{"cells": [
+			{"cell_type": "heading", "level": 2, "source": "Title", "metadata": {}},
+			{"cell_type": "code", "language": "python", "input": "1", "prompt_number": 1, "outputs": [
+				{"output_type": "pyout", "prompt_number": 1, "text": "1"}
+			]}
+		]}]}`))
+		require.NoError(t, err)
+
+		got, err := encode.Bytes(nb)
+		require.NoError(t, err)
+
+		require.NoError(t, validate.Bytes(got))
+		var doc struct {
+			Minor int `json:"nbformat_minor"`
+			Cells []struct {
+				ID     string   `json:"id"`
+				Type   string   `json:"cell_type"`
+				Source []string `json:"source"`
+			} `json:"cells"`
+		}
+		require.NoError(t, json.Unmarshal(got, &doc))
+		require.Equal(t, 5, doc.Minor)
+		require.Len(t, doc.Cells, 2)
+		require.Equal(t, "markdown", doc.Cells[0].Type)
+		require.Equal(t, []string{"## Title"}, doc.Cells[0].Source)
+		require.NotEqual(t, doc.Cells[0].ID, doc.Cells[1].ID, "ids are assigned")
+	})
+
+	t.Run("schema interfaces", func(t *testing.T) {
+		nb := test.Notebook(
+			test.Raw("x", "text/latex"),
+			&test.CodeCell{
+				Cell: test.Cell{CellType: schema.Code, Source: []byte("a\nb\n")},
+				Out:  []schema.Cell{test.Stdout("hi"), test.ErrorOutput("boom"), test.DisplayData(`{"a": 1}`, "application/json")},
+			},
+		)
+
+		got, err := encode.Bytes(nb)
+		require.NoError(t, err)
+
+		require.NoError(t, validate.Bytes(got))
+		var doc struct {
+			Cells []map[string]json.RawMessage `json:"cells"`
+		}
+		require.NoError(t, json.Unmarshal(got, &doc))
+		require.JSONEq(t, `{"format": "text/latex"}`, string(doc.Cells[0]["metadata"]))
+		require.JSONEq(t, `["a\n", "b\n"]`, string(doc.Cells[1]["source"]))
+		require.JSONEq(t, `null`, string(doc.Cells[1]["execution_count"]))
+		require.JSONEq(t, `[
+			{"output_type": "stream", "name": "stdout", "text": ["hi"]},
+			{"output_type": "error", "ename": "", "evalue": "", "traceback": ["boom"]},
+			{"output_type": "display_data", "metadata": {}, "data": {"application/json": {"a": 1}}}
+		]`, string(doc.Cells[1]["outputs"]))
+	})
+
+	t.Run("duplicate ids are made unique", func(t *testing.T) {
+		nb, err := decode.Bytes([]byte(`{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+			{"id": "a", "cell_type": "markdown", "metadata": {}, "source": ""},
+			{"id": "a", "cell_type": "markdown", "metadata": {}, "source": ""}
+		]}`))
+		require.NoError(t, err)
+
+		got, err := encode.Bytes(nb)
+		require.NoError(t, err)
+
+		require.NoError(t, validate.Bytes(got))
+		require.Contains(t, string(got), `"id": "a-1"`)
+	})
+
+	t.Run("testdata", func(t *testing.T) {
+		b, err := os.ReadFile("../testdata/notebook.ipynb")
+		require.NoError(t, err)
+		nb, err := decode.Bytes(b)
+		require.NoError(t, err)
+
+		got, err := encode.Bytes(nb)
+		require.NoError(t, err)
+
+		require.NoError(t, validate.Bytes(got))
+		again, err := decode.Bytes(got)
+		require.NoError(t, err)
+		require.Equal(t, len(nb.Cells()), len(again.Cells()))
+		for i, c := range nb.Cells() {
+			require.Equal(t, c.Type(), again.Cells()[i].Type(), "cell %d", i)
+			require.Equal(t, string(c.Text()), string(again.Cells()[i].Text()), "cell %d", i)
+		}
+	})
+
+	t.Run("unsupported cell type", func(t *testing.T) {
+		_, err := encode.Bytes(test.Notebook(test.Markdown(""), &test.Cell{CellType: schema.Unrecognized, Mime: common.PlainText}))
+
+		var cerr *schema.CellError
+		require.ErrorAs(t, err, &cerr)
+		require.Equal(t, 1, cerr.Index)
+	})
+}
@@ -0,0 +1,422 @@
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+// Kernel executes code.
+type Kernel interface {
+	// Execute runs the code and collects its outputs. It returns ctx.Err() once ctx is done,
+	// in which case the kernel may still be busy and should be interrupted.
+	Execute(ctx context.Context, code string) (*Reply, error)
+
+	// Interrupt stops the code currently running in the kernel.
+	Interrupt() error
+
+	// Close shuts down the kernel and releases its resources.
+	Close() error
+}
+
+// Reply is the result of executing the code.
+type Reply struct {
+	// Status is "ok", "error", or "aborted".
+	Status string
+
+	ExecutionCount int
+
+	// Outputs collected from the kernel: streams, display data, execution results, and errors.
+	Outputs []schema.Cell
+
+	// Error describes the exception raised by the code if Status is "error".
+	Error *Error
+}
+
+// Error is an exception raised by the executed code.
+type Error struct {
+	Name      string   `json:"ename"`
+	Value     string   `json:"evalue"`
+	Traceback []string `json:"traceback"`
+}
+
+func (e *Error) Error() string {
+	return e.Name + ": " + e.Value
+}
+
+// Client speaks the Jupyter messaging protocol with a kernel over its shell, iopub, and control channels.
+// Client is safe for concurrent use, but the kernel executes requests one at a time.
+type Client struct {
+	key     []byte
+	session string
+
+	shell, iopub, control Socket
+
+	mu      sync.Mutex // guards pending
+	pending map[string]*request
+
+	done   chan struct{}
+	closed sync.Once
+}
+
+var _ Kernel = (*Client)(nil)
+
+// request collects messages sent in response to a request.
+type request struct {
+	reply  chan *Message // shell reply
+	iopub  chan *Message // iopub messages with the request as the parent
+	status chan struct{} // closed once the kernel reports to be idle
+	idle   sync.Once
+	done   chan struct{} // closed once the request is released
+}
+
+// NewClient creates a client for a kernel. Messages are signed with the key.
+// Control socket is optional; without it, Interrupt is not supported.
+func NewClient(key []byte, shell, iopub, control Socket) *Client {
+	c := &Client{
+		key:     key,
+		session: newID(),
+		shell:   shell,
+		iopub:   iopub,
+		control: control,
+		pending: make(map[string]*request),
+		done:    make(chan struct{}),
+	}
+	go c.listen(shell, func(r *request, m *Message) {
+		select {
+		case r.reply <- m:
+		default:
+		}
+	})
+	go c.listen(iopub, func(r *request, m *Message) {
+		if m.Header.MsgType == "status" {
+			var st struct {
+				State string `json:"execution_state"`
+			}
+			if json.Unmarshal(m.Content, &st) == nil && st.State == "idle" {
+				r.idle.Do(func() { close(r.status) })
+			}
+			return
+		}
+		select {
+		case r.iopub <- m:
+		case <-r.done:
+		case <-c.done:
+		}
+	})
+	if control != nil {
+		go c.listen(control, func(*request, *Message) {})
+	}
+	return c
+}
+
+// listen dispatches messages from the socket to the pending requests.
+// Messages which fail verification or have no pending parent are dropped.
+func (c *Client) listen(s Socket, dispatch func(*request, *Message)) {
+	for {
+		frames, err := s.Recv()
+		if err != nil {
+			c.Close()
+			return
+		}
+		m, err := DecodeMessage(frames, c.key)
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		r := c.pending[m.ParentHeader.MsgID]
+		c.mu.Unlock()
+		if r != nil {
+			dispatch(r, m)
+		}
+	}
+}
+
+// send sends a request on the shell channel and registers it for replies.
+func (c *Client) send(msgType string, content interface{}) (*request, func(), error) {
+	m, err := NewMessage(msgType, c.session, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	frames, err := m.Encode(c.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &request{
+		reply:  make(chan *Message, 1),
+		iopub:  make(chan *Message, 64),
+		status: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	id := m.Header.MsgID
+	c.mu.Lock()
+	c.pending[id] = r
+	c.mu.Unlock()
+	release := func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		close(r.done)
+	}
+
+	if err := c.shell.Send(frames); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("%s: %w", msgType, err)
+	}
+	return r, release, nil
+}
+
+// WaitReady blocks until the kernel answers a kernel_info_request on both shell and iopub channels.
+// The request is repeated, as messages published before the iopub subscription is established are lost.
+func (c *Client) WaitReady(ctx context.Context) error {
+	for {
+		r, release, err := c.send("kernel_info_request", struct{}{})
+		if err != nil {
+			return err
+		}
+		ok, err := c.awaitInfo(ctx, r)
+		release()
+		if ok || err != nil {
+			return err
+		}
+	}
+}
+
+// awaitInfo waits for the kernel_info_reply and the idle status, giving up after a short while.
+func (c *Client) awaitInfo(ctx context.Context, r *request) (bool, error) {
+	timer := time.NewTimer(500 * time.Millisecond)
+	defer timer.Stop()
+
+	var replied, idle bool
+	for !replied || !idle {
+		select {
+		case <-r.reply:
+			replied = true
+		case <-r.status:
+			idle = true
+			r.status = nil
+		case <-timer.C:
+			return false, nil
+		case <-c.done:
+			return false, errClosed
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	return true, nil
+}
+
+// Execute sends an execute_request and collects the outputs until the kernel becomes idle.
+func (c *Client) Execute(ctx context.Context, code string) (*Reply, error) {
+	r, release, err := c.send("execute_request", map[string]interface{}{
+		"code":             code,
+		"silent":           false,
+		"store_history":    true,
+		"user_expressions": map[string]interface{}{},
+		"allow_stdin":      false,
+		"stop_on_error":    false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var reply Reply
+	var out outputs
+	var replied, idle bool
+	for !replied || !idle {
+		select {
+		case m := <-r.iopub:
+			if err := out.collect(m); err != nil {
+				return nil, err
+			}
+		case m := <-r.reply:
+			replied = true
+			var content struct {
+				Status         string `json:"status"`
+				ExecutionCount int    `json:"execution_count"`
+				Error
+			}
+			if err := json.Unmarshal(m.Content, &content); err != nil {
+				return nil, fmt.Errorf("execute_reply: %w", err)
+			}
+			reply.Status, reply.ExecutionCount = content.Status, content.ExecutionCount
+			if content.Status == "error" {
+				e := content.Error
+				reply.Error = &e
+			}
+		case <-r.status:
+			idle = true
+			r.status = nil // closed channel would always be ready
+		case <-c.done:
+			return nil, errClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Collect the messages which were dispatched before the status, but not received yet.
+	for drained := false; !drained; {
+		select {
+		case m := <-r.iopub:
+			if err := out.collect(m); err != nil {
+				return nil, err
+			}
+		default:
+			drained = true
+		}
+	}
+	reply.Outputs = out.cells
+	return &reply, nil
+}
+
+// Interrupt sends an interrupt_request on the control channel.
+func (c *Client) Interrupt() error {
+	return c.sendControl("interrupt_request")
+}
+
+// Shutdown asks the kernel to shut down.
+func (c *Client) Shutdown() error {
+	return c.sendControl("shutdown_request")
+}
+
+func (c *Client) sendControl(msgType string) error {
+	if c.control == nil {
+		return fmt.Errorf("%s: no control channel", msgType)
+	}
+	var content interface{} = struct{}{}
+	if msgType == "shutdown_request" {
+		content = map[string]bool{"restart": false}
+	}
+	m, err := NewMessage(msgType, c.session, content)
+	if err != nil {
+		return err
+	}
+	frames, err := m.Encode(c.key)
+	if err != nil {
+		return err
+	}
+	return c.control.Send(frames)
+}
+
+// Close closes the client's sockets.
+func (c *Client) Close() error {
+	c.closed.Do(func() {
+		close(c.done)
+		c.shell.Close()
+		c.iopub.Close()
+		if c.control != nil {
+			c.control.Close()
+		}
+	})
+	return nil
+}
+
+var errClosed = fmt.Errorf("kernel connection closed")
+
+// outputs converts iopub messages into cell outputs.
+type outputs struct {
+	cells []schema.Cell
+
+	// clear is set by clear_output with wait=true to clear the outputs once the next one arrives.
+	clear bool
+}
+
+func (o *outputs) collect(m *Message) error {
+	var content struct {
+		Name           string                 `json:"name"`
+		Text           string                 `json:"text"`
+		Data           map[string]interface{} `json:"data"`
+		Metadata       json.RawMessage        `json:"metadata"`
+		ExecutionCount int                    `json:"execution_count"`
+		Wait           bool                   `json:"wait"`
+		Error
+	}
+	switch m.Header.MsgType {
+	case "stream", "display_data", "execute_result", "error", "clear_output":
+		if err := json.Unmarshal(m.Content, &content); err != nil {
+			return fmt.Errorf("%s: %w", m.Header.MsgType, err)
+		}
+	default:
+		return nil
+	}
+
+	if m.Header.MsgType == "clear_output" {
+		if content.Wait {
+			o.clear = true
+		} else {
+			o.cells = nil
+		}
+		return nil
+	}
+	if o.clear {
+		o.cells, o.clear = nil, false
+	}
+
+	switch m.Header.MsgType {
+	case "stream":
+		// Consecutive writes to the same stream are merged, like Jupyter does.
+		if n := len(o.cells); n > 0 {
+			if last, ok := o.cells[n-1].(*v4.StreamOutput); ok && last.Target == content.Name {
+				last.Source = append(last.Source, content.Text)
+				return nil
+			}
+		}
+		o.cells = append(o.cells, &v4.StreamOutput{Target: content.Name, Source: common.MultilineString{content.Text}})
+	case "display_data", "execute_result":
+		mb, err := mimeBundle(content.Data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Header.MsgType, err)
+		}
+		meta := content.Metadata
+		if len(meta) == 0 {
+			meta = json.RawMessage("{}")
+		}
+		dd := v4.DisplayDataOutput{MimeBundle: mb, Metadata: meta}
+		if m.Header.MsgType == "display_data" {
+			o.cells = append(o.cells, &dd)
+		} else {
+			o.cells = append(o.cells, &v4.ExecuteResultOutput{DisplayDataOutput: dd, TimesExecuted: content.ExecutionCount})
+		}
+	case "error":
+		o.cells = append(o.cells, &v4.ErrorOutput{
+			ExceptionName:  content.Name,
+			ExceptionValue: content.Value,
+			Traceback:      content.Traceback,
+		})
+	}
+	return nil
+}
+
+// mimeBundle stores text data as JSON strings and JSON data verbatim.
+func mimeBundle(data map[string]interface{}) (common.MimeBundle, error) {
+	mb := make(common.MimeBundle, len(data))
+	for mime, v := range data {
+		if s, ok := v.(string); ok && !common.IsJSON(mime) {
+			v = splitLines(s)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		mb[mime] = b
+	}
+	return mb, nil
+}
+
+// splitLines splits the text into lines, keeping the line endings.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
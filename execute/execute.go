@@ -0,0 +1,269 @@
+// Package execute runs the code cells of a notebook in a Jupyter kernel and collects their outputs.
+//
+// Kernels are started from the installed kernelspecs (see FindKernelSpec) and are driven with
+// the Jupyter messaging protocol over ZeroMQ, implemented natively by the package, so neither
+// Jupyter nor libzmq need to be installed to execute a notebook. Any other Kernel implementation
+// can be plugged in with WithKernel.
+//
+// Code cells are executed one at a time in the order they appear in the notebook.
+// Each executed cell is replaced with a new code cell carrying the outputs and execution count
+// reported by the kernel; other cells are copied unchanged. The new cells have the same nbformat version
+// as the notebook, so executed v3 notebooks contain v3 code cells. The result can be written with package encode.
+package execute
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v3 "github.com/bevzzz/nb/schema/v3"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+// ErrTimeout is returned if a cell does not finish executing within the timeout.
+var ErrTimeout = errors.New("cell execution timed out")
+
+// DefaultKernel is used for notebooks which do not specify their kernelspec.
+const DefaultKernel = "python3"
+
+// AllowErrorsTag in the cell's metadata tags allows that cell to raise an exception.
+const AllowErrorsTag = "raises-exception"
+
+// StartFunc starts a kernel by its kernelspec name.
+type StartFunc func(ctx context.Context, name string) (Kernel, error)
+
+type config struct {
+	timeout        time.Duration
+	startupTimeout time.Duration
+	allowErrors    bool
+	kernelName     string
+	start          StartFunc
+	stderr         io.Writer
+}
+
+// Option configures the execution.
+type Option func(*config)
+
+// WithTimeout limits the time each cell may run. Cells which run longer are interrupted
+// and the execution stops with ErrTimeout. By default, cells may run indefinitely.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithStartupTimeout limits the time it takes the kernel to start. The default is 1 minute.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.startupTimeout = d
+	}
+}
+
+// WithAllowErrors continues the execution after a cell raises an exception.
+// Without it, only the cells tagged with AllowErrorsTag may fail.
+func WithAllowErrors(allow bool) Option {
+	return func(cfg *config) {
+		cfg.allowErrors = allow
+	}
+}
+
+// WithKernelName overrides the kernelspec name from the notebook's metadata.
+func WithKernelName(name string) Option {
+	return func(cfg *config) {
+		cfg.kernelName = name
+	}
+}
+
+// WithKernel replaces the function which starts the kernel. The default starts a local kernel
+// from the kernelspec found with FindKernelSpec.
+func WithKernel(start StartFunc) Option {
+	return func(cfg *config) {
+		cfg.start = start
+	}
+}
+
+// WithStderr sets where the output of the kernel process is written. By default, it is discarded.
+func WithStderr(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.stderr = w
+	}
+}
+
+// Notebook is an executed notebook.
+type Notebook struct {
+	*schema.Snapshot
+}
+
+var _ schema.Notebook = (*Notebook)(nil)
+var _ schema.HasMetadata = (*Notebook)(nil)
+
+// Execute starts a kernel for the notebook and runs its code cells.
+//
+// If a cell raises an exception which is not allowed or times out, Execute stops and returns
+// the notebook executed so far along with a *schema.CellError wrapping the *Error or ErrTimeout.
+// The remaining cells are left unchanged.
+func Execute(ctx context.Context, nb schema.Notebook, opts ...Option) (*Notebook, error) {
+	cfg := config{startupTimeout: time.Minute}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.start == nil {
+		cfg.start = func(ctx context.Context, name string) (Kernel, error) {
+			spec, err := FindKernelSpec(name)
+			if err != nil {
+				return nil, err
+			}
+			return StartKernel(ctx, spec, cfg.stderr)
+		}
+	}
+
+	// Cells are read once and copied, so that the original notebook is left unchanged.
+	in, err := schema.ReadAll(nb)
+	if err != nil {
+		return nil, fmt.Errorf("execute: %w", err)
+	}
+	cells := append([]schema.Cell(nil), in.Cells()...)
+	res := Notebook{schema.NewSnapshot(in.Version(), in.RawMetadata(), cells)}
+	name := cfg.kernelName
+	if name == "" {
+		name = kernelName(res.RawMetadata())
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, cfg.startupTimeout)
+	k, err := cfg.start(startCtx, name)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("execute: %w", err)
+	}
+	defer k.Close()
+
+	for i, c := range cells {
+		if c.Type() != schema.Code || strings.TrimSpace(string(c.Text())) == "" {
+			continue
+		}
+		reply, err := run(ctx, k, string(c.Text()), cfg.timeout)
+		if err != nil {
+			return &res, cellError(i, c, err)
+		}
+		cells[i] = executed(c, res.Version(), reply)
+
+		if reply.Status == "error" && !cfg.allowErrors && !schema.HasTag(c, AllowErrorsTag) {
+			var err error = reply.Error
+			if reply.Error == nil {
+				err = errors.New("kernel reported an error")
+			}
+			return &res, cellError(i, c, err)
+		}
+	}
+	return &res, nil
+}
+
+// run executes the code, interrupting the kernel once the timeout expires.
+func run(ctx context.Context, k Kernel, code string, timeout time.Duration) (*Reply, error) {
+	cellCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		cellCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	reply, err := k.Execute(cellCtx, code)
+	if err == nil {
+		return reply, nil
+	}
+	if cellCtx.Err() != nil {
+		k.Interrupt()
+		if ctx.Err() == nil {
+			return nil, fmt.Errorf("%w after %s", ErrTimeout, timeout)
+		}
+	}
+	return nil, err
+}
+
+// executed copies the code cell, replacing its outputs and execution count with the reply.
+// The copy has the schema of the notebook's version, v4 for notebooks without one.
+func executed(c schema.Cell, v schema.Version, reply *Reply) schema.Cell {
+	if v.Major > 0 && v.Major < 4 {
+		return executedV3(c, reply)
+	}
+	code := v4.Code{
+		Source:        common.MultilineString(splitLines(string(c.Text()))),
+		TimesExecuted: reply.ExecutionCount,
+		Out:           make([]v4.Output, len(reply.Outputs)),
+	}
+	for i, out := range reply.Outputs {
+		code.Out[i] = v4.NewOutput(out)
+	}
+	if id, ok := c.(schema.HasID); ok {
+		code.CellID = id.ID()
+	}
+	if cc, ok := c.(schema.CodeCell); ok {
+		code.Lang = cc.Language()
+	}
+	if m, ok := c.(schema.HasMetadata); ok {
+		code.Meta = m.RawMetadata()
+	}
+	return &code
+}
+
+// executedV3 is like executed for notebooks decoded with package v3 (nbformat v1 to v3),
+// whose code cells have no ids or metadata.
+func executedV3(c schema.Cell, reply *Reply) *v3.Code {
+	code := v3.Code{
+		Source:        common.MultilineString(splitLines(string(c.Text()))),
+		TimesExecuted: reply.ExecutionCount,
+		Out:           make([]v3.Output, len(reply.Outputs)),
+	}
+	for i, out := range reply.Outputs {
+		code.Out[i] = v3.NewOutput(outputV3(out))
+	}
+	if cc, ok := c.(schema.CodeCell); ok {
+		code.Lang = cc.Language()
+	}
+	return &code
+}
+
+// outputV3 converts the outputs collected by the client to their v3 types.
+// Outputs of other types, e.g. ones reported by a custom Kernel, are returned as is.
+func outputV3(out schema.Cell) schema.Cell {
+	switch out := out.(type) {
+	case *v4.StreamOutput:
+		return &v3.StreamOutput{Target: out.Target, Source: out.Source}
+	case *v4.DisplayDataOutput:
+		return &v3.DisplayDataOutput{MimeBundle: out.MimeBundle, Metadata: out.Metadata}
+	case *v4.ExecuteResultOutput:
+		return &v3.ExecuteResultOutput{
+			DisplayDataOutput: v3.DisplayDataOutput{MimeBundle: out.MimeBundle, Metadata: out.Metadata},
+			TimesExecuted:     out.TimesExecuted,
+		}
+	case *v4.ErrorOutput:
+		return &v3.ErrorOutput{ExceptionName: out.ExceptionName, ExceptionValue: out.ExceptionValue, Traceback: out.Traceback}
+	}
+	return out
+}
+
+func cellError(i int, c schema.Cell, err error) error {
+	ce := schema.CellError{Index: i, OutputIndex: -1, Err: err}
+	if id, ok := c.(schema.HasID); ok {
+		ce.ID = id.ID()
+	}
+	return fmt.Errorf("execute: %w", &ce)
+}
+
+// kernelName reads the kernelspec name from the notebook metadata.
+func kernelName(meta []byte) string {
+	var m struct {
+		KernelSpec struct {
+			Name string `json:"name"`
+		} `json:"kernelspec"`
+	}
+	if len(meta) > 0 && json.Unmarshal(meta, &m) == nil && m.KernelSpec.Name != "" {
+		return m.KernelSpec.Name
+	}
+	return DefaultKernel
+}
@@ -0,0 +1,390 @@
+package execute_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/execute"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v3 "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/validate"
+)
+
+var key = []byte("secret")
+
+// fakeKernel is an in-process kernel for a tiny language, one statement per line:
+//
+//	print X    writes X to stdout
+//	display X  displays X as text/plain
+//	raise X    raises ValueError(X)
+//	sleep      blocks until interrupted
+//	X          evaluates to X
+type fakeKernel struct {
+	shell, iopub, control execute.Socket
+	interrupt             chan struct{}
+	count                 int
+}
+
+// startFake starts a fake kernel and connects a client to it.
+func startFake(t *testing.T) execute.StartFunc {
+	return func(ctx context.Context, name string) (execute.Kernel, error) {
+		require.Equal(t, "fake", name)
+
+		k := &fakeKernel{interrupt: make(chan struct{}, 1)}
+		var client [3]execute.Socket
+		for i, ch := range []struct {
+			server *execute.Socket
+			socket string
+			client string
+		}{
+			{&k.shell, execute.Router, execute.Dealer},
+			{&k.iopub, execute.Pub, execute.Sub},
+			{&k.control, execute.Router, execute.Dealer},
+		} {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			accepted := make(chan error)
+			go func() {
+				defer l.Close()
+				conn, err := l.Accept()
+				if err == nil {
+					*ch.server, err = execute.NewZMTP(conn, ch.socket)
+				}
+				accepted <- err
+			}()
+			client[i], err = execute.DialZMTP(ctx, l.Addr().String(), ch.client)
+			require.NoError(t, err)
+			require.NoError(t, <-accepted)
+		}
+		go k.serveShell(t)
+		go k.serveControl()
+
+		c := execute.NewClient(key, client[0], client[1], client[2])
+		if err := c.WaitReady(ctx); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+func (k *fakeKernel) send(s execute.Socket, parent *execute.Message, msgType string, content interface{}) {
+	m, _ := parent.Reply(msgType, content)
+	frames, _ := m.Encode(key)
+	s.Send(frames)
+}
+
+func (k *fakeKernel) publish(parent *execute.Message, msgType string, content interface{}) {
+	k.send(k.iopub, parent, msgType, content)
+}
+
+func (k *fakeKernel) serveControl() {
+	defer k.control.Close()
+	for {
+		frames, err := k.control.Recv()
+		if err != nil {
+			return
+		}
+		if m, err := execute.DecodeMessage(frames, key); err == nil && m.Header.MsgType == "interrupt_request" {
+			k.interrupt <- struct{}{}
+			k.send(k.control, m, "interrupt_reply", map[string]string{"status": "ok"})
+		}
+	}
+}
+
+func (k *fakeKernel) serveShell(t *testing.T) {
+	defer k.shell.Close()
+	defer k.iopub.Close()
+	for {
+		frames, err := k.shell.Recv()
+		if err != nil {
+			return
+		}
+		m, err := execute.DecodeMessage(frames, key)
+		if err != nil {
+			t.Errorf("fake kernel: %v", err)
+			return
+		}
+
+		k.publish(m, "status", map[string]string{"execution_state": "busy"})
+		switch m.Header.MsgType {
+		case "kernel_info_request":
+			k.send(k.shell, m, "kernel_info_reply", map[string]string{"status": "ok", "protocol_version": execute.ProtocolVersion})
+		case "execute_request":
+			var req struct {
+				Code string `json:"code"`
+			}
+			json.Unmarshal(m.Content, &req)
+			k.count++
+			k.send(k.shell, m, "execute_reply", k.execute(m, req.Code))
+		}
+		k.publish(m, "status", map[string]string{"execution_state": "idle"})
+	}
+}
+
+func (k *fakeKernel) execute(m *execute.Message, code string) map[string]interface{} {
+	raise := func(name, value string) map[string]interface{} {
+		e := map[string]interface{}{"ename": name, "evalue": value, "traceback": []string{name + ": " + value}}
+		k.publish(m, "error", e)
+		e["status"], e["execution_count"] = "error", k.count
+		return e
+	}
+	for _, line := range strings.Split(code, "\n") {
+		stmt, arg, _ := strings.Cut(line, " ")
+		switch stmt {
+		case "print":
+			k.publish(m, "stream", map[string]string{"name": "stdout", "text": arg + "\n"})
+		case "display":
+			k.publish(m, "display_data", map[string]interface{}{"data": map[string]string{"text/plain": arg}, "metadata": map[string]string{}})
+		case "raise":
+			return raise("ValueError", arg)
+		case "sleep":
+			<-k.interrupt
+			return raise("KeyboardInterrupt", "")
+		default:
+			k.publish(m, "execute_result", map[string]interface{}{"data": map[string]string{"text/plain": line}, "metadata": map[string]string{}, "execution_count": k.count})
+		}
+	}
+	return map[string]interface{}{"status": "ok", "execution_count": k.count}
+}
+
+// notebook decodes a v4.5 notebook with fake kernel's kernelspec and code cells.
+func notebook(t *testing.T, cells ...string) schema.Notebook {
+	t.Helper()
+	var js []string
+	for i, c := range cells {
+		b, _ := json.Marshal(c)
+		meta := "{}"
+		if strings.HasPrefix(c, "raise") && strings.HasSuffix(c, "allowed") {
+			meta = `{"tags": ["raises-exception"]}`
+		}
+		js = append(js, `{"id": "c`+string(rune('0'+i))+`", "cell_type": "code", "metadata": `+meta+`, "source": `+string(b)+`, "execution_count": null, "outputs": []}`)
+	}
+	nb, err := decode.Bytes([]byte(`{"metadata": {"kernelspec": {"name": "fake", "display_name": "Fake"}}, "nbformat": 4, "nbformat_minor": 5, "cells": [` + strings.Join(js, ",") + `]}`))
+	require.NoError(t, err)
+	return nb
+}
+
+// outputs describes the outputs of the cell as "mime-type: text".
+func outputs(c schema.Cell) (got []string) {
+	for _, out := range c.(schema.Outputter).Outputs() {
+		got = append(got, out.MimeType()+": "+string(out.Text()))
+	}
+	return
+}
+
+func TestExecute(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("collects outputs", func(t *testing.T) {
+		nb := notebook(t, "print a\nprint b\ndisplay c\n42", "  ", "1")
+
+		got, err := execute.Execute(ctx, nb, execute.WithKernel(startFake(t)))
+		require.NoError(t, err)
+
+		cells := got.Cells()
+		require.Equal(t, []string{
+			common.Stdout + ": a\nb\n",
+			"text/plain: c",
+			"text/plain: 42",
+		}, outputs(cells[0]))
+		require.Equal(t, 1, cells[0].(schema.ExecutionCounter).ExecutionCount())
+		require.Equal(t, "c0", cells[0].(schema.HasID).ID())
+		require.Equal(t, "print a\nprint b\ndisplay c\n42", string(cells[0].Text()))
+
+		require.Empty(t, outputs(cells[1]), "blank cell is not executed")
+		require.Equal(t, 2, cells[2].(schema.ExecutionCounter).ExecutionCount())
+
+		b, err := encode.Bytes(got)
+		require.NoError(t, err)
+		require.NoError(t, validate.Bytes(b))
+		require.Contains(t, string(b), `"name": "fake"`, "notebook metadata is kept")
+	})
+
+	t.Run("stops on error", func(t *testing.T) {
+		nb := notebook(t, "1", "raise oops", "2")
+
+		got, err := execute.Execute(ctx, nb, execute.WithKernel(startFake(t)))
+
+		var ce *schema.CellError
+		require.True(t, errors.As(err, &ce), "error: %v", err)
+		require.Equal(t, 1, ce.Index)
+		require.Equal(t, "c1", ce.ID)
+		var e *execute.Error
+		require.True(t, errors.As(err, &e))
+		require.Equal(t, "ValueError", e.Name)
+		require.Equal(t, "oops", e.Value)
+
+		require.NotNil(t, got, "partially executed notebook")
+		require.Equal(t, []string{common.Stderr + ": ValueError: oops"}, outputs(got.Cells()[1]))
+		require.Empty(t, outputs(got.Cells()[2]))
+	})
+
+	t.Run("allow errors", func(t *testing.T) {
+		nb := notebook(t, "raise oops", "2")
+
+		got, err := execute.Execute(ctx, nb, execute.WithKernel(startFake(t)), execute.WithAllowErrors(true))
+		require.NoError(t, err)
+		require.Equal(t, []string{"text/plain: 2"}, outputs(got.Cells()[1]))
+	})
+
+	t.Run("raises-exception tag", func(t *testing.T) {
+		nb := notebook(t, "raise allowed", "2")
+
+		got, err := execute.Execute(ctx, nb, execute.WithKernel(startFake(t)))
+		require.NoError(t, err)
+		require.Equal(t, []string{"text/plain: 2"}, outputs(got.Cells()[1]))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		nb := notebook(t, "print before", "sleep", "2")
+
+		got, err := execute.Execute(ctx, nb, execute.WithKernel(startFake(t)), execute.WithTimeout(100*time.Millisecond))
+
+		require.True(t, errors.Is(err, execute.ErrTimeout), "error: %v", err)
+		var ce *schema.CellError
+		require.True(t, errors.As(err, &ce))
+		require.Equal(t, 1, ce.Index)
+		require.Equal(t, []string{common.Stdout + ": before\n"}, outputs(got.Cells()[0]))
+	})
+
+	t.Run("kernel name option", func(t *testing.T) {
+		nb := notebook(t)
+		start := func(ctx context.Context, name string) (execute.Kernel, error) {
+			return nil, errors.New(name)
+		}
+
+		_, err := execute.Execute(ctx, nb, execute.WithKernel(start), execute.WithKernelName("julia"))
+		require.EqualError(t, err, "execute: julia")
+	})
+
+	t.Run("v3 notebook", func(t *testing.T) {
+		nb, err := decode.Bytes([]byte(`{"metadata": {}, "nbformat": 3, "nbformat_minor": 0, "worksheets": [{"cells": [
+			{"cell_type": "code", "language": "python", "input": "print a\ndisplay c\n42\nraise oops", "outputs": []}
+		]}]}`))
+		require.NoError(t, err)
+
+		got, err := execute.Execute(ctx, nb, execute.WithKernel(startFake(t)), execute.WithKernelName("fake"), execute.WithAllowErrors(true))
+		require.NoError(t, err)
+
+		require.Equal(t, nb.Version(), got.Version())
+		code, ok := got.Cells()[0].(*v3.Code)
+		require.True(t, ok, "cell should keep the version of the notebook, got %T", got.Cells()[0])
+		require.Equal(t, "python", code.Language())
+		require.Equal(t, 1, code.ExecutionCount())
+		want := []schema.Cell{&v3.StreamOutput{}, &v3.DisplayDataOutput{}, &v3.ExecuteResultOutput{}, &v3.ErrorOutput{}}
+		require.Len(t, code.Outputs(), len(want))
+		for i, out := range code.Outputs() {
+			require.IsType(t, want[i], out, "output %d", i)
+		}
+		require.Equal(t, []string{
+			common.Stdout + ": a\n",
+			"text/plain: c",
+			"text/plain: 42",
+			common.Stderr + ": ValueError: oops",
+		}, outputs(code))
+
+		b, err := encode.Bytes(got)
+		require.NoError(t, err)
+		require.NoError(t, validate.Bytes(b))
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		s, err := decode.Reader(strings.NewReader(`{"metadata": {}, "nbformat": 4, "nbformat_minor": 4, "cells": [
+			{"cell_type": "code", "metadata": {}, "source": "1", "execution_count": null, "outputs": []},
+			{"cell_type": "code", "metadata": {}, "source": 1, "execution_count": null, "outputs": []}
+		]}`))
+		require.NoError(t, err)
+		defer s.Close()
+		start := func(ctx context.Context, name string) (execute.Kernel, error) {
+			t.Fatal("kernel should not be started")
+			return nil, nil
+		}
+
+		_, err = execute.Execute(ctx, s, execute.WithKernel(start))
+		require.ErrorContains(t, err, "execute: decode: reader: v4.4: cell 1")
+	})
+}
+
+func TestMessage(t *testing.T) {
+	m, err := execute.NewMessage("execute_request", "session", map[string]string{"code": strings.Repeat("x", 300)})
+	require.NoError(t, err)
+	reply, err := m.Reply("execute_reply", map[string]string{"status": "ok"})
+	require.NoError(t, err)
+
+	frames, err := reply.Encode(key)
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		got, err := execute.DecodeMessage(frames, key)
+		require.NoError(t, err)
+		require.Equal(t, reply.Header, got.Header)
+		require.Equal(t, m.Header, got.ParentHeader)
+		require.JSONEq(t, `{"status": "ok"}`, string(got.Content))
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		_, err := execute.DecodeMessage(frames, []byte("other"))
+		require.True(t, errors.Is(err, execute.ErrSignature))
+	})
+
+	t.Run("over zmtp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		received := make(chan [][]byte, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s, err := execute.NewZMTP(conn, execute.Router)
+			if err != nil {
+				return
+			}
+			defer s.Close()
+			got, _ := s.Recv()
+			received <- got
+		}()
+
+		s, err := execute.DialZMTP(context.Background(), l.Addr().String(), execute.Dealer)
+		require.NoError(t, err)
+		defer s.Close()
+		frames, err := m.Encode(key)
+		require.NoError(t, err)
+		require.NoError(t, s.Send(frames))
+
+		got, err := execute.DecodeMessage(<-received, key)
+		require.NoError(t, err)
+		require.Equal(t, m.Header, got.Header)
+	})
+}
+
+func TestFindKernelSpec(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("JUPYTER_PATH", dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "kernels", "fake"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kernels", "fake", "kernel.json"),
+		[]byte(`{"argv": ["fake", "-f", "{connection_file}"], "display_name": "Fake", "language": "fake"}`), 0o644))
+
+	spec, err := execute.FindKernelSpec("fake")
+	require.NoError(t, err)
+	require.Equal(t, "fake", spec.Name)
+	require.Equal(t, []string{"fake", "-f", "{connection_file}"}, spec.Argv)
+	require.Equal(t, "Fake", spec.DisplayName)
+
+	_, err = execute.FindKernelSpec("missing")
+	require.True(t, errors.Is(err, execute.ErrNoKernelSpec))
+}
@@ -0,0 +1,271 @@
+package execute
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ErrNoKernelSpec is returned if no kernelspec is installed for the kernel name.
+var ErrNoKernelSpec = errors.New("kernelspec not found")
+
+// KernelSpec describes how to start a kernel. It is read from the [kernel.json] file.
+//
+// [kernel.json]: https://jupyter-client.readthedocs.io/en/latest/kernels.html#kernel-specs
+type KernelSpec struct {
+	Name          string            `json:"-"`
+	Dir           string            `json:"-"` // resource directory containing kernel.json
+	Argv          []string          `json:"argv"`
+	DisplayName   string            `json:"display_name"`
+	Language      string            `json:"language"`
+	InterruptMode string            `json:"interrupt_mode"`
+	Env           map[string]string `json:"env"`
+}
+
+// FindKernelSpec looks up an installed kernelspec in the Jupyter data directories.
+func FindKernelSpec(name string) (*KernelSpec, error) {
+	for _, dir := range kernelDirs() {
+		path := filepath.Join(dir, name, "kernel.json")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var spec KernelSpec
+		if err := json.Unmarshal(b, &spec); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		spec.Name, spec.Dir = name, filepath.Dir(path)
+		return &spec, nil
+	}
+	return nil, fmt.Errorf("%q: %w", name, ErrNoKernelSpec)
+}
+
+// kernelDirs lists the directories searched for kernelspecs in the order of precedence.
+func kernelDirs() (dirs []string) {
+	var data []string
+	data = append(data, filepath.SplitList(os.Getenv("JUPYTER_PATH"))...)
+	if d := os.Getenv("JUPYTER_DATA_DIR"); d != "" {
+		data = append(data, d)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		switch runtime.GOOS {
+		case "darwin":
+			data = append(data, filepath.Join(home, "Library", "Jupyter"))
+		case "windows":
+			data = append(data, filepath.Join(os.Getenv("APPDATA"), "jupyter"))
+		default:
+			xdg := os.Getenv("XDG_DATA_HOME")
+			if xdg == "" {
+				xdg = filepath.Join(home, ".local", "share")
+			}
+			data = append(data, filepath.Join(xdg, "jupyter"))
+		}
+	}
+	if runtime.GOOS == "windows" {
+		data = append(data, filepath.Join(os.Getenv("PROGRAMDATA"), "jupyter"))
+	} else {
+		data = append(data, "/usr/local/share/jupyter", "/usr/share/jupyter")
+	}
+
+	for _, d := range data {
+		if d != "" {
+			dirs = append(dirs, filepath.Join(d, "kernels"))
+		}
+	}
+	return dirs
+}
+
+// connectionInfo is the content of the kernel's connection file.
+type connectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	StdinPort       int    `json:"stdin_port"`
+	ControlPort     int    `json:"control_port"`
+	HBPort          int    `json:"hb_port"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+	KernelName      string `json:"kernel_name"`
+}
+
+// localKernel is a kernel running in a child process.
+type localKernel struct {
+	*Client
+	cmd      *exec.Cmd
+	connFile string
+	signal   bool // interrupt with a signal rather than a message
+	exited   chan struct{}
+}
+
+// StartKernel starts a kernel from the kernelspec and waits until it is ready to execute code.
+// Kernel's output is written to stderr, which may be nil.
+func StartKernel(ctx context.Context, spec *KernelSpec, stderr io.Writer) (Kernel, error) {
+	ports, err := freePorts(5)
+	if err != nil {
+		return nil, fmt.Errorf("start kernel: %w", err)
+	}
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, fmt.Errorf("start kernel: %w", err)
+	}
+	info := connectionInfo{
+		Transport:       "tcp",
+		IP:              "127.0.0.1",
+		ShellPort:       ports[0],
+		IOPubPort:       ports[1],
+		StdinPort:       ports[2],
+		ControlPort:     ports[3],
+		HBPort:          ports[4],
+		Key:             hex.EncodeToString(key[:]),
+		SignatureScheme: "hmac-sha256",
+		KernelName:      spec.Name,
+	}
+
+	f, err := os.CreateTemp("", "kernel-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("start kernel: %w", err)
+	}
+	connFile := f.Name()
+	err = json.NewEncoder(f).Encode(info)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(connFile)
+		return nil, fmt.Errorf("start kernel: %w", err)
+	}
+
+	if len(spec.Argv) == 0 {
+		os.Remove(connFile)
+		return nil, fmt.Errorf("start kernel %q: empty argv", spec.Name)
+	}
+	argv := make([]string, len(spec.Argv))
+	for i, arg := range spec.Argv {
+		arg = strings.ReplaceAll(arg, "{connection_file}", connFile)
+		argv[i] = strings.ReplaceAll(arg, "{resource_dir}", spec.Dir)
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout, cmd.Stderr = stderr, stderr
+	if err := cmd.Start(); err != nil {
+		os.Remove(connFile)
+		return nil, fmt.Errorf("start kernel %q: %w", spec.Name, err)
+	}
+
+	k := &localKernel{
+		cmd:      cmd,
+		connFile: connFile,
+		signal:   spec.InterruptMode != "message",
+		exited:   make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(k.exited)
+	}()
+
+	if k.Client, err = k.connect(ctx, info); err != nil {
+		k.kill()
+		return nil, fmt.Errorf("start kernel %q: %w", spec.Name, err)
+	}
+	if err := k.Client.WaitReady(ctx); err != nil {
+		k.Close()
+		return nil, fmt.Errorf("start kernel %q: %w", spec.Name, err)
+	}
+	return k, nil
+}
+
+// connect dials the kernel's channels, retrying until the kernel starts listening.
+// Sockets dialed before a failure are closed.
+func (k *localKernel) connect(ctx context.Context, info connectionInfo) (_ *Client, err error) {
+	var sockets [3]Socket
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, s := range sockets {
+			if s != nil {
+				s.Close()
+			}
+		}
+	}()
+
+	for i, ch := range []struct {
+		port       int
+		socketType string
+	}{
+		{info.ShellPort, Dealer},
+		{info.IOPubPort, Sub},
+		{info.ControlPort, Dealer},
+	} {
+		addr := net.JoinHostPort(info.IP, fmt.Sprint(ch.port))
+		for {
+			s, err := DialZMTP(ctx, addr, ch.socketType)
+			if err == nil {
+				sockets[i] = s
+				break
+			}
+			select {
+			case <-k.exited:
+				return nil, errors.New("kernel exited")
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	return NewClient([]byte(info.Key), sockets[0], sockets[1], sockets[2]), nil
+}
+
+// Interrupt sends SIGINT to the kernel process, unless the kernelspec requests message-based interrupts.
+func (k *localKernel) Interrupt() error {
+	if k.signal && runtime.GOOS != "windows" {
+		return k.cmd.Process.Signal(os.Interrupt)
+	}
+	return k.Client.Interrupt()
+}
+
+// Close asks the kernel to shut down and kills it if it does not exit in time.
+func (k *localKernel) Close() error {
+	k.Client.Shutdown()
+	select {
+	case <-k.exited:
+	case <-time.After(5 * time.Second):
+		k.kill()
+	}
+	k.Client.Close()
+	return os.Remove(k.connFile)
+}
+
+func (k *localKernel) kill() {
+	k.cmd.Process.Kill()
+	<-k.exited
+	os.Remove(k.connFile)
+}
+
+// freePorts finds n available TCP ports on the loopback interface.
+func freePorts(n int) ([]int, error) {
+	ports := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer l.Close()
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
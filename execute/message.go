@@ -0,0 +1,169 @@
+package execute
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion is the version of the Jupyter messaging protocol implemented by the package.
+const ProtocolVersion = "5.3"
+
+// delimiter separates routing identities from the message frames.
+var delimiter = []byte("<IDS|MSG>")
+
+// ErrSignature is returned for messages with an invalid HMAC signature.
+var ErrSignature = errors.New("invalid message signature")
+
+// Header identifies a message in the [Jupyter messaging protocol].
+//
+// [Jupyter messaging protocol]: https://jupyter-client.readthedocs.io/en/latest/messaging.html
+type Header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// Message is a message exchanged with a kernel.
+type Message struct {
+	// Identities are the routing prefix of the message, used by the kernel's ROUTER sockets
+	// to address replies and by its PUB socket as the topic.
+	Identities [][]byte
+
+	Header Header
+
+	// ParentHeader is the header of the request this message replies to.
+	// It is zero for requests.
+	ParentHeader Header
+
+	Metadata map[string]interface{}
+	Content  json.RawMessage
+	Buffers  [][]byte
+}
+
+// NewMessage creates a new message of the type with a unique id.
+func NewMessage(msgType, session string, content interface{}) (*Message, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", msgType, err)
+	}
+	return &Message{
+		Header: Header{
+			MsgID:    newID(),
+			Session:  session,
+			Username: "nb",
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			MsgType:  msgType,
+			Version:  ProtocolVersion,
+		},
+		Content: b,
+	}, nil
+}
+
+// Reply creates a message in response to m.
+func (m *Message) Reply(msgType string, content interface{}) (*Message, error) {
+	r, err := NewMessage(msgType, m.Header.Session, content)
+	if err != nil {
+		return nil, err
+	}
+	r.ParentHeader = m.Header
+	r.Identities = m.Identities
+	return r, nil
+}
+
+// Encode serializes the message into multipart frames, signing it with the key.
+// Messages are not signed if the key is empty.
+func (m *Message) Encode(key []byte) ([][]byte, error) {
+	header, err := json.Marshal(m.Header)
+	if err != nil {
+		return nil, err
+	}
+	parent := []byte("{}")
+	if m.ParentHeader != (Header{}) {
+		if parent, err = json.Marshal(m.ParentHeader); err != nil {
+			return nil, err
+		}
+	}
+	metadata := []byte("{}")
+	if len(m.Metadata) > 0 {
+		if metadata, err = json.Marshal(m.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	content := []byte(m.Content)
+	if len(content) == 0 {
+		content = []byte("{}")
+	}
+
+	frames := make([][]byte, 0, len(m.Identities)+6+len(m.Buffers))
+	frames = append(frames, m.Identities...)
+	frames = append(frames, delimiter, sign(key, header, parent, metadata, content), header, parent, metadata, content)
+	return append(frames, m.Buffers...), nil
+}
+
+// DecodeMessage parses multipart frames and verifies their signature with the key.
+func DecodeMessage(frames [][]byte, key []byte) (*Message, error) {
+	i := 0
+	for i < len(frames) && !bytes.Equal(frames[i], delimiter) {
+		i++
+	}
+	if len(frames)-i < 6 {
+		return nil, fmt.Errorf("malformed message: expected at least 6 frames after %q, got %d", delimiter, len(frames)-i)
+	}
+
+	sig, parts := frames[i+1], frames[i+2:i+6]
+	if len(key) > 0 && !hmac.Equal(sig, sign(key, parts...)) {
+		return nil, ErrSignature
+	}
+
+	m := Message{
+		Identities: frames[:i],
+		Content:    parts[3],
+		Buffers:    frames[i+6:],
+	}
+	if err := json.Unmarshal(parts[0], &m.Header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if err := json.Unmarshal(parts[1], &m.ParentHeader); err != nil {
+		return nil, fmt.Errorf("parent header: %w", err)
+	}
+	if err := json.Unmarshal(parts[2], &m.Metadata); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	return &m, nil
+}
+
+// sign computes a hex-encoded HMAC-SHA256 signature of the parts.
+func sign(key []byte, parts ...[]byte) []byte {
+	if len(key) == 0 {
+		return []byte{}
+	}
+	mac := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	sum := mac.Sum(nil)
+	sig := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(sig, sum)
+	return sig
+}
+
+// newID generates a random UUID.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,230 @@
+package execute
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Socket sends and receives multipart messages on one of the kernel's channels.
+// Implementations must allow Send and Recv to be called concurrently.
+type Socket interface {
+	Send(frames [][]byte) error
+
+	// Recv blocks until the next message arrives or the socket is closed.
+	Recv() ([][]byte, error)
+
+	Close() error
+}
+
+// Socket types used by kernels and their clients.
+const (
+	Dealer = "DEALER"
+	Router = "ROUTER"
+	Pub    = "PUB"
+	Sub    = "SUB"
+)
+
+// DialZMTP connects to a ZeroMQ socket at the TCP address, e.g. "127.0.0.1:5555".
+func DialZMTP(ctx context.Context, addr, socketType string) (Socket, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewZMTP(conn, socketType)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewZMTP performs a [ZMTP 3.0] handshake over the connection.
+//
+// This is a minimal implementation of the protocol, sufficient to talk to a kernel over
+// a single connection: it supports the NULL security mechanism only and does not route
+// messages between multiple peers. SUB sockets subscribe to all messages.
+//
+// [ZMTP 3.0]: https://rfc.zeromq.org/spec/23/
+func NewZMTP(conn net.Conn, socketType string) (Socket, error) {
+	s := &zmtp{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if err := s.handshake(socketType); err != nil {
+		return nil, fmt.Errorf("zmtp: handshake: %w", err)
+	}
+	if socketType == Sub {
+		// ZMTP 3.0 subscriptions are messages starting with 0x01 followed by the topic prefix.
+		if err := s.Send([][]byte{{1}}); err != nil {
+			return nil, fmt.Errorf("zmtp: subscribe: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Frame flags.
+const (
+	flagMore    = 1 << 0
+	flagLong    = 1 << 1
+	flagCommand = 1 << 2
+)
+
+type zmtp struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu sync.Mutex // guards w
+	w  *bufio.Writer
+}
+
+func (s *zmtp) handshake(socketType string) error {
+	var greeting [64]byte
+	greeting[0], greeting[9] = 0xff, 0x7f
+	greeting[10], greeting[11] = 3, 0 // version 3.0
+	copy(greeting[12:32], "NULL")
+	if _, err := s.w.Write(greeting[:]); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	var peer [64]byte
+	if _, err := io.ReadFull(s.r, peer[:]); err != nil {
+		return err
+	}
+	if peer[0] != 0xff || peer[9] != 0x7f {
+		return errors.New("peer is not a ZMTP socket")
+	}
+	if peer[10] < 3 {
+		return fmt.Errorf("unsupported ZMTP version %d.%d", peer[10], peer[11])
+	}
+	if mech := string(bytes.TrimRight(peer[12:32], "\x00")); mech != "NULL" {
+		return fmt.Errorf("unsupported security mechanism %q", mech)
+	}
+
+	// READY command with the socket type property.
+	var ready bytes.Buffer
+	ready.WriteByte(5)
+	ready.WriteString("READY")
+	ready.WriteByte(byte(len("Socket-Type")))
+	ready.WriteString("Socket-Type")
+	binary.Write(&ready, binary.BigEndian, uint32(len(socketType)))
+	ready.WriteString(socketType)
+	if err := s.writeFrame(ready.Bytes(), flagCommand); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	body, flags, err := s.readFrame()
+	if err != nil {
+		return err
+	}
+	if flags&flagCommand == 0 || len(body) == 0 {
+		return errors.New("expected READY command")
+	}
+	name := body[1:]
+	if int(body[0]) <= len(name) {
+		name = name[:body[0]]
+	}
+	switch string(name) {
+	case "READY":
+		return nil
+	case "ERROR":
+		return fmt.Errorf("peer rejected connection: %q", body[1+len(name):])
+	}
+	return fmt.Errorf("expected READY command, got %q", name)
+}
+
+func (s *zmtp) Send(frames [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = flagMore
+		}
+		if err := s.writeFrame(f, flags); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+func (s *zmtp) writeFrame(body []byte, flags byte) error {
+	var hdr [9]byte
+	n := 2
+	if len(body) > 255 {
+		flags |= flagLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(body)))
+		n = 9
+	} else {
+		hdr[1] = byte(len(body))
+	}
+	hdr[0] = flags
+	if _, err := s.w.Write(hdr[:n]); err != nil {
+		return err
+	}
+	_, err := s.w.Write(body)
+	return err
+}
+
+// Recv reads the next message, skipping any commands sent by the peer, e.g. heartbeats.
+func (s *zmtp) Recv() ([][]byte, error) {
+	var frames [][]byte
+	for {
+		body, flags, err := s.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			continue
+		}
+		frames = append(frames, body)
+		if flags&flagMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+func (s *zmtp) readFrame() (body []byte, flags byte, err error) {
+	if flags, err = s.r.ReadByte(); err != nil {
+		return nil, 0, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		var b [8]byte
+		if _, err := io.ReadFull(s.r, b[:]); err != nil {
+			return nil, 0, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	} else {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		size = uint64(b)
+	}
+	if size > maxFrameSize {
+		return nil, 0, fmt.Errorf("frame of %d bytes exceeds the limit", size)
+	}
+	body = make([]byte, size)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		return nil, 0, err
+	}
+	return body, flags, nil
+}
+
+// maxFrameSize protects against allocating arbitrary amounts of memory for a malformed frame.
+const maxFrameSize = 1 << 30
+
+func (s *zmtp) Close() error {
+	return s.conn.Close()
+}
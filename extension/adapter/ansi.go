@@ -25,12 +25,16 @@ import (
 //
 // [ansihtml]: https://github.com/robert-nix/ansihtml
 func AnsiHtml(convert func([]byte) []byte) render.RenderCellFunc {
-	return func(w io.Writer, cell schema.Cell) (err error) {
+	return func(w io.Writer, cell schema.Cell) error {
 		// Wrapping in <pre> helps preserve parts of the original
 		// formatting such as newlines and tabs.
-		io.WriteString(w, "<pre>")
-		_, err = w.Write(convert(cell.Text()))
-		io.WriteString(w, "</pre>")
-		return
+		if _, err := io.WriteString(w, "<pre>"); err != nil {
+			return err
+		}
+		if _, err := w.Write(convert(cell.Text())); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "</pre>")
+		return err
 	}
 }
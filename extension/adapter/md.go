@@ -15,6 +15,8 @@ import (
 //		adapter.Blackfriday(blackfriday.MarkdownCommon)
 //	)
 //
+// Images from cell attachments are rendered if the attachments are resolved with package extension/attachment.
+//
 // [blackfriday]: https://github.com/russross/blackfriday
 func Blackfriday(convert func([]byte) []byte) render.RenderCellFunc {
 	return func(w io.Writer, cell schema.Cell) (err error) {
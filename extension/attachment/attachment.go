@@ -0,0 +1,281 @@
+// Package attachment resolves references to [cell attachments] in markdown and raw cells,
+// so that they can be rendered by any markdown renderer.
+//
+// Markdown cells refer to their attachments with "attachment:" URLs, e.g. ![plot](attachment:plot.png),
+// which no markdown renderer understands. The package rewrites such URLs in the source of a cell before
+// it is rendered, replacing them with data URIs or with the URLs of files the attachments were extracted to.
+// URLs are rewritten in link and image destinations, link reference definitions, and src and href attributes
+// of inline HTML. References to attachments which the cell does not have are left as is.
+//
+// Use the extension to resolve the attachments in every notebook, regardless of the renderer:
+//
+//	nb.New(
+//		nb.WithExtensions(
+//			extension.NewMarkdown(adapter.Blackfriday(blackfriday.MarkdownCommon)),
+//			attachment.New(),
+//		),
+//	)
+//
+// or wrap a single RenderCellFunc with Resolve.
+//
+// [cell attachments]: https://nbformat.readthedocs.io/en/latest/format_description.html#cell-attachments
+package attachment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+// ExtractFunc saves the attachment and returns the URL to replace the reference with.
+// The data is decoded, i.e. images are passed as bytes, not base64.
+type ExtractFunc func(name, mime string, data []byte) (url string, err error)
+
+// Option configures the Resolver.
+type Option func(*Resolver)
+
+// WithExtract saves the attachments with the function instead of inlining them as data URIs.
+func WithExtract(extract ExtractFunc) Option {
+	return func(r *Resolver) {
+		r.extract = extract
+	}
+}
+
+// Dir returns an ExtractFunc which writes the attachments to files in dir and returns their URLs under baseURL.
+// Files are named after the hash of their contents and the name of the attachment, so that the attachments
+// with the same name in different cells do not overwrite each other and identical ones are written once.
+func Dir(dir, baseURL string) ExtractFunc {
+	return func(name, mime string, data []byte) (string, error) {
+		sum := sha256.Sum256(data)
+		file := hex.EncodeToString(sum[:8]) + "-" + path.Base(filepath.ToSlash(name))
+		p := filepath.Join(dir, file)
+		if _, err := os.Stat(p); err != nil {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(p, data, 0o644); err != nil {
+				return "", err
+			}
+		}
+		return strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(file), nil
+	}
+}
+
+// Resolver rewrites references to cell attachments.
+type Resolver struct {
+	extract ExtractFunc
+}
+
+var _ nb.Extension = (*Resolver)(nil)
+
+// New creates a Resolver which inlines the attachments as data URIs by default.
+func New(opts ...Option) *Resolver {
+	var r Resolver
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return &r
+}
+
+// Resolve wraps a RenderCellFunc, resolving the references to attachments before the cell is rendered.
+func Resolve(f render.RenderCellFunc, opts ...Option) render.RenderCellFunc {
+	r := New(opts...)
+	return func(w io.Writer, cell schema.Cell) error {
+		resolved, err := r.Cell(cell)
+		if err != nil {
+			return err
+		}
+		return f(w, resolved)
+	}
+}
+
+// Extend resolves the attachments in the markdown and raw cells of every notebook before it is rendered.
+// The cells of the notebook are read into memory.
+func (r *Resolver) Extend(n *nb.Notebook) {
+	n.WrapRenderer(func(rr render.Renderer) render.Renderer {
+		return &renderer{Renderer: rr, r: r}
+	})
+}
+
+// Notebook returns a copy of the notebook with the attachments resolved. Cells without references
+// to their attachments are not copied. The cells of the notebook are read once, so that notebooks
+// decoded from a stream can be passed to the renderer afterwards.
+func (r *Resolver) Notebook(notebook schema.Notebook) (schema.Notebook, error) {
+	return schema.MapCells(notebook, func(i int, cell schema.Cell) (schema.Cell, error) {
+		resolved, err := r.Cell(cell)
+		if err != nil {
+			return nil, fmt.Errorf("attachment: cell %d: %w", i, err)
+		}
+		return resolved, nil
+	})
+}
+
+var (
+	// mdLink matches attachments in the destination of inline links and images: [text](attachment:name "title").
+	mdLink = regexp.MustCompile(`(\]\(\s*<?)(attachment:[^)\s>]+)`)
+
+	// mdRef matches attachments in link reference definitions: [label]: attachment:name.
+	mdRef = regexp.MustCompile(`(?m)(^ {0,3}\[[^\]]+\]:[ \t]*<?)(attachment:[^\s>]+)`)
+
+	// htmlAttr matches attachments in link attributes of inline HTML.
+	htmlAttr = regexp.MustCompile(`((?:href|src)\s*=\s*["'])(attachment:[^"']+)`)
+)
+
+// Cell returns a copy of the markdown or raw cell with the attachments resolved, or the cell itself
+// if it does not reference any of its attachments. Decoded v4 cells keep their type.
+func (r *Resolver) Cell(cell schema.Cell) (schema.Cell, error) {
+	if cell.Type() != schema.Markdown && cell.Type() != schema.Raw {
+		return cell, nil
+	}
+	ha, ok := cell.(schema.HasAttachments)
+	if !ok || ha.Attachments() == nil {
+		return cell, nil
+	}
+	att := ha.Attachments()
+
+	text := cell.Text()
+	changed := false
+	var err error
+	for _, re := range []*regexp.Regexp{mdLink, mdRef, htmlAttr} {
+		text = re.ReplaceAllFunc(text, func(m []byte) []byte {
+			sub := re.FindSubmatchIndex(m)
+			ref := string(m[sub[4]:sub[5]])
+			u, ok, rerr := r.resolve(att, ref)
+			if rerr != nil && err == nil {
+				err = rerr
+			}
+			if !ok {
+				return m
+			}
+			changed = true
+			return append(append([]byte(nil), m[:sub[4]]...), u...)
+		})
+	}
+	if err != nil || !changed {
+		return cell, err
+	}
+
+	switch c := cell.(type) {
+	case *v4.Markdown:
+		cp := *c
+		cp.Source = common.MultilineString{string(text)}
+		return &cp, nil
+	case *v4.Raw:
+		cp := *c
+		cp.Source = common.MultilineString{string(text)}
+		return &cp, nil
+	}
+	return &resolvedCell{Cell: cell, att: ha, text: text}, nil
+}
+
+// resolve returns the URL for the reference "attachment:name". It reports false if the cell has no such attachment.
+func (r *Resolver) resolve(att schema.Attachments, ref string) (string, bool, error) {
+	name, err := url.PathUnescape(strings.TrimPrefix(ref, "attachment:"))
+	if err != nil {
+		return "", false, nil
+	}
+	mb := att.MimeBundle(name)
+	if mb == nil {
+		return "", false, nil
+	}
+	mime := mb.MimeType()
+	data := mb.Text()
+	if len(data) == 0 {
+		return "", false, nil
+	}
+
+	if r.extract == nil {
+		if isText(mime) {
+			return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), true, nil
+		}
+		return "data:" + mime + ";base64," + strings.Join(strings.Fields(string(data)), ""), true, nil
+	}
+
+	if !isText(mime) {
+		if data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), "")); err != nil {
+			return "", false, fmt.Errorf("attachment %q: %w", name, err)
+		}
+	}
+	u, err := r.extract(name, mime, data)
+	if err != nil {
+		return "", false, fmt.Errorf("attachment %q: %w", name, err)
+	}
+	return u, true, nil
+}
+
+// isText reports whether the attachment's data is stored as text. Data of other mime-types is base64-encoded.
+func isText(mime string) bool {
+	return strings.HasPrefix(mime, "text/") || common.IsJSON(mime) ||
+		mime == "image/svg+xml" || mime == "application/javascript"
+}
+
+// resolvedCell is a copy of a cell of a type not known to the package with the attachments resolved.
+type resolvedCell struct {
+	schema.Cell
+	att  schema.HasAttachments
+	text []byte
+}
+
+var _ schema.HasAttachments = (*resolvedCell)(nil)
+var _ schema.HasID = (*resolvedCell)(nil)
+var _ schema.HasMetadata = (*resolvedCell)(nil)
+
+func (c *resolvedCell) Text() []byte {
+	return c.text
+}
+
+func (c *resolvedCell) Attachments() schema.Attachments {
+	return c.att.Attachments()
+}
+
+func (c *resolvedCell) ID() string {
+	if id, ok := c.Cell.(schema.HasID); ok {
+		return id.ID()
+	}
+	return ""
+}
+
+func (c *resolvedCell) RawMetadata() []byte {
+	if m, ok := c.Cell.(schema.HasMetadata); ok {
+		return m.RawMetadata()
+	}
+	return nil
+}
+
+// renderer resolves the attachments before passing the notebooks to the wrapped renderer.
+type renderer struct {
+	render.Renderer
+	r *Resolver
+}
+
+var _ render.ContextRenderer = (*renderer)(nil)
+
+func (r *renderer) Render(w io.Writer, notebook schema.Notebook) error {
+	return r.RenderContext(context.Background(), w, notebook)
+}
+
+func (r *renderer) RenderContext(ctx context.Context, w io.Writer, notebook schema.Notebook) error {
+	notebook, err := r.r.Notebook(notebook)
+	if err != nil {
+		return err
+	}
+	if cr, ok := r.Renderer.(render.ContextRenderer); ok {
+		return cr.RenderContext(ctx, w, notebook)
+	}
+	return r.Renderer.Render(w, notebook)
+}
@@ -0,0 +1,122 @@
+package attachment_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/extension"
+	"github.com/bevzzz/nb/extension/adapter"
+	"github.com/bevzzz/nb/extension/attachment"
+	"github.com/bevzzz/nb/pkg/test"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+// notebook has a markdown cell which references its attachments in different ways.
+const notebook = `{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+	{"id": "a", "cell_type": "markdown", "metadata": {}, "source": [
+		"![plot](attachment:plot.png \"Plot\")\n",
+		"<img src=\"attachment:logo.svg\" width=\"10\">\n",
+		"![missing](attachment:missing.png) and ` + "`attachment:plot.png`" + ` in text\n",
+		"[ref]: attachment:plot.png"
+	], "attachments": {
+		"plot.png": {"image/png": "aGVs\nbG8="},
+		"logo.svg": {"image/svg+xml": "<svg/>"}
+	}},
+	{"id": "b", "cell_type": "markdown", "metadata": {}, "source": "No attachments"}
+]}`
+
+func TestResolver_Cell(t *testing.T) {
+	decoded, err := decode.Bytes([]byte(notebook))
+	require.NoError(t, err)
+
+	resolved, err := attachment.New().Notebook(decoded)
+	require.NoError(t, err)
+
+	got := string(resolved.Cells()[0].Text())
+	require.Equal(t, strings.Join([]string{
+		`![plot](data:image/png;base64,aGVsbG8= "Plot")`,
+		`<img src="data:image/svg+xml;base64,PHN2Zy8+" width="10">`,
+		"![missing](attachment:missing.png) and `attachment:plot.png` in text",
+		`[ref]: data:image/png;base64,aGVsbG8=`,
+	}, "\n"), got)
+
+	require.IsType(t, decoded.Cells()[0], resolved.Cells()[0], "decoded cells keep their type")
+	require.Equal(t, "a", resolved.Cells()[0].(schema.HasID).ID())
+	require.Same(t, decoded.Cells()[1], resolved.Cells()[1], "cells without attachments are not copied")
+	require.Contains(t, string(decoded.Cells()[0].Text()), "attachment:plot.png", "original is not modified")
+}
+
+func TestResolve(t *testing.T) {
+	cell := test.WithAttachment(test.Markdown("![x](attachment:x.png)"), "x.png", map[string]interface{}{"image/png": "eA=="})
+	render := attachment.Resolve(adapter.Blackfriday(func(b []byte) []byte { return b }))
+
+	var buf bytes.Buffer
+	require.NoError(t, render(&buf, cell))
+	require.Equal(t, "![x](data:image/png;base64,eA==)", buf.String())
+
+	t.Run("other cells", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, render(&buf, test.Markdown("![x](attachment:x.png)")))
+		require.Equal(t, "![x](attachment:x.png)", buf.String())
+	})
+}
+
+func TestResolver_Extend(t *testing.T) {
+	c := nb.New(nb.WithExtensions(
+		extension.NewMarkdown(adapter.Blackfriday(func(b []byte) []byte { return b })),
+		attachment.New(),
+	))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Convert(&buf, []byte(notebook)))
+	require.Contains(t, buf.String(), "![plot](data:image/png;base64,aGVsbG8=")
+	require.NotContains(t, buf.String(), "attachment:logo.svg")
+
+	t.Run("stream", func(t *testing.T) {
+		var stream bytes.Buffer
+		require.NoError(t, c.ConvertReader(&stream, strings.NewReader(notebook)))
+		require.Equal(t, buf.String(), stream.String())
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		const malformed = `{"metadata": {}, "nbformat": 4, "nbformat_minor": 4, "cells": [
+			{"cell_type": "markdown", "metadata": {}, "source": "# Hello"},
+			{"cell_type": "markdown", "metadata": {}, "source": 1}
+		]}`
+		want := nb.New().ConvertReader(io.Discard, strings.NewReader(malformed))
+		require.Error(t, want)
+
+		err := c.ConvertReader(io.Discard, strings.NewReader(malformed))
+		require.EqualError(t, err, want.Error())
+	})
+}
+
+func TestWithExtract(t *testing.T) {
+	decoded, err := decode.Bytes([]byte(notebook))
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	resolved, err := attachment.New(attachment.WithExtract(attachment.Dir(dir, "/assets/"))).Notebook(decoded)
+	require.NoError(t, err)
+
+	got := string(resolved.Cells()[0].Text())
+	require.Contains(t, got, `![plot](/assets/2cf24dba5fb0a30e-plot.png "Plot")`)
+	require.Contains(t, got, `<img src="/assets/`)
+
+	b, err := os.ReadFile(filepath.Join(dir, "2cf24dba5fb0a30e-plot.png"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b), "images are decoded")
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2, "plot.png is written once")
+}
@@ -0,0 +1,82 @@
+package toc
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+
+	"golang.org/x/net/html/atom"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// AnchorClass is the class of the links added to the headings, same as in Jupyter.
+const AnchorClass = "anchor-link"
+
+var levels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// anchors copies rendered HTML to w, setting the ids of the heading elements and adding
+// a self-link before their closing tags. Heading elements are matched with the headings in order;
+// elements whose level does not match the next heading, e.g. ones written in raw HTML, are left as is.
+func anchors(w io.Writer, src []byte, hs []*Heading) error {
+	if len(hs) == 0 {
+		_, err := w.Write(src)
+		return err
+	}
+
+	var buf bytes.Buffer
+	var open *Heading // heading whose element is not closed yet
+	z := xhtml.NewTokenizer(bytes.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			break
+		}
+		raw := z.Raw()
+
+		switch tt {
+		case xhtml.StartTagToken:
+			tok := z.Token()
+			if level, ok := levels[tok.DataAtom]; ok && open == nil && len(hs) > 0 && hs[0].Level == level {
+				open, hs = hs[0], hs[1:]
+				writeStartTag(&buf, tok, open.ID)
+				continue
+			}
+		case xhtml.EndTagToken:
+			tok := z.Token()
+			if level, ok := levels[tok.DataAtom]; ok && open != nil && open.Level == level {
+				fmt.Fprintf(&buf, "<a class=\"%s\" href=\"#%s\">¶</a>", AnchorClass, html.EscapeString(open.ID))
+				open = nil
+			}
+		}
+		buf.Write(raw)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeStartTag writes the tag with its original attributes, replacing the id.
+func writeStartTag(buf *bytes.Buffer, tok xhtml.Token, id string) {
+	buf.WriteString("<")
+	buf.WriteString(tok.Data)
+	buf.WriteString(" id=\"")
+	buf.WriteString(html.EscapeString(id))
+	buf.WriteString("\"")
+	for _, attr := range tok.Attr {
+		if attr.Key == "id" {
+			continue
+		}
+		buf.WriteString(" ")
+		buf.WriteString(attr.Key)
+		buf.WriteString("=\"")
+		buf.WriteString(html.EscapeString(attr.Val))
+		buf.WriteString("\"")
+	}
+	buf.WriteString(">")
+}
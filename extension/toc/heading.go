@@ -0,0 +1,172 @@
+package toc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bevzzz/nb/schema"
+	v3 "github.com/bevzzz/nb/schema/v3"
+)
+
+// Heading is a section heading found in a markdown cell.
+type Heading struct {
+	// Level is 1 for the top-level heading (#) and 6 for the deepest one (######).
+	Level int
+
+	// Text is the heading's plain text, with inline markup removed.
+	Text string
+
+	// ID is a slug unique within the notebook, which identifies the heading's anchor.
+	ID string
+
+	// Cell is the index of the cell containing the heading.
+	Cell int
+
+	// Children are the subsections of the heading.
+	Children []*Heading
+}
+
+// Headings scans the i-th cell for headings and assigns them ids. Passing the same Slugger for
+// every cell in the notebook, in order, yields the same ids as Build and the anchors added by the extension.
+// v3 heading cells carry their level explicitly, other cells are parsed as markdown.
+func Headings(cell schema.Cell, i int, slug *Slugger) []*Heading {
+	var parsed []heading
+	if h, ok := cell.(*v3.Heading); ok {
+		parsed = []heading{{level: h.Level, text: strings.Join(strings.Fields(string(h.Source.Text())), " ")}}
+	} else if cell.Type() == schema.Markdown {
+		parsed = parse(string(cell.Text()))
+	}
+
+	hs := make([]*Heading, 0, len(parsed))
+	for _, h := range parsed {
+		text := plain(h.text)
+		hs = append(hs, &Heading{Level: h.level, Text: text, ID: slug.Slug(text), Cell: i})
+	}
+	return hs
+}
+
+type heading struct {
+	level int
+	text  string
+}
+
+var (
+	atx     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setext  = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fence   = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	pending = regexp.MustCompile(`^ {0,3}(?:[-*+]|\d+[.)])(?:[ \t]|$)|^ {0,3}>`)
+)
+
+// parse finds ATX (# Heading) and setext (Heading\n===) headings in markdown,
+// skipping fenced and indented code blocks.
+func parse(md string) (hs []heading) {
+	var inFence string
+	var para []string // lines of the current paragraph, which may turn out to be a setext heading
+	for _, line := range strings.Split(md, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if inFence != "" {
+			if strings.HasPrefix(strings.TrimLeft(line, " "), inFence) {
+				inFence = ""
+			}
+			continue
+		}
+		if m := fence.FindStringSubmatch(line); m != nil {
+			inFence, para = m[1], nil
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			para = nil
+			continue
+		}
+		if len(para) == 0 && strings.HasPrefix(strings.ReplaceAll(line, "\t", "    "), "    ") {
+			continue // indented code block
+		}
+		if m := atx.FindStringSubmatch(line); m != nil {
+			hs = append(hs, heading{level: len(m[1]), text: m[2]})
+			para = nil
+			continue
+		}
+		if m := setext.FindStringSubmatch(line); m != nil && len(para) > 0 {
+			level := 1
+			if m[1][0] == '-' {
+				level = 2
+			}
+			hs = append(hs, heading{level: level, text: strings.Join(para, " ")})
+			para = nil
+			continue
+		}
+		if pending.MatchString(line) {
+			para = nil // list items and block quotes are not setext heading content
+			continue
+		}
+		para = append(para, strings.TrimSpace(line))
+	}
+	return hs
+}
+
+var (
+	image    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	link     = regexp.MustCompile(`\[([^\]]*)\](?:\([^)]*\)|\[[^\]]*\])`)
+	htmlTag  = regexp.MustCompile(`<[^>]+>`)
+	emphasis = regexp.MustCompile(`(?:^|\W)(_+)|(_+)(?:\W|$)`)
+	escaped  = regexp.MustCompile(`\\([[:punct:]])`)
+)
+
+// plain removes inline markdown from the heading text.
+func plain(s string) string {
+	s = image.ReplaceAllString(s, "$1")
+	s = link.ReplaceAllString(s, "$1")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = strings.NewReplacer("`", "", "**", "", "*", "", "~~", "").Replace(s)
+	s = emphasis.ReplaceAllStringFunc(s, func(m string) string {
+		return strings.Trim(m, "_")
+	})
+	s = escaped.ReplaceAllString(s, "$1")
+	return strings.TrimSpace(s)
+}
+
+// Slugger assigns unique slugs to headings. The zero value is ready to use.
+type Slugger struct {
+	seen map[string]int
+}
+
+// Slug returns the slug for the text, adding a numeric suffix if it has been seen before:
+// "Usage", "Usage" and "Usage 1" become "usage", "usage-1", and "usage-1-1".
+func (s *Slugger) Slug(text string) string {
+	if s.seen == nil {
+		s.seen = make(map[string]int)
+	}
+	slug := Slugify(text)
+	id := slug
+	if n, ok := s.seen[slug]; ok {
+		for taken := true; taken; _, taken = s.seen[id] {
+			n++
+			id = slug + "-" + strconv.Itoa(n)
+		}
+		s.seen[slug] = n
+	}
+	s.seen[id] = 0
+	return id
+}
+
+// Slugify converts the text into a URL fragment like GitHub does: it is lowercased,
+// spaces are replaced with hyphens, and any punctuation other than hyphens and underscores is dropped.
+// Text without any letters or digits becomes "section".
+func Slugify(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+			sb.WriteByte('-')
+		}
+	}
+	if strings.Trim(sb.String(), "-_") == "" {
+		return "section"
+	}
+	return sb.String()
+}
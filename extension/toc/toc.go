@@ -0,0 +1,249 @@
+// Package toc builds a table of contents from the headings in markdown cells
+// and adds anchors to the rendered headings, so that they can be linked to.
+//
+// Use the extension with the markdown renderer of your choice in place of extension.NewMarkdown:
+//
+//	nb.New(
+//		nb.WithExtensions(
+//			toc.New(adapter.Goldmark(func(b []byte, w io.Writer) error {
+//				return goldmark.Convert(b, w)
+//			})),
+//		),
+//	)
+//
+// Headings get an id derived from their text and a link to themselves, regardless of the markdown
+// renderer which produced them. A table of contents is rendered after a markdown cell tagged "toc".
+// To render the outline elsewhere, e.g. in a navigation sidebar, call Build with the same notebook:
+// the ids of its headings match the ones in the rendered document.
+package toc
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"io"
+	"reflect"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+)
+
+// DefaultTag marks the cell after which the table of contents is rendered.
+const DefaultTag = "toc"
+
+type config struct {
+	maxLevel int
+	tag      string
+}
+
+// Option configures the outline.
+type Option func(*config)
+
+// WithMaxLevel includes headings up to the level in the outline, e.g. 2 for "#" and "##" headings only.
+// Deeper headings still get anchors. The default is 6, which includes all headings.
+func WithMaxLevel(n int) Option {
+	return func(cfg *config) {
+		cfg.maxLevel = n
+	}
+}
+
+// WithTag changes the tag which marks the table of contents cell. The default is DefaultTag.
+func WithTag(tag string) Option {
+	return func(cfg *config) {
+		cfg.tag = tag
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{maxLevel: 6, tag: DefaultTag}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// Outline is the tree of headings in a notebook.
+type Outline struct {
+	// Headings are the top-level headings. A heading is nested under the closest preceding heading
+	// of a lower level, so the top level may contain headings of different levels.
+	Headings []*Heading
+
+	cells map[schema.Cell][]*Heading
+}
+
+// Build collects the headings from the notebook's cells. Headings in the table of contents cell
+// itself are not included in the outline. Notebooks which can only be read once, like decode.Stream,
+// should be read into memory before calling Build.
+func Build(nb schema.Notebook, opts ...Option) *Outline {
+	cfg := newConfig(opts)
+	o := Outline{cells: make(map[schema.Cell][]*Heading)}
+
+	var slug Slugger
+	var stack []*Heading // path from the root to the last heading
+	for i, cell := range nb.Cells() {
+		hs := Headings(cell, i, &slug)
+		if len(hs) == 0 {
+			continue
+		}
+		if hashable(cell) {
+			o.cells[cell] = hs
+		}
+		if schema.HasTag(cell, cfg.tag) {
+			continue
+		}
+		for _, h := range hs {
+			if h.Level > cfg.maxLevel {
+				continue
+			}
+			for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				o.Headings = append(o.Headings, h)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, h)
+			}
+			stack = append(stack, h)
+		}
+	}
+	return &o
+}
+
+// Cell returns the headings found in the cell.
+func (o *Outline) Cell(cell schema.Cell) []*Heading {
+	if !hashable(cell) {
+		return nil
+	}
+	return o.cells[cell]
+}
+
+// Render writes the outline as nested lists of links to the headings:
+//
+//	<nav class="nb-TOC"><ul><li><a href="#intro">Intro</a><ul>...</ul></li></ul></nav>
+func (o *Outline) Render(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("<nav class=\"nb-TOC\">\n")
+	writeList(&buf, o.Headings)
+	buf.WriteString("</nav>\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeList(buf *bytes.Buffer, hs []*Heading) {
+	if len(hs) == 0 {
+		return
+	}
+	buf.WriteString("<ul>\n")
+	for _, h := range hs {
+		buf.WriteString("<li><a href=\"#")
+		buf.WriteString(html.EscapeString(h.ID))
+		buf.WriteString("\">")
+		buf.WriteString(html.EscapeString(h.Text))
+		buf.WriteString("</a>")
+		if len(h.Children) > 0 {
+			buf.WriteString("\n")
+			writeList(buf, h.Children)
+		}
+		buf.WriteString("</li>\n")
+	}
+	buf.WriteString("</ul>\n")
+}
+
+// New returns an extension which renders markdown cells with f, adds anchors to their headings,
+// and places the table of contents after the tagged cell.
+//
+// The extension needs to see the entire notebook before rendering its first cell,
+// so it reads all cells into memory, even if the notebook is decoded from a stream.
+func New(f render.RenderCellFunc, opts ...Option) nb.Extension {
+	return &toc{render: f, opts: opts, cfg: newConfig(opts)}
+}
+
+type toc struct {
+	render render.RenderCellFunc
+	opts   []Option
+	cfg    config
+}
+
+var _ nb.Extension = (*toc)(nil)
+var _ render.CellRenderer = (*toc)(nil)
+
+// RegisterFuncs registers a RenderCellFunc for markdown cells. Registries which do not accept
+// context-aware functions render headings without the outline of the notebook.
+func (t *toc) RegisterFuncs(reg render.RenderCellFuncRegistry) {
+	pref := render.Pref{Type: schema.Markdown, MimeType: common.MarkdownText}
+	if cr, ok := reg.(render.ContextRegistry); ok {
+		cr.RegisterContext(pref, t.renderMarkdown)
+		return
+	}
+	reg.Register(pref, func(w io.Writer, cell schema.Cell) error {
+		return t.renderMarkdown(context.Background(), w, cell)
+	})
+}
+
+// Extend adds toc as a cell renderer and builds the outline of every notebook before it is rendered.
+func (t *toc) Extend(n *nb.Notebook) {
+	n.Renderer().AddOptions(render.WithCellRenderers(t))
+	n.WrapRenderer(func(r render.Renderer) render.Renderer {
+		return &renderer{Renderer: r, opts: t.opts}
+	})
+}
+
+// renderMarkdown renders the cell and adds anchors to its headings.
+// Without an outline in the context, headings are only unique within the cell.
+func (t *toc) renderMarkdown(ctx context.Context, w io.Writer, cell schema.Cell) error {
+	var buf bytes.Buffer
+	if err := t.render(&buf, cell); err != nil {
+		return err
+	}
+
+	o, _ := ctx.Value(outlineKey{}).(*Outline)
+	var hs []*Heading
+	if o != nil {
+		hs = o.Cell(cell)
+	} else {
+		hs = Headings(cell, 0, new(Slugger))
+	}
+	if err := anchors(w, buf.Bytes(), hs); err != nil {
+		return err
+	}
+
+	if o != nil && schema.HasTag(cell, t.cfg.tag) {
+		return o.Render(w)
+	}
+	return nil
+}
+
+type outlineKey struct{}
+
+// renderer builds the outline of the notebook and passes it to the cells in the context.
+type renderer struct {
+	render.Renderer
+	opts []Option
+}
+
+var _ render.ContextRenderer = (*renderer)(nil)
+
+func (r *renderer) Render(w io.Writer, nb schema.Notebook) error {
+	return r.RenderContext(context.Background(), w, nb)
+}
+
+func (r *renderer) RenderContext(ctx context.Context, w io.Writer, nb schema.Notebook) error {
+	s, err := schema.ReadAll(nb)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, outlineKey{}, Build(s, r.opts...))
+	if cr, ok := r.Renderer.(render.ContextRenderer); ok {
+		return cr.RenderContext(ctx, w, s)
+	}
+	return r.Renderer.Render(w, s)
+}
+
+// hashable reports whether the cell can be used as a map key.
+// Decoded cells are always pointers, but clients may implement schema.Cell with other types.
+func hashable(cell schema.Cell) bool {
+	return cell != nil && reflect.TypeOf(cell).Comparable()
+}
@@ -0,0 +1,208 @@
+package toc_test
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/extension/toc"
+	"github.com/bevzzz/nb/pkg/test"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+// outline lists the headings depth-first as "indent id: text".
+func outline(hs []*toc.Heading, depth int) (got []string) {
+	for _, h := range hs {
+		got = append(got, strings.Repeat("  ", depth)+h.ID+": "+h.Text)
+		got = append(got, outline(h.Children, depth+1)...)
+	}
+	return
+}
+
+func TestBuild(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		nb   schema.Notebook
+		opts []toc.Option
+		want []string
+	}{
+		{
+			name: "nests headings",
+			nb: test.Notebook(
+				test.Markdown("# Intro\ntext\n## Install\n### Linux"),
+				test.Markdown("## Usage\n#### Deep"),
+				test.Markdown("# Next"),
+			),
+			want: []string{
+				"intro: Intro",
+				"  install: Install",
+				"    linux: Linux",
+				"  usage: Usage",
+				"    deep: Deep",
+				"next: Next",
+			},
+		},
+		{
+			name: "unique ids",
+			nb: test.Notebook(
+				test.Markdown("# Usage\n# Usage"),
+				test.Markdown("# Usage 1\n# ???"),
+			),
+			want: []string{"usage: Usage", "usage-1: Usage", "usage-1-1: Usage 1", "section: ???"},
+		},
+		{
+			name: "inline markup and closing sequence",
+			nb:   test.Notebook(test.Markdown("## The `nb` [package](https://example.com) is **great**, snake_case ##")),
+			want: []string{"the-nb-package-is-great-snake_case: The nb package is great, snake_case"},
+		},
+		{
+			name: "setext headings",
+			nb:   test.Notebook(test.Markdown("Title\nline two\n=====\n\nSubtitle\n---\n\n- item\n---")),
+			want: []string{"title-line-two: Title line two", "  subtitle: Subtitle"},
+		},
+		{
+			name: "ignores code blocks",
+			nb: test.Notebook(
+				test.Markdown("```python\n# comment\n```\n\n    # indented\n#hashtag\n# Real"),
+				test.Raw("# raw", "text/markdown"),
+			),
+			want: []string{"real: Real"},
+		},
+		{
+			name: "max level",
+			nb:   test.Notebook(test.Markdown("# A\n## B\n### C")),
+			opts: []toc.Option{toc.WithMaxLevel(2)},
+			want: []string{"a: A", "  b: B"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := toc.Build(tt.nb, tt.opts...)
+			require.Equal(t, tt.want, outline(o.Headings, 0))
+		})
+	}
+
+	t.Run("v3 heading cells", func(t *testing.T) {
+		nb, err := decode.Bytes([]byte(`{"nbformat": 3, "nbformat_minor": 0, "metadata": {}, "worksheets": [{"cells": [
+			{"cell_type": "heading", "level": 1, "metadata": {}, "source": ["Title"]},
+			{"cell_type": "heading", "level": 3, "metadata": {}, "source": ["Section"]},
+			{"cell_type": "markdown", "metadata": {}, "source": ["## Markdown"]}
+		]}]}`))
+		require.NoError(t, err)
+
+		o := toc.Build(nb)
+
+		require.Equal(t, []string{"title: Title", "  section: Section", "  markdown: Markdown"}, outline(o.Headings, 0))
+		require.Equal(t, 1, o.Headings[0].Children[0].Cell)
+	})
+}
+
+func TestSlugify(t *testing.T) {
+	for text, want := range map[string]string{
+		"Hello, World!":      "hello-world",
+		"  Step 1: install ": "step-1-install",
+		"Überblick":          "überblick",
+		"a - b":              "a---b",
+		"!!!":                "section",
+	} {
+		require.Equal(t, want, toc.Slugify(text), text)
+	}
+}
+
+// headings converts ATX headings to HTML, like a real markdown renderer would.
+func headings(w io.Writer, c schema.Cell) error {
+	re := regexp.MustCompile(`(?m)^(#{1,6}) (.*)$`)
+	_, err := io.WriteString(w, re.ReplaceAllStringFunc(string(c.Text()), func(s string) string {
+		m := re.FindStringSubmatch(s)
+		n := string(rune('0' + len(m[1])))
+		return "<h" + n + ` class="title">` + m[2] + "</h" + n + ">"
+	}))
+	return err
+}
+
+func TestExtension(t *testing.T) {
+	tagged := func(s string) schema.Cell {
+		return &taggedCell{Cell: test.Markdown(s), meta: []byte(`{"tags": ["toc"]}`)}
+	}
+
+	t.Run("anchors and toc", func(t *testing.T) {
+		var sb strings.Builder
+		c := nb.New(
+			nb.WithExtensions(toc.New(headings)),
+			nb.WithRenderOptions(test.NoWrapper),
+		)
+
+		err := c.Renderer().Render(&sb, test.Notebook(
+			tagged("## Contents"),
+			test.Markdown("# Intro"),
+			test.Markdown("## Intro\n<h3 id=\"custom\">raw</h3>"),
+		))
+		require.NoError(t, err)
+
+		require.Equal(t, `<h2 id="contents" class="title">Contents<a class="anchor-link" href="#contents">¶</a></h2>`+
+			"<nav class=\"nb-TOC\">\n<ul>\n"+
+			"<li><a href=\"#intro\">Intro</a>\n<ul>\n<li><a href=\"#intro-1\">Intro</a></li>\n</ul>\n</li>\n"+
+			"</ul>\n</nav>\n"+
+			`<h1 id="intro" class="title">Intro<a class="anchor-link" href="#intro">¶</a></h1>`+
+			`<h2 id="intro-1" class="title">Intro<a class="anchor-link" href="#intro-1">¶</a></h2>`+"\n"+
+			`<h3 id="custom">raw</h3>`, sb.String())
+	})
+
+	t.Run("with default converter", func(t *testing.T) {
+		var sb strings.Builder
+		c := nb.New(nb.WithExtensions(toc.New(headings)))
+
+		err := c.Convert(&sb, []byte(`{"nbformat": 4, "nbformat_minor": 5, "metadata": {}, "cells": [
+			{"id": "a", "cell_type": "markdown", "metadata": {"tags": ["toc"]}, "source": "Contents:"},
+			{"id": "b", "cell_type": "markdown", "metadata": {}, "source": "# Hello"}
+		]}`))
+		require.NoError(t, err)
+
+		require.Contains(t, sb.String(), `<li><a href="#hello">Hello</a></li>`)
+		require.Contains(t, sb.String(), `<h1 id="hello" class="title">Hello<a class="anchor-link" href="#hello">¶</a></h1>`)
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		const malformed = `{"nbformat": 4, "nbformat_minor": 4, "metadata": {}, "cells": [
+			{"cell_type": "markdown", "metadata": {}, "source": "# Hello"},
+			{"cell_type": "markdown", "metadata": {}, "source": 1}
+		]}`
+		want := nb.New().ConvertReader(io.Discard, strings.NewReader(malformed))
+		require.Error(t, want)
+
+		err := nb.New(nb.WithExtensions(toc.New(headings))).ConvertReader(io.Discard, strings.NewReader(malformed))
+		require.EqualError(t, err, want.Error())
+	})
+
+	t.Run("registry without context", func(t *testing.T) {
+		reg := make(registry)
+		toc.New(headings).(render.CellRenderer).RegisterFuncs(reg)
+
+		f := reg[render.Pref{Type: schema.Markdown, MimeType: common.MarkdownText}]
+		require.NotNil(t, f, "markdown cells should be registered with Register")
+
+		var sb strings.Builder
+		require.NoError(t, f(&sb, test.Markdown("# Hello")))
+		require.Equal(t, `<h1 id="hello" class="title">Hello<a class="anchor-link" href="#hello">¶</a></h1>`, sb.String())
+	})
+}
+
+// registry only implements render.RenderCellFuncRegistry.
+type registry map[render.Pref]render.RenderCellFunc
+
+func (r registry) Register(pref render.Pref, f render.RenderCellFunc) { r[pref] = f }
+
+type taggedCell struct {
+	schema.Cell
+	meta []byte
+}
+
+func (c *taggedCell) RawMetadata() []byte { return c.meta }
@@ -0,0 +1,249 @@
+// Package lint checks Jupyter notebooks for common problems which should not make it into version control:
+// cells executed out of order, error outputs left in the notebook, oversized outputs, broken attachments, and the like.
+//
+// Each problem is reported as a Finding, which names the rule that produced it, its severity, and the cell it refers to:
+//
+//	findings, err := lint.Notebook(nb, lint.WithDisabled("empty-cell"))
+//	if err != nil {
+//		return err
+//	}
+//	for _, f := range findings {
+//		fmt.Println(f)
+//	}
+//
+// See DefaultRules for the rules that are checked by default. Command nb-lint runs them on notebook files
+// and can be used as a pre-commit hook.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// Severity describes how serious a finding is.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// MarshalText encodes the severity as its name, e.g. "warning".
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the severity from its name, e.g. "warning".
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "info":
+		*s = Info
+	case "warning":
+		*s = Warning
+	case "error":
+		*s = Error
+	default:
+		return fmt.Errorf("lint: unknown severity %q", text)
+	}
+	return nil
+}
+
+// Finding is a problem found in the notebook.
+type Finding struct {
+	// Rule is the name of the rule which reported the finding.
+	Rule string `json:"rule"`
+
+	Severity Severity `json:"severity"`
+
+	// Cell is the index of the cell in the notebook or -1 if the finding concerns the notebook as a whole.
+	Cell int `json:"cell"`
+
+	// CellID is the ID of the cell, if it has one.
+	CellID string `json:"cell_id,omitempty"`
+
+	Message string `json:"message"`
+}
+
+// String formats the finding as "cell 3: warning: message [rule]".
+func (f Finding) String() string {
+	var sb strings.Builder
+	if f.Cell >= 0 {
+		fmt.Fprintf(&sb, "cell %d", f.Cell)
+		if f.CellID != "" {
+			fmt.Fprintf(&sb, " (%s)", f.CellID)
+		}
+		sb.WriteString(": ")
+	}
+	fmt.Fprintf(&sb, "%s: %s [%s]", f.Severity, f.Message, f.Rule)
+	return sb.String()
+}
+
+// Reporter records a finding for the i-th cell, or for the notebook as a whole if i is negative.
+type Reporter func(i int, format string, args ...interface{})
+
+// Rule checks notebooks for a specific problem.
+type Rule struct {
+	// Name identifies the rule in findings and options, e.g. "error-output".
+	Name string
+
+	// Severity is assigned to the rule's findings unless overridden with WithSeverity.
+	Severity Severity
+
+	// Check reports problems found in the notebook.
+	Check func(nb schema.Notebook, report Reporter)
+}
+
+// Default limits for the OutputSize and AttachmentSize rules.
+const (
+	DefaultMaxOutputSize     = 500 << 10
+	DefaultMaxAttachmentSize = 1 << 20
+)
+
+// DefaultRules returns the rules checked by default, see the documentation of each rule for details.
+func DefaultRules() []Rule {
+	return []Rule{
+		ExecutionOrder(),
+		UnsavedExecution(),
+		MissingExecutionCount(),
+		ErrorOutput(),
+		OutputSize(DefaultMaxOutputSize),
+		AttachmentSize(DefaultMaxAttachmentSize),
+		EmptyCell(),
+		Kernelspec(),
+		LanguageInfo(),
+		UnusedAttachment(),
+		MissingAttachment(),
+	}
+}
+
+// Option configures a Linter.
+type Option func(*Linter)
+
+// WithRules adds rules to the linter. A rule replaces the rule of the same name if it is already configured,
+// which allows changing the limits of the default rules, e.g. WithRules(OutputSize(1 << 20)).
+func WithRules(rules ...Rule) Option {
+	return func(l *Linter) {
+	next:
+		for _, r := range rules {
+			for i := range l.rules {
+				if l.rules[i].Name == r.Name {
+					l.rules[i] = r
+					continue next
+				}
+			}
+			l.rules = append(l.rules, r)
+		}
+	}
+}
+
+// WithDisabled disables rules by name.
+func WithDisabled(names ...string) Option {
+	return func(l *Linter) {
+		for _, name := range names {
+			l.disabled[name] = true
+		}
+	}
+}
+
+// WithSeverity changes the severity of the rule's findings.
+func WithSeverity(name string, s Severity) Option {
+	return func(l *Linter) {
+		l.severity[name] = s
+	}
+}
+
+// Linter checks notebooks against a set of rules.
+type Linter struct {
+	rules    []Rule
+	disabled map[string]bool
+	severity map[string]Severity
+}
+
+// New creates a linter with the default rules.
+func New(opts ...Option) *Linter {
+	l := Linter{
+		rules:    DefaultRules(),
+		disabled: make(map[string]bool),
+		severity: make(map[string]Severity),
+	}
+	for _, opt := range opts {
+		opt(&l)
+	}
+	return &l
+}
+
+// Notebook checks the notebook with a linter configured with the options.
+func Notebook(nb schema.Notebook, opts ...Option) ([]Finding, error) {
+	return New(opts...).Notebook(nb)
+}
+
+// Rules returns the names of the enabled rules.
+func (l *Linter) Rules() []string {
+	var names []string
+	for _, r := range l.rules {
+		if !l.disabled[r.Name] {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// Notebook checks the notebook against every enabled rule. Findings are sorted by cell,
+// with the notebook-level findings first, and then in the order the rules were configured.
+// The cells of the notebook are read once, so that notebooks decoded from a stream are checked
+// by every rule, and the error which stopped the stream, if any, is returned.
+func (l *Linter) Notebook(notebook schema.Notebook) ([]Finding, error) {
+	nb, err := schema.ReadAll(notebook)
+	if err != nil {
+		return nil, fmt.Errorf("lint: %w", err)
+	}
+	cells := nb.Cells()
+	var findings []Finding
+	for _, r := range l.rules {
+		if l.disabled[r.Name] {
+			continue
+		}
+		severity, ok := l.severity[r.Name]
+		if !ok {
+			severity = r.Severity
+		}
+
+		name := r.Name
+		r.Check(nb, func(i int, format string, args ...interface{}) {
+			f := Finding{
+				Rule:     name,
+				Severity: severity,
+				Cell:     -1,
+				Message:  fmt.Sprintf(format, args...),
+			}
+			if i >= 0 && i < len(cells) {
+				f.Cell = i
+				if id, ok := cells[i].(schema.HasID); ok {
+					f.CellID = id.ID()
+				}
+			}
+			findings = append(findings, f)
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Cell < findings[j].Cell
+	})
+	return findings, nil
+}
@@ -0,0 +1,325 @@
+package lint_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/lint"
+	"github.com/bevzzz/nb/pkg/test"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v3"
+	_ "github.com/bevzzz/nb/schema/v4"
+)
+
+// kernel is the metadata of a notebook which passes the kernelspec and language_info checks.
+const kernel = `{"kernelspec": {"name": "python3", "display_name": "Python 3"}, "language_info": {"name": "python"}}`
+
+// notebook decodes a v4.5 notebook with the metadata and cells.
+func notebook(t *testing.T, meta string, cells ...string) schema.Notebook {
+	t.Helper()
+	nb, err := decode.Bytes([]byte(`{"metadata": ` + meta + `, "nbformat": 4, "nbformat_minor": 5, "cells": [` + strings.Join(cells, ",") + `]}`))
+	require.NoError(t, err)
+	return nb
+}
+
+// code creates a code cell with the execution count and outputs. A zero count is saved as null.
+func code(id string, n int, outputs ...string) string {
+	count := "null"
+	if n > 0 {
+		count = strconv.Itoa(n)
+	}
+	return `{"id": "` + id + `", "cell_type": "code", "metadata": {}, "source": "x = 1", "execution_count": ` + count +
+		`, "outputs": [` + strings.Join(outputs, ",") + `]}`
+}
+
+func markdown(id, source, attachments string) string {
+	if attachments == "" {
+		attachments = "{}"
+	}
+	src, _ := json.Marshal(source)
+	return `{"id": "` + id + `", "cell_type": "markdown", "metadata": {}, "source": ` + string(src) + `, "attachments": ` + attachments + `}`
+}
+
+const png = `{"image/png": "iVBORw0KGgo="}`
+
+func TestNotebook(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		nb   func(t *testing.T) schema.Notebook
+		want []lint.Finding
+	}{
+		{
+			name: "clean notebook",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel,
+					markdown("a", "# Plot\n![plot](attachment:plot.png)", `{"plot.png": `+png+`}`),
+					code("b", 1, `{"output_type": "stream", "name": "stdout", "text": "hi"}`),
+					code("c", 2),
+				)
+			},
+		},
+		{
+			name: "cleared notebook",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel, code("a", 0), code("b", 0))
+			},
+		},
+		{
+			name: "out of order",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel, code("a", 2), code("b", 1), code("c", 3))
+			},
+			want: []lint.Finding{
+				{Rule: "unsaved-execution", Severity: lint.Warning, Cell: 0, CellID: "a", Message: "executed as [2], but execution [1] is not saved in the notebook"},
+				{Rule: "execution-order", Severity: lint.Warning, Cell: 1, CellID: "b", Message: "executed as [1] after cell 0 executed as [2]"},
+			},
+		},
+		{
+			name: "gaps in execution counts",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel, code("a", 1), code("b", 4))
+			},
+			want: []lint.Finding{
+				{Rule: "unsaved-execution", Severity: lint.Warning, Cell: 1, CellID: "b", Message: "executed as [4] after [1], 2 execution(s) in between are not saved in the notebook"},
+			},
+		},
+		{
+			name: "missing execution count",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel,
+					code("a", 1),
+					code("b", 0),
+					code("c", 0, `{"output_type": "stream", "name": "stdout", "text": "hi"}`),
+				)
+			},
+			want: []lint.Finding{
+				{Rule: "missing-execution-count", Severity: lint.Warning, Cell: 1, CellID: "b", Message: "was not executed"},
+				{Rule: "missing-execution-count", Severity: lint.Warning, Cell: 2, CellID: "c", Message: "has outputs but no execution count"},
+			},
+		},
+		{
+			name: "error output",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel, code("a", 1,
+					`{"output_type": "stream", "name": "stdout", "text": "hi"}`,
+					`{"output_type": "error", "ename": "ValueError", "evalue": "oops", "traceback": ["\u001b[31mValueError\u001b[0m: oops"]}`,
+				))
+			},
+			want: []lint.Finding{
+				{Rule: "error-output", Severity: lint.Error, Cell: 0, CellID: "a", Message: "output 1 is an error: ValueError: oops"},
+			},
+		},
+		{
+			name: "empty cells",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel,
+					markdown("a", " \n", ""),
+					`{"id": "b", "cell_type": "raw", "metadata": {}, "source": ""}`,
+					`{"id": "c", "cell_type": "code", "metadata": {}, "source": "", "execution_count": null, "outputs": []}`,
+				)
+			},
+			want: []lint.Finding{
+				{Rule: "empty-cell", Severity: lint.Info, Cell: 0, CellID: "a", Message: "markdown cell is empty"},
+				{Rule: "empty-cell", Severity: lint.Info, Cell: 1, CellID: "b", Message: "raw cell is empty"},
+				{Rule: "empty-cell", Severity: lint.Info, Cell: 2, CellID: "c", Message: "code cell is empty"},
+			},
+		},
+		{
+			name: "missing kernel metadata",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, `{}`, code("a", 1))
+			},
+			want: []lint.Finding{
+				{Rule: "missing-kernelspec", Severity: lint.Warning, Cell: -1, Message: "metadata does not specify the kernelspec"},
+				{Rule: "missing-language-info", Severity: lint.Warning, Cell: -1, Message: "metadata does not specify the language_info"},
+			},
+		},
+		{
+			name: "kernel metadata is not needed without code cells",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, `{}`, markdown("a", "text", ""))
+			},
+		},
+		{
+			name: "attachments",
+			nb: func(t *testing.T) schema.Notebook {
+				return notebook(t, kernel,
+					markdown("a", `![a](attachment:a%20b.png) <img src="attachment:gone.png">`, `{"a b.png": `+png+`, "unused.png": `+png+`}`),
+					markdown("b", "![c](attachment:c.png)", ""),
+				)
+			},
+			want: []lint.Finding{
+				{Rule: "unused-attachment", Severity: lint.Warning, Cell: 0, CellID: "a", Message: `attachment "unused.png" is not used`},
+				{Rule: "missing-attachment", Severity: lint.Error, Cell: 0, CellID: "a", Message: `attachment "gone.png" does not exist`},
+				{Rule: "missing-attachment", Severity: lint.Error, Cell: 1, CellID: "b", Message: `attachment "c.png" does not exist`},
+			},
+		},
+		{
+			name: "oversized outputs and attachments",
+			nb: func(t *testing.T) schema.Notebook {
+				big := `"` + strings.Repeat("A", lint.DefaultMaxAttachmentSize) + `"`
+				return notebook(t, kernel,
+					markdown("a", "![a](attachment:a.png)", `{"a.png": {"image/png": `+big+`}}`),
+					code("b", 1, `{"output_type": "display_data", "metadata": {}, "data": {"image/png": `+big+`, "text/plain": "<Figure>"}}`),
+				)
+			},
+			want: []lint.Finding{
+				{Rule: "attachment-size", Severity: lint.Warning, Cell: 0, CellID: "a", Message: `attachment "a.png" is 1.0 MiB, larger than 1.0 MiB`},
+				{Rule: "output-size", Severity: lint.Warning, Cell: 1, CellID: "b", Message: "output 0 is 1.0 MiB, larger than 500.0 KiB"},
+			},
+		},
+		{
+			name: "v3 error output",
+			nb: func(t *testing.T) schema.Notebook {
+				nb, err := decode.Bytes([]byte(`{"metadata": ` + kernel + `, "nbformat": 3, "nbformat_minor": 0, "worksheets": [{"cells": [
+					{"cell_type": "code", "language": "python", "input": "x = 1", "prompt_number": 1, "outputs": [
+						{"output_type": "pyerr", "ename": "ValueError", "evalue": "oops", "traceback": []}
+					]}
+				]}]}`))
+				require.NoError(t, err)
+				return nb
+			},
+			want: []lint.Finding{
+				{Rule: "error-output", Severity: lint.Error, Cell: 0, Message: "output 0 is an error: ValueError: oops"},
+			},
+		},
+		{
+			name: "oversized v3 output",
+			nb: func(t *testing.T) schema.Notebook {
+				// All representations are measured, not only the richest one.
+				big := `"` + strings.Repeat("A", lint.DefaultMaxAttachmentSize) + `"`
+				nb, err := decode.Bytes([]byte(`{"metadata": ` + kernel + `, "nbformat": 3, "nbformat_minor": 0, "worksheets": [{"cells": [
+					{"cell_type": "code", "language": "python", "input": "x = 1", "prompt_number": 1, "outputs": [
+						{"output_type": "pyout", "prompt_number": 1, "metadata": {}, "html": ["<img />"], "text": ` + big + `}
+					]}
+				]}]}`))
+				require.NoError(t, err)
+				return nb
+			},
+			want: []lint.Finding{
+				{Rule: "output-size", Severity: lint.Warning, Cell: 0, Message: "output 0 is 1.0 MiB, larger than 500.0 KiB"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lint.Notebook(tt.nb(t))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNotebook_stream(t *testing.T) {
+	t.Run("every rule sees the cells", func(t *testing.T) {
+		s, err := decode.Reader(strings.NewReader(`{"metadata": ` + kernel + `, "nbformat": 4, "nbformat_minor": 5, "cells": [` +
+			code("a", 1) + "," + code("b", 2, `{"output_type": "error", "ename": "ValueError", "evalue": "oops", "traceback": []}`) + "," +
+			markdown("c", "", "") + `]}`))
+		require.NoError(t, err)
+		defer s.Close()
+
+		got, err := lint.Notebook(s)
+		require.NoError(t, err)
+		require.Equal(t, []lint.Finding{
+			{Rule: "error-output", Severity: lint.Error, Cell: 1, CellID: "b", Message: "output 0 is an error: ValueError: oops"},
+			{Rule: "empty-cell", Severity: lint.Info, Cell: 2, CellID: "c", Message: "markdown cell is empty"},
+		}, got)
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		s, err := decode.Reader(strings.NewReader(`{"metadata": ` + kernel + `, "nbformat": 4, "nbformat_minor": 5, "cells": [` +
+			code("a", 1) + `, {"id": "b", "cell_type": "markdown", "metadata": {}, "source": 1}]}`))
+		require.NoError(t, err)
+		defer s.Close()
+
+		_, err = lint.Notebook(s)
+		require.ErrorContains(t, err, "lint: decode: reader: v4.5: cell 1")
+	})
+}
+
+func TestOptions(t *testing.T) {
+	nb := test.Notebook(
+		test.Markdown(""),
+		&test.CodeCell{
+			Cell:          test.Cell{CellType: schema.Code, Source: []byte("1/0")},
+			TimesExecuted: 1,
+			Out:           []schema.Cell{test.ErrorOutput("ZeroDivisionError: division by zero")},
+		},
+	)
+
+	t.Run("disabled rules", func(t *testing.T) {
+		got, err := lint.Notebook(nb, lint.WithDisabled("empty-cell", "error-output"))
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("severity", func(t *testing.T) {
+		got, err := lint.Notebook(nb, lint.WithDisabled("empty-cell"), lint.WithSeverity("error-output", lint.Warning))
+		require.NoError(t, err)
+		require.Equal(t, []lint.Finding{
+			{Rule: "error-output", Severity: lint.Warning, Cell: 1, Message: "output 0 is an error: ZeroDivisionError: division by zero"},
+		}, got)
+	})
+
+	t.Run("rules replace defaults by name", func(t *testing.T) {
+		custom := lint.Rule{
+			Name:     "no-division",
+			Severity: lint.Info,
+			Check: func(nb schema.Notebook, report lint.Reporter) {
+				for i, c := range nb.Cells() {
+					if strings.Contains(string(c.Text()), "/") {
+						report(i, "divides")
+					}
+				}
+			},
+		}
+		l := lint.New(lint.WithRules(lint.OutputSize(10), custom), lint.WithDisabled("empty-cell", "error-output"))
+
+		got, err := l.Notebook(nb)
+		require.NoError(t, err)
+		require.Equal(t, []lint.Finding{
+			{Rule: "output-size", Severity: lint.Warning, Cell: 1, Message: "output 0 is 35 B, larger than 10 B"},
+			{Rule: "no-division", Severity: lint.Info, Cell: 1, Message: "divides"},
+		}, got)
+		require.Len(t, l.Rules(), len(lint.DefaultRules())-1)
+	})
+}
+
+func TestFinding(t *testing.T) {
+	for _, tt := range []struct {
+		f    lint.Finding
+		want string
+	}{
+		{
+			f:    lint.Finding{Rule: "error-output", Severity: lint.Error, Cell: 3, CellID: "abc", Message: "oops"},
+			want: "cell 3 (abc): error: oops [error-output]",
+		},
+		{
+			f:    lint.Finding{Rule: "empty-cell", Severity: lint.Info, Cell: 0, Message: "empty"},
+			want: "cell 0: info: empty [empty-cell]",
+		},
+		{
+			f:    lint.Finding{Rule: "missing-kernelspec", Severity: lint.Warning, Cell: -1, Message: "missing"},
+			want: "warning: missing [missing-kernelspec]",
+		},
+	} {
+		t.Run(tt.want, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.f.String())
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		b, err := json.Marshal(lint.Finding{Rule: "r", Severity: lint.Warning, Cell: 1, Message: "m"})
+		require.NoError(t, err)
+		require.JSONEq(t, `{"rule": "r", "severity": "warning", "cell": 1, "message": "m"}`, string(b))
+
+		var s lint.Severity
+		require.NoError(t, s.UnmarshalText([]byte("ERROR")))
+		require.Equal(t, lint.Error, s)
+		require.Error(t, s.UnmarshalText([]byte("fatal")))
+	})
+}
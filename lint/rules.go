@@ -0,0 +1,385 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v3 "github.com/bevzzz/nb/schema/v3"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+// ExecutionOrder reports code cells whose execution count is not greater than that of a code cell above them,
+// which means the notebook's outputs may not be reproduced by running it from top to bottom.
+func ExecutionOrder() Rule {
+	return Rule{
+		Name:     "execution-order",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			last, lastCell := 0, -1
+			for i, n := range executionCounts(nb) {
+				if n == 0 {
+					continue
+				}
+				if n <= last {
+					report(i, "executed as [%d] after cell %d executed as [%d]", n, lastCell, last)
+				}
+				if n > last {
+					last, lastCell = n, i
+				}
+			}
+		},
+	}
+}
+
+// UnsavedExecution reports gaps in otherwise ordered execution counts: the cells that were executed
+// in between have since been changed or deleted, so their effect on the outputs is not recorded in the notebook.
+func UnsavedExecution() Rule {
+	return Rule{
+		Name:     "unsaved-execution",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			last := 0
+			for i, n := range executionCounts(nb) {
+				if n == 0 || n <= last {
+					continue
+				}
+				if missing := n - last - 1; missing > 0 {
+					switch {
+					case last == 0 && missing == 1:
+						report(i, "executed as [%d], but execution [1] is not saved in the notebook", n)
+					case last == 0:
+						report(i, "executed as [%d], but executions [1] to [%d] are not saved in the notebook", n, n-1)
+					default:
+						report(i, "executed as [%d] after [%d], %d execution(s) in between are not saved in the notebook", n, last, missing)
+					}
+				}
+				last = n
+			}
+		},
+	}
+}
+
+// MissingExecutionCount reports code cells which have outputs but no execution count,
+// and code cells that were not executed in a notebook where other cells were.
+func MissingExecutionCount() Rule {
+	return Rule{
+		Name:     "missing-execution-count",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			counts := executionCounts(nb)
+			executed := false
+			for _, n := range counts {
+				executed = executed || n > 0
+			}
+
+			for i, c := range nb.Cells() {
+				if c.Type() != schema.Code || counts[i] > 0 {
+					continue
+				}
+				if out, ok := c.(schema.Outputter); ok && len(out.Outputs()) > 0 {
+					report(i, "has outputs but no execution count")
+				} else if executed && !isBlank(c.Text()) {
+					report(i, "was not executed")
+				}
+			}
+		},
+	}
+}
+
+// ErrorOutput reports code cells with error outputs.
+func ErrorOutput() Rule {
+	return Rule{
+		Name:     "error-output",
+		Severity: Error,
+		Check: func(nb schema.Notebook, report Reporter) {
+			for i, c := range nb.Cells() {
+				for j, out := range outputs(c) {
+					if out.Type() == schema.Error {
+						report(i, "output %d is an error: %s", j, errorMessage(out))
+					}
+				}
+			}
+		},
+	}
+}
+
+// OutputSize reports outputs larger than max bytes, counting the data of every representation in rich outputs.
+func OutputSize(max int) Rule {
+	return Rule{
+		Name:     "output-size",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			for i, c := range nb.Cells() {
+				for j, out := range outputs(c) {
+					if n := outputSize(out); n > max {
+						report(i, "output %d is %s, larger than %s", j, formatSize(n), formatSize(max))
+					}
+				}
+			}
+		},
+	}
+}
+
+// AttachmentSize reports cell attachments larger than max bytes, as stored in the notebook's JSON.
+func AttachmentSize(max int) Rule {
+	return Rule{
+		Name:     "attachment-size",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			for i, c := range nb.Cells() {
+				att, _ := attachments(c)
+				for _, name := range sortedNames(att) {
+					if n := bundleSize(att[name]); n > max {
+						report(i, "attachment %q is %s, larger than %s", name, formatSize(n), formatSize(max))
+					}
+				}
+			}
+		},
+	}
+}
+
+// EmptyCell reports cells with no content. Code cells with outputs are not considered empty.
+func EmptyCell() Rule {
+	return Rule{
+		Name:     "empty-cell",
+		Severity: Info,
+		Check: func(nb schema.Notebook, report Reporter) {
+			for i, c := range nb.Cells() {
+				switch c.Type() {
+				case schema.Markdown, schema.Raw, schema.Code:
+				default:
+					continue
+				}
+				if isBlank(c.Text()) && len(outputs(c)) == 0 {
+					report(i, "%s cell is empty", c.Type())
+				}
+			}
+		},
+	}
+}
+
+// Kernelspec reports v4 notebooks with code cells which do not specify the kernel to run them with.
+func Kernelspec() Rule {
+	return Rule{
+		Name:     "missing-kernelspec",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			if meta, ok := kernelMetadata(nb); ok && meta.KernelSpec.Name == "" {
+				report(-1, "metadata does not specify the kernelspec")
+			}
+		},
+	}
+}
+
+// LanguageInfo reports v4 notebooks with code cells which do not specify their programming language.
+// Renderers rely on it to highlight the code.
+func LanguageInfo() Rule {
+	return Rule{
+		Name:     "missing-language-info",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			if meta, ok := kernelMetadata(nb); ok && meta.LanguageInfo.Name == "" {
+				report(-1, "metadata does not specify the language_info")
+			}
+		},
+	}
+}
+
+// UnusedAttachment reports cell attachments which are not referenced in the cell's source.
+func UnusedAttachment() Rule {
+	return Rule{
+		Name:     "unused-attachment",
+		Severity: Warning,
+		Check: func(nb schema.Notebook, report Reporter) {
+			for i, c := range nb.Cells() {
+				att, _ := attachments(c)
+				if len(att) == 0 {
+					continue
+				}
+				used := make(map[string]bool)
+				for _, name := range references(c) {
+					used[name] = true
+				}
+				for _, name := range sortedNames(att) {
+					if !used[name] {
+						report(i, "attachment %q is not used", name)
+					}
+				}
+			}
+		},
+	}
+}
+
+// MissingAttachment reports references to attachments, e.g. ![plot](attachment:plot.png),
+// which are not included in the markdown cell.
+func MissingAttachment() Rule {
+	return Rule{
+		Name:     "missing-attachment",
+		Severity: Error,
+		Check: func(nb schema.Notebook, report Reporter) {
+			for i, c := range nb.Cells() {
+				var att schema.Attachments
+				if ha, ok := c.(schema.HasAttachments); ok {
+					att = ha.Attachments()
+				}
+				for _, name := range references(c) {
+					if att == nil || att.MimeBundle(name) == nil {
+						report(i, "attachment %q does not exist", name)
+					}
+				}
+			}
+		},
+	}
+}
+
+// executionCounts lists the execution count of every cell, which is 0 for cells that are not code cells.
+func executionCounts(nb schema.Notebook) []int {
+	cells := nb.Cells()
+	counts := make([]int, len(cells))
+	for i, c := range cells {
+		if ex, ok := c.(schema.ExecutionCounter); ok && c.Type() == schema.Code {
+			counts[i] = ex.ExecutionCount()
+		}
+	}
+	return counts
+}
+
+func outputs(c schema.Cell) []schema.Cell {
+	if out, ok := c.(schema.Outputter); ok {
+		return out.Outputs()
+	}
+	return nil
+}
+
+func isBlank(b []byte) bool {
+	return strings.TrimSpace(string(b)) == ""
+}
+
+var ansi = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// errorMessage describes the exception, e.g. "ValueError: oops".
+func errorMessage(out schema.Cell) string {
+	var name, value string
+	switch e := out.(type) {
+	case *v4.ErrorOutput:
+		name, value = e.ExceptionName, e.ExceptionValue
+	case *v3.ErrorOutput:
+		name, value = e.ExceptionName, e.ExceptionValue
+	}
+	if name != "" {
+		return strings.TrimSpace(name + ": " + value)
+	}
+	lines := strings.Split(strings.TrimSpace(ansi.ReplaceAllString(string(out.Text()), "")), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// outputSize measures all representations of rich outputs and the text of other outputs.
+func outputSize(out schema.Cell) int {
+	mb, ok := out.(interface {
+		MimeTypes() []string
+		Data(string) []byte
+	})
+	if !ok {
+		return len(out.Text())
+	}
+	n := 0
+	for _, mime := range mb.MimeTypes() {
+		n += len(mb.Data(mime))
+	}
+	return n
+}
+
+func bundleSize(mb common.MimeBundle) (n int) {
+	for _, data := range mb {
+		n += len(data)
+	}
+	return n
+}
+
+// attachments returns the cell's attachments if they can be listed. Like in package encode,
+// only v4.Attachments are supported, as the schema.Attachments interface does not allow listing the files.
+func attachments(c schema.Cell) (v4.Attachments, bool) {
+	ha, ok := c.(schema.HasAttachments)
+	if !ok {
+		return nil, false
+	}
+	att, ok := ha.Attachments().(v4.Attachments)
+	return att, ok
+}
+
+func sortedNames(att v4.Attachments) []string {
+	names := make([]string, 0, len(att))
+	for name := range att {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// attachmentURL matches "attachment:" URLs in markdown links and images, and in HTML attributes.
+var attachmentURL = regexp.MustCompile(`\battachment:([^\s()<>"']+)`)
+
+// references lists the attachments referenced in a markdown cell, in order of their first appearance.
+func references(c schema.Cell) (names []string) {
+	if c.Type() != schema.Markdown {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, m := range attachmentURL.FindAllStringSubmatch(string(c.Text()), -1) {
+		name := m[1]
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type kernelMeta struct {
+	KernelSpec struct {
+		Name string `json:"name"`
+	} `json:"kernelspec"`
+	LanguageInfo struct {
+		Name string `json:"name"`
+	} `json:"language_info"`
+}
+
+// kernelMetadata decodes the notebook's metadata. It reports false for notebooks which do not need
+// a kernel, because they have no code cells, and for those prior to v4, where the keys were not defined.
+func kernelMetadata(nb schema.Notebook) (kernelMeta, bool) {
+	var meta kernelMeta
+	if nb.Version().Major < 4 {
+		return meta, false
+	}
+	hasCode := false
+	for _, c := range nb.Cells() {
+		hasCode = hasCode || c.Type() == schema.Code
+	}
+	if !hasCode {
+		return meta, false
+	}
+	if m, ok := nb.(schema.HasMetadata); ok && len(m.RawMetadata()) > 0 {
+		_ = json.Unmarshal(m.RawMetadata(), &meta)
+	}
+	return meta, true
+}
+
+// formatSize formats the number of bytes in binary units, e.g. "1.5 MiB".
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
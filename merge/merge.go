@@ -0,0 +1,403 @@
+// Package merge implements a three-way merge of Jupyter notebooks.
+//
+// Unlike a textual merge of the JSON documents, which easily produces invalid notebooks,
+// Notebooks merges cells, their sources, outputs, and metadata separately:
+//
+//   - cells are matched between the versions as described in package diff;
+//   - cells inserted in either version are kept, cells deleted in either version are removed,
+//     unless the other version has modified them;
+//   - sources are merged line by line, like git does for text files;
+//   - metadata is merged key by key;
+//   - outputs are taken from the version which changed them; if both did,
+//     the conflict is resolved according to the OutputStrategy.
+//
+// Conflicts which cannot be resolved are recorded in the merged cell: conflicting source lines
+// are surrounded with git-style conflict markers and the cell's metadata lists the conflicting
+// parts under the "merge_conflict" key. Merged notebooks can be written with package encode.
+//
+// The nb-merge command wraps this package in a git merge driver.
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bevzzz/nb/diff"
+	"github.com/bevzzz/nb/schema"
+)
+
+// OutputStrategy resolves conflicting changes to the outputs of a code cell.
+type OutputStrategy int
+
+const (
+	TakeLocal  OutputStrategy = iota // keep local outputs
+	TakeRemote                       // keep remote outputs
+	Clear                            // remove all outputs and reset execution count
+)
+
+func (s OutputStrategy) String() string {
+	switch s {
+	case TakeRemote:
+		return "remote"
+	case Clear:
+		return "clear"
+	}
+	return "local"
+}
+
+// ParseOutputStrategy parses "local", "remote", or "clear".
+func ParseOutputStrategy(s string) (OutputStrategy, error) {
+	for _, strategy := range []OutputStrategy{TakeLocal, TakeRemote, Clear} {
+		if s == strategy.String() {
+			return strategy, nil
+		}
+	}
+	return 0, fmt.Errorf("merge: unknown output strategy %q", s)
+}
+
+type config struct {
+	outputs OutputStrategy
+	diff    []diff.Option
+}
+
+// Option configures the merge.
+type Option func(*config)
+
+// WithOutputStrategy sets the strategy for conflicting outputs. The default is TakeLocal.
+func WithOutputStrategy(s OutputStrategy) Option {
+	return func(cfg *config) {
+		cfg.outputs = s
+	}
+}
+
+// WithDiffOptions configures how cells are matched between the versions.
+func WithDiffOptions(opts ...diff.Option) Option {
+	return func(cfg *config) {
+		cfg.diff = append(cfg.diff, opts...)
+	}
+}
+
+// Conflict describes a change which could not be merged.
+type Conflict struct {
+	// Cell is the index of the cell in the merged notebook or -1 for the notebook metadata.
+	Cell int
+
+	// Part is the part of the cell in conflict: "source", "metadata/<key>", "cell_type",
+	// "deleted-local" or "deleted-remote", when one version deleted the cell and the other modified it.
+	Part string
+}
+
+func (c Conflict) String() string {
+	if c.Cell < 0 {
+		return "notebook: " + c.Part
+	}
+	return fmt.Sprintf("cell %d: %s", c.Cell, c.Part)
+}
+
+// Conflict markers surround the conflicting lines in the merged source.
+const (
+	MarkerLocal  = "<<<<<<< local"
+	MarkerSep    = "======="
+	MarkerRemote = ">>>>>>> remote"
+)
+
+// ConflictKey is the metadata key which lists the conflicting parts of a merged cell.
+const ConflictKey = "merge_conflict"
+
+// Notebooks merges the changes made to base in local and remote.
+// Version of the merged notebook is that of the local notebook.
+// An error is only returned if the cells of a notebook decoded from a stream cannot be read.
+func Notebooks(base, local, remote schema.Notebook, opts ...Option) (*Notebook, error) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// Cells are read once, as schema.CellReader notebooks cannot be read again.
+	for _, nb := range []*schema.Notebook{&base, &local, &remote} {
+		s, err := schema.ReadAll(*nb)
+		if err != nil {
+			return nil, fmt.Errorf("merge: %w", err)
+		}
+		*nb = s
+	}
+	baseCells := base.Cells()
+	l := sides(diff.Notebooks(base, local, cfg.diff...), len(baseCells))
+	r := sides(diff.Notebooks(base, remote, cfg.diff...), len(baseCells))
+
+	meta, keys := mergeMetadata(rawMetadata(base), rawMetadata(local), rawMetadata(remote))
+	m := NewNotebook(local.Version(), meta)
+	for _, k := range keys {
+		m.Conflicts = append(m.Conflicts, Conflict{Cell: -1, Part: metadataPart(k)})
+	}
+
+	for i := 0; i <= len(baseCells); i++ {
+		m.insert(l.inserted[i], r.inserted[i])
+		if i == len(baseCells) {
+			break
+		}
+
+		lc, rc := l.matched[i], r.matched[i]
+		switch {
+		case lc == nil && rc == nil:
+			// Deleted in both.
+		case lc == nil && !rc.changed:
+		case rc == nil && !lc.changed:
+		case lc == nil:
+			m.Add(rc.Cell, "deleted-local")
+		case rc == nil:
+			m.Add(lc.Cell, "deleted-remote")
+		default:
+			c, parts := cfg.mergeCell(baseCells[i], lc.Cell, rc.Cell)
+			m.Add(c, parts...)
+		}
+	}
+	return m, nil
+}
+
+// side describes the changes made in one version relative to the base cells.
+type side struct {
+	matched  []*version      // matched[i] is the version of the base cell i or nil if it was deleted
+	inserted [][]schema.Cell // inserted[i] are the cells inserted before the base cell i
+}
+
+type version struct {
+	schema.Cell
+	changed bool
+}
+
+func sides(d *diff.Notebook, n int) side {
+	s := side{
+		matched:  make([]*version, n),
+		inserted: make([][]schema.Cell, n+1),
+	}
+	next := 0 // next base cell
+	for _, c := range d.Cells {
+		switch c.Op {
+		case diff.Insert:
+			s.inserted[next] = append(s.inserted[next], c.New)
+		case diff.Delete:
+			next = c.OldIndex + 1
+		default:
+			s.matched[c.OldIndex] = &version{Cell: c.New, changed: c.Op == diff.Modify}
+			next = c.OldIndex + 1
+		}
+	}
+	return s
+}
+
+// insert adds cells inserted at the same position in both versions.
+// Cells inserted in both versions are only added once.
+func (m *Notebook) insert(local, remote []schema.Cell) {
+	for _, c := range local {
+		m.Add(c)
+	}
+	for _, c := range remote {
+		var dup bool
+		for _, lc := range local {
+			if lc.Type() == c.Type() && bytes.Equal(lc.Text(), c.Text()) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			m.Add(c)
+		}
+	}
+}
+
+// Add appends a copy of the cell to the notebook. Cells created by this package are added as is.
+// Conflicts in the cell's parts are recorded in the notebook and annotated in the cell.
+func (m *Notebook) Add(c schema.Cell, conflicts ...string) {
+	c, mc := editable(c)
+	if len(conflicts) > 0 {
+		mc.Annotate(conflicts...)
+		for _, part := range conflicts {
+			m.Conflicts = append(m.Conflicts, Conflict{Cell: len(m.Cells()), Part: part})
+		}
+	}
+	m.Append(c)
+}
+
+func (cfg *config) mergeCell(base, local, remote schema.Cell) (schema.Cell, []string) {
+	var conflicts []string
+	c, mc := Copy(local)
+
+	switch {
+	case local.Type() == remote.Type():
+	case local.Type() == base.Type():
+		c, mc = Copy(remote)
+	case remote.Type() != base.Type():
+		conflicts = append(conflicts, "cell_type")
+	}
+
+	src, ok := Text(string(base.Text()), string(local.Text()), string(remote.Text()))
+	mc.Source = []byte(src)
+	if !ok {
+		conflicts = append(conflicts, "source")
+	}
+
+	meta, keys := mergeMetadata(rawMetadata(base), rawMetadata(local), rawMetadata(remote))
+	mc.Meta = meta
+	for _, k := range keys {
+		conflicts = append(conflicts, metadataPart(k))
+	}
+
+	if code, ok := c.(*CodeCell); ok {
+		lo, ro := outputsOf(local), outputsOf(remote)
+		switch bo := outputsOf(base); {
+		case sameOutputs(lo, bo):
+			code.setOutputs(remote)
+		case sameOutputs(ro, bo) || sameOutputs(lo, ro):
+			code.setOutputs(local)
+		case cfg.outputs == TakeRemote:
+			code.setOutputs(remote)
+		case cfg.outputs == Clear:
+			code.Out, code.Count = nil, 0
+		default:
+			code.setOutputs(local)
+		}
+	}
+	return c, conflicts
+}
+
+// Text merges changes to the text line by line, like git does for text files.
+// Conflicting lines are surrounded with conflict markers, in which case ok is false.
+func Text(base, local, remote string) (merged string, ok bool) {
+	switch {
+	case local == remote || remote == base:
+		return local, true
+	case local == base:
+		return remote, true
+	}
+
+	lines, ok := merge3(splitLines(base), diff.Lines(base, local), diff.Lines(base, remote))
+	merged = strings.Join(lines, "\n")
+	if strings.HasSuffix(local, "\n") && merged != "" {
+		merged += "\n"
+	}
+	return merged, ok
+}
+
+// mergeMetadata merges JSON objects key by key. Conflicting keys take the local value
+// and are returned in alphabetical order.
+func mergeMetadata(base, local, remote []byte) (json.RawMessage, []string) {
+	switch {
+	case bytes.Equal(local, remote) || bytes.Equal(remote, base):
+		return local, nil
+	case bytes.Equal(local, base):
+		return remote, nil
+	}
+
+	b, errB := object(base)
+	l, errL := object(local)
+	r, errR := object(remote)
+	if errB != nil || errL != nil || errR != nil {
+		return local, []string{""}
+	}
+
+	merged := make(map[string]json.RawMessage)
+	keys := make(map[string]bool)
+	for _, obj := range []map[string]json.RawMessage{b, l, r} {
+		for k := range obj {
+			keys[k] = true
+		}
+	}
+
+	var conflicts []string
+	for k := range keys {
+		bv, lv, rv := b[k], l[k], r[k]
+		if !equalJSON(lv, rv) && !equalJSON(lv, bv) && !equalJSON(rv, bv) {
+			conflicts = append(conflicts, k)
+		}
+		if v, ok := pick(lv, rv, bv); ok {
+			merged[k] = v
+		}
+	}
+	sort.Strings(conflicts)
+
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return local, []string{""}
+	}
+	return out, conflicts
+}
+
+// object decodes a JSON object. Missing metadata is treated as an empty object.
+func object(data []byte) (obj map[string]json.RawMessage, err error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	err = json.Unmarshal(data, &obj)
+	return
+}
+
+// metadataPart names the conflicting metadata key. An empty key means that
+// the metadata could not be merged at all.
+func metadataPart(key string) string {
+	if key == "" {
+		return "metadata"
+	}
+	return "metadata/" + key
+}
+
+// pick selects the merged value for a key which may be missing from some of the versions.
+// Local value is kept if both versions changed it.
+func pick(local, remote, base json.RawMessage) (json.RawMessage, bool) {
+	v := local
+	if equalJSON(local, base) {
+		v = remote
+	}
+	return v, v != nil
+}
+
+// equalJSON compares JSON values ignoring formatting and key order.
+func equalJSON(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
+
+func rawMetadata(v interface{}) []byte {
+	if m, ok := v.(schema.HasMetadata); ok {
+		return m.RawMetadata()
+	}
+	return nil
+}
+
+func outputsOf(c schema.Cell) []schema.Cell {
+	if out, ok := c.(schema.Outputter); ok {
+		return out.Outputs()
+	}
+	return nil
+}
+
+func sameOutputs(a, b []schema.Cell) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type() != b[i].Type() || a[i].MimeType() != b[i].MimeType() || !bytes.Equal(a[i].Text(), b[i].Text()) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLines splits the text into lines, ignoring the trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
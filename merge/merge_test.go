@@ -0,0 +1,206 @@
+package merge_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/validate"
+)
+
+// v45 decodes a v4.5 notebook with the cells.
+func v45(t *testing.T, metadata string, cells ...string) schema.Notebook {
+	t.Helper()
+	nb, err := decode.Bytes([]byte(`{"metadata": ` + metadata + `, "nbformat": 4, "nbformat_minor": 5, "cells": [` + strings.Join(cells, ",") + `]}`))
+	require.NoError(t, err)
+	return nb
+}
+
+func markdown(id, source string) string {
+	b, _ := json.Marshal(source)
+	return `{"id": "` + id + `", "cell_type": "markdown", "metadata": {}, "source": ` + string(b) + `}`
+}
+
+func code(id, source, outputs string) string {
+	b, _ := json.Marshal(source)
+	return `{"id": "` + id + `", "cell_type": "code", "metadata": {}, "source": ` + string(b) + `, "execution_count": 1, "outputs": [` + outputs + `]}`
+}
+
+func stdout(text string) string {
+	return `{"output_type": "stream", "name": "stdout", "text": "` + text + `"}`
+}
+
+// sources lists the ids and sources of the merged cells.
+func sources(nb schema.Notebook) (got []string) {
+	for _, c := range nb.Cells() {
+		got = append(got, c.(schema.HasID).ID()+": "+string(c.Text()))
+	}
+	return
+}
+
+func TestNotebooks(t *testing.T) {
+	t.Run("cells", func(t *testing.T) {
+		base := v45(t, `{}`, markdown("a", "A"), markdown("b", "B"), markdown("c", "C"), markdown("d", "D"))
+		local := v45(t, `{}`, markdown("a", "A"), markdown("l", "local"), markdown("b", "B"), markdown("d", "D local"))
+		remote := v45(t, `{}`, markdown("r", "remote"), markdown("a", "A"), markdown("c", "C"), markdown("d", "D"))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.Empty(t, m.Conflicts)
+		require.Equal(t, []string{
+			"r: remote",
+			"a: A",
+			"l: local",
+			"d: D local",
+		}, sources(m), "b is deleted remotely, c is deleted locally")
+	})
+
+	t.Run("cell inserted in both versions is added once", func(t *testing.T) {
+		base := v45(t, `{}`, markdown("a", "A"))
+		local := v45(t, `{}`, markdown("a", "A"), markdown("x", "same"))
+		remote := v45(t, `{}`, markdown("a", "A"), markdown("y", "same"))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"a: A", "x: same"}, sources(m))
+	})
+
+	t.Run("source is merged line by line", func(t *testing.T) {
+		base := v45(t, `{}`, markdown("a", "1\n2\n3\n4\n5"))
+		local := v45(t, `{}`, markdown("a", "1 local\n2\n3\n4\n5"))
+		remote := v45(t, `{}`, markdown("a", "1\n2\n3\n4\n5 remote"))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.Empty(t, m.Conflicts)
+		require.Equal(t, []string{"a: 1 local\n2\n3\n4\n5 remote"}, sources(m))
+	})
+
+	t.Run("conflicting source", func(t *testing.T) {
+		base := v45(t, `{}`, markdown("a", "1\n2\n3"))
+		local := v45(t, `{}`, markdown("a", "1\nlocal\n3"))
+		remote := v45(t, `{}`, markdown("a", "1\nremote\n3"))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.Equal(t, []merge.Conflict{{Cell: 0, Part: "source"}}, m.Conflicts)
+		require.Equal(t, []string{"a: 1\n<<<<<<< local\nlocal\n=======\nremote\n>>>>>>> remote\n3"}, sources(m))
+		require.JSONEq(t, `{"merge_conflict": ["source"]}`, string(m.Cells()[0].(schema.HasMetadata).RawMetadata()))
+	})
+
+	t.Run("deleted and modified cell is kept", func(t *testing.T) {
+		base := v45(t, `{}`, markdown("a", "A"), markdown("b", "B"))
+		local := v45(t, `{}`, markdown("a", "A"))
+		remote := v45(t, `{}`, markdown("a", "A"), markdown("b", "B remote"))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.Equal(t, []merge.Conflict{{Cell: 1, Part: "deleted-local"}}, m.Conflicts)
+		require.Equal(t, []string{"a: A", "b: B remote"}, sources(m))
+	})
+
+	t.Run("metadata is merged key by key", func(t *testing.T) {
+		base := v45(t, `{"a": 1, "b": 1, "c": 1}`)
+		local := v45(t, `{"a": 2, "b": 1, "c": 2}`)
+		remote := v45(t, `{"a": 1, "b": 3, "c": 3, "d": 3}`)
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.Equal(t, []merge.Conflict{{Cell: -1, Part: "metadata/c"}}, m.Conflicts)
+		require.JSONEq(t, `{"a": 2, "b": 3, "c": 2, "d": 3}`, string(m.RawMetadata()))
+	})
+
+	t.Run("outputs", func(t *testing.T) {
+		base := v45(t, `{}`, code("a", "x", stdout("base")), code("b", "y", stdout("base")))
+		local := v45(t, `{}`, code("a", "x", stdout("local")), code("b", "y", stdout("local")))
+		remote := v45(t, `{}`, code("a", "x", stdout("base")), code("b", "y", stdout("remote")))
+
+		for _, tt := range []struct {
+			strategy merge.OutputStrategy
+			want     []string // text of the outputs of cell "b"
+		}{
+			{strategy: merge.TakeLocal, want: []string{"local"}},
+			{strategy: merge.TakeRemote, want: []string{"remote"}},
+			{strategy: merge.Clear},
+		} {
+			t.Run(tt.strategy.String(), func(t *testing.T) {
+				m, err := merge.Notebooks(base, local, remote, merge.WithOutputStrategy(tt.strategy))
+				require.NoError(t, err)
+
+				require.Empty(t, m.Conflicts)
+				require.Equal(t, []string{"local"}, outputs(m.Cells()[0]), "only changed locally")
+				require.Equal(t, tt.want, outputs(m.Cells()[1]))
+			})
+		}
+	})
+
+	t.Run("only code cells have outputs", func(t *testing.T) {
+		base := v45(t, `{}`, markdown("a", "A"), code("b", "1", stdout("base")))
+		local := v45(t, `{}`, markdown("a", "A local"), code("b", "1", stdout("base")))
+		remote := v45(t, `{}`, markdown("a", "A"), code("b", "1 remote", stdout("remote")))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+
+		require.IsType(t, &merge.Cell{}, m.Cells()[0])
+		require.Implements(t, (*schema.CodeCell)(nil), m.Cells()[1])
+		_, ok := m.Cells()[0].(schema.Outputter)
+		require.False(t, ok, "markdown cell should not have outputs")
+		require.Equal(t, []string{"remote"}, outputs(m.Cells()[1]))
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		s, err := decode.Reader(strings.NewReader(`{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [` +
+			markdown("a", "A") + `, {"id": "b", "cell_type": "markdown", "metadata": {}, "source": 1}]}`))
+		require.NoError(t, err)
+		defer s.Close()
+		nb := v45(t, `{}`, markdown("a", "A"))
+
+		_, err = merge.Notebooks(s, nb, nb)
+		require.ErrorContains(t, err, "merge: decode: reader: v4.5: cell 1")
+	})
+
+	t.Run("merged notebook is valid", func(t *testing.T) {
+		base := v45(t, `{}`, code("a", "1\n2", stdout("base")))
+		local := v45(t, `{}`, code("a", "1\nlocal", stdout("local")))
+		remote := v45(t, `{}`, code("a", "1\nremote", stdout("remote")))
+
+		m, err := merge.Notebooks(base, local, remote)
+		require.NoError(t, err)
+		b, err := encode.Bytes(m)
+
+		require.NoError(t, err)
+		require.NoError(t, validate.Bytes(b))
+	})
+}
+
+func outputs(c schema.Cell) (got []string) {
+	for _, out := range c.(schema.Outputter).Outputs() {
+		got = append(got, string(out.Text()))
+	}
+	return
+}
+
+func TestParseOutputStrategy(t *testing.T) {
+	for _, s := range []merge.OutputStrategy{merge.TakeLocal, merge.TakeRemote, merge.Clear} {
+		got, err := merge.ParseOutputStrategy(s.String())
+		require.NoError(t, err)
+		require.Equal(t, s, got)
+	}
+
+	_, err := merge.ParseOutputStrategy("theirs")
+	require.Error(t, err)
+}
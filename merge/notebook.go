@@ -0,0 +1,153 @@
+package merge
+
+import (
+	"encoding/json"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// Notebook is the result of a merge.
+type Notebook struct {
+	*schema.Snapshot
+
+	// Conflicts lists the changes which could not be merged in the order of the cells.
+	Conflicts []Conflict
+}
+
+var _ schema.Notebook = (*Notebook)(nil)
+var _ schema.HasMetadata = (*Notebook)(nil)
+
+// NewNotebook creates an empty notebook with the metadata. Use Add to append cells.
+func NewNotebook(v schema.Version, meta []byte) *Notebook {
+	return &Notebook{Snapshot: schema.NewSnapshot(v, meta, nil)}
+}
+
+// Cell is a merged markdown or raw cell. Code cells are merged into a *CodeCell.
+type Cell struct {
+	CellType schema.CellType
+	Mime     string
+	CellID   string
+	Source   []byte
+	Meta     json.RawMessage
+	Att      schema.Attachments
+}
+
+var _ schema.Cell = (*Cell)(nil)
+var _ schema.HasID = (*Cell)(nil)
+var _ schema.HasMetadata = (*Cell)(nil)
+var _ schema.HasAttachments = (*Cell)(nil)
+
+// CodeCell is a merged code cell.
+type CodeCell struct {
+	Cell
+	Lang  string
+	Count int
+	Out   []schema.Cell
+}
+
+var _ schema.CodeCell = (*CodeCell)(nil)
+
+// NewCell copies the parts of the cell which are common to all cell types. Use NewCodeCell
+// to copy code cells along with their outputs, or Copy if the type of the cell is not known.
+func NewCell(c schema.Cell) *Cell {
+	mc := Cell{
+		CellType: c.Type(),
+		Mime:     c.MimeType(),
+		Source:   c.Text(),
+		Meta:     rawMetadata(c),
+	}
+	if hasID, ok := c.(schema.HasID); ok {
+		mc.CellID = hasID.ID()
+	}
+	if att, ok := c.(schema.HasAttachments); ok {
+		mc.Att = att.Attachments()
+	}
+	return &mc
+}
+
+// NewCodeCell copies the code cell's contents, including its outputs and execution count.
+func NewCodeCell(c schema.Cell) *CodeCell {
+	mc := CodeCell{Cell: *NewCell(c)}
+	if code, ok := c.(schema.CodeCell); ok {
+		mc.Lang = code.Language()
+	}
+	mc.setOutputs(c)
+	return &mc
+}
+
+// Copy copies the cell's contents into a *CodeCell for code cells and into a *Cell otherwise.
+// The returned *Cell is the copy itself or the Cell embedded in the *CodeCell, so that
+// the parts common to all cells can be changed regardless of the cell's type.
+func Copy(c schema.Cell) (schema.Cell, *Cell) {
+	if c.Type() == schema.Code {
+		code := NewCodeCell(c)
+		return code, &code.Cell
+	}
+	mc := NewCell(c)
+	return mc, mc
+}
+
+// editable returns the *Cell to modify for cells created by this package and copies other cells.
+func editable(c schema.Cell) (schema.Cell, *Cell) {
+	switch c := c.(type) {
+	case *Cell:
+		return c, c
+	case *CodeCell:
+		return c, &c.Cell
+	}
+	return Copy(c)
+}
+
+// setOutputs copies outputs and execution count of the cell.
+func (c *CodeCell) setOutputs(from schema.Cell) {
+	c.Out, c.Count = outputsOf(from), 0
+	if ex, ok := from.(schema.ExecutionCounter); ok {
+		c.Count = ex.ExecutionCount()
+	}
+}
+
+// Annotate lists the conflicting parts in the cell's metadata under ConflictKey.
+func (c *Cell) Annotate(conflicts ...string) {
+	meta, err := object(c.Meta)
+	if err != nil || meta == nil {
+		meta = make(map[string]json.RawMessage)
+	}
+	meta[ConflictKey], _ = json.Marshal(conflicts)
+	c.Meta, _ = json.Marshal(meta)
+}
+
+func (c *Cell) Type() schema.CellType {
+	return c.CellType
+}
+
+func (c *Cell) MimeType() string {
+	return c.Mime
+}
+
+func (c *Cell) Text() []byte {
+	return c.Source
+}
+
+func (c *Cell) ID() string {
+	return c.CellID
+}
+
+func (c *Cell) RawMetadata() []byte {
+	return c.Meta
+}
+
+func (c *Cell) Attachments() schema.Attachments {
+	return c.Att
+}
+
+func (c *CodeCell) Language() string {
+	return c.Lang
+}
+
+func (c *CodeCell) ExecutionCount() int {
+	return c.Count
+}
+
+func (c *CodeCell) Outputs() []schema.Cell {
+	return c.Out
+}
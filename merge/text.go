@@ -0,0 +1,123 @@
+package merge
+
+import "github.com/bevzzz/nb/diff"
+
+// hunk replaces lines [start, end) of the base text.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// hunks groups consecutive changes in a line diff against the base text.
+func hunks(lines []diff.Line) (hs []hunk) {
+	var pos int
+	var cur *hunk
+	for _, l := range lines {
+		if l.Op == diff.Equal {
+			if cur != nil {
+				hs = append(hs, *cur)
+				cur = nil
+			}
+			pos++
+			continue
+		}
+		if cur == nil {
+			cur = &hunk{start: pos, end: pos}
+		}
+		if l.Op == diff.Delete {
+			pos++
+			cur.end = pos
+		} else {
+			cur.lines = append(cur.lines, l.Text)
+		}
+	}
+	if cur != nil {
+		hs = append(hs, *cur)
+	}
+	return hs
+}
+
+// merge3 applies the changes from both line diffs to the base text.
+// Overlapping or adjacent changes which are not identical are surrounded with conflict markers.
+func merge3(base []string, local, remote []diff.Line) (merged []string, ok bool) {
+	lh, rh := hunks(local), hunks(remote)
+	ok = true
+
+	var pos int
+	for len(lh) > 0 || len(rh) > 0 {
+		// Start the region with the earliest hunk and extend it until no other hunk overlaps.
+		start := -1
+		if len(lh) > 0 {
+			start = lh[0].start
+		}
+		if len(rh) > 0 && (start == -1 || rh[0].start < start) {
+			start = rh[0].start
+		}
+		end := start
+
+		var nl, nr int
+		for grew := true; grew; {
+			grew = false
+			for nl < len(lh) && lh[nl].start <= end {
+				if lh[nl].end > end {
+					end = lh[nl].end
+				}
+				nl++
+				grew = true
+			}
+			for nr < len(rh) && rh[nr].start <= end {
+				if rh[nr].end > end {
+					end = rh[nr].end
+				}
+				nr++
+				grew = true
+			}
+		}
+
+		merged = append(merged, base[pos:start]...)
+		l := apply(base, start, end, lh[:nl])
+		r := apply(base, start, end, rh[:nr])
+		switch {
+		case nr == 0:
+			merged = append(merged, l...)
+		case nl == 0:
+			merged = append(merged, r...)
+		case equal(l, r):
+			merged = append(merged, l...)
+		default:
+			ok = false
+			merged = append(merged, MarkerLocal)
+			merged = append(merged, l...)
+			merged = append(merged, MarkerSep)
+			merged = append(merged, r...)
+			merged = append(merged, MarkerRemote)
+		}
+
+		pos = end
+		lh, rh = lh[nl:], rh[nr:]
+	}
+	return append(merged, base[pos:]...), ok
+}
+
+// apply replaces the lines in base[start:end] according to the hunks.
+func apply(base []string, start, end int, hs []hunk) (out []string) {
+	pos := start
+	for _, h := range hs {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// CellCache stores rendered cells, so that the cells which have not changed since the notebook
+// was last rendered can be written without rendering them again.
+//
+// Implementations must be safe for concurrent use if the renderer is.
+type CellCache interface {
+	// Key identifies the output of the i-th cell. Cells for which ok is false are always rendered.
+	// The key must capture everything the output depends on, including the index if the cell wrapper
+	// is an IndexedWrapper.
+	Key(i int, cell schema.Cell) (key string, ok bool)
+
+	// Get returns the output stored for the key.
+	Get(key string) ([]byte, bool)
+
+	// Put stores the output of a cell which rendered without errors.
+	Put(key string, b []byte)
+}
+
+// WithCellCache reads rendered cells from the cache and stores the ones it does not have.
+//
+// Caching cells is only correct if a cell's output does not depend on the other cells in the notebook.
+// VisitFuncs are called for every cell regardless, as the cells are read before the cache is consulted.
+func WithCellCache(c CellCache) Option {
+	return func(cfg *Config) {
+		cfg.CellCache = c
+	}
+}
+
+// Keyer is implemented by renderers, cell renderers and cell wrappers whose output depends on their options,
+// so that caches of the rendered notebooks can tell different configurations apart.
+type Keyer interface {
+	// CacheKey describes the options. Values which render the same output
+	// must return the same key, and different keys otherwise.
+	CacheKey() string
+}
+
+var _ Keyer = (*renderer)(nil)
+
+// CacheKey describes the configuration of the renderer: the error mode, the types of the cell wrapper
+// and of the cell renderers, and the keys of those which implement Keyer.
+// Functions registered directly with Register are not described.
+func (r *renderer) CacheKey() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "errors=%d", r.config.ErrorMode)
+	describe := func(v interface{}) {
+		fmt.Fprintf(&sb, ";%T", v)
+		if k, ok := v.(Keyer); ok {
+			fmt.Fprintf(&sb, "(%q)", k.CacheKey())
+		}
+	}
+	if r.config.CellWrapper != nil {
+		describe(r.config.CellWrapper)
+	}
+	for _, cr := range r.config.CellRenderers {
+		describe(cr)
+	}
+	return sb.String()
+}
+
+// renderCached writes the i-th cell from the cache, rendering and storing it on a cache miss.
+func (r *renderer) renderCached(ctx context.Context, w io.Writer, i int, cell schema.Cell) error {
+	key, ok := r.cellCache.Key(i, cell)
+	if !ok {
+		return r.wrapCell(ctx, w, i, cell)
+	}
+	if b, ok := r.cellCache.Get(key); ok {
+		_, err := w.Write(b)
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := r.wrapCell(ctx, &buf, i, cell); err != nil {
+		return err
+	}
+	r.cellCache.Put(key, buf.Bytes())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,104 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// job is a cell rendered into an intermediate buffer.
+type job struct {
+	index int
+	cell  schema.Cell
+	buf   bytes.Buffer
+	err   error
+	done  chan struct{}
+}
+
+// renderConcurrent renders cells in a pool of r.concurrency workers and writes them to w in order.
+//
+// Cells are read sequentially and queued in the same order as they're sent to workers.
+// The queue is bounded, so that no more than r.concurrency cells are waiting to be written at a time.
+// Rendering stops on the first error, which is returned after all workers have exited.
+func (r *renderer) renderConcurrent(ctx context.Context, w io.Writer, next func() (schema.Cell, error)) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// Cancel before waiting for the workers, so that they stop when rendering fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *job, r.concurrency)
+	work := make(chan *job)
+
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				j.err = r.renderJob(ctx, j)
+				close(j.done)
+			}
+		}()
+	}
+
+	// Producer reads the cells, as schema.CellReader implementations need not be safe for concurrent use.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(work)
+		defer close(queue)
+
+		for i := 0; ; i++ {
+			cell, err := next()
+			if err == io.EOF {
+				return
+			}
+
+			j := &job{index: i, cell: cell, err: err, done: make(chan struct{})}
+			if err != nil {
+				close(j.done)
+			}
+
+			select {
+			case queue <- j:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+
+			select {
+			case work <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for j := range queue {
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if j.cell == nil {
+			// Failed to read the cell.
+			return j.err
+		}
+		if err := r.flush(ctx, w, j.index, j.cell, &j.buf, j.err); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// renderJob renders the cell into the job's buffer.
+func (r *renderer) renderJob(ctx context.Context, j *job) error {
+	return r.renderCell(ctx, &j.buf, j.index, j.cell)
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// ErrorMode controls how the renderer handles errors returned by RenderCellFuncs and cell wrappers.
+type ErrorMode int
+
+const (
+	// FailFast stops on the first error. Cells for which no RenderCellFunc is registered are skipped.
+	// This is the default mode.
+	FailFast ErrorMode = iota
+
+	// Strict stops on the first error, treating cells for which no RenderCellFunc is registered as errors.
+	Strict
+
+	// Lenient reports errors without stopping. Cells that failed to render are replaced with
+	// a placeholder, if the cell wrapper implements ErrorWrapper, and omitted otherwise.
+	// Errors writing to the output and context cancellation still stop the rendering.
+	Lenient
+)
+
+// ErrNoRenderCellFunc is returned in Strict mode for cells which no registered RenderCellFunc matches.
+var ErrNoRenderCellFunc = errors.New("no RenderCellFunc registered")
+
+// WithStrictErrors stops on the first error and treats cells for which no RenderCellFunc is registered as errors.
+func WithStrictErrors() Option {
+	return func(cfg *Config) {
+		cfg.ErrorMode = Strict
+		cfg.Report = nil
+	}
+}
+
+// WithLenientErrors collects errors into the report instead of failing.
+//
+// Lenient rendering buffers the output of each cell, so that a cell which fails midway
+// does not leave a half-rendered element in the document.
+func WithLenientErrors(report *Report) Option {
+	return func(cfg *Config) {
+		cfg.ErrorMode = Lenient
+		cfg.Report = report
+	}
+}
+
+// ErrorWrapper is implemented by cell wrappers which render placeholders for cells that failed to render.
+type ErrorWrapper interface {
+	// WrapError writes a placeholder for the cell, describing the error.
+	WrapError(io.Writer, schema.Cell, error) error
+}
+
+// Report collects errors which occurred during rendering in Lenient mode.
+// It is safe for concurrent use.
+type Report struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// Errors returns all reported errors in the order they occurred.
+func (r *Report) Errors() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errs...)
+}
+
+// add appends err to the report.
+func (r *Report) add(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+// writeCell renders the i-th cell to w. In Lenient mode the cell is rendered
+// into an intermediate buffer, which allows replacing it with a placeholder on failure.
+func (r *renderer) writeCell(ctx context.Context, w io.Writer, i int, cell schema.Cell) error {
+	if r.errorMode != Lenient {
+		if err := r.renderCell(ctx, w, i, cell); err != nil {
+			return cellError(i, cell, err)
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := r.renderCell(ctx, &buf, i, cell)
+	return r.flush(ctx, w, i, cell, &buf, err)
+}
+
+// flush writes the rendered cell from buf to w.
+// In Lenient mode errors are reported and the cell is replaced with a placeholder.
+func (r *renderer) flush(ctx context.Context, w io.Writer, i int, cell schema.Cell, buf *bytes.Buffer, err error) error {
+	if err != nil {
+		err = cellError(i, cell, err)
+		if r.errorMode != Lenient || ctx.Err() != nil {
+			return err
+		}
+
+		r.report.add(err)
+		buf.Reset()
+		if ew, ok := r.cellWrapper.(ErrorWrapper); ok {
+			if err := ew.WrapError(buf, cell, err); err != nil {
+				return cellError(i, cell, err)
+			}
+		}
+	}
+
+	if _, err := buf.WriteTo(w); err != nil {
+		return fmt.Errorf("nb: render: %w", err)
+	}
+	return nil
+}
+
+// cellError records the index and the ID of the i-th cell in the error.
+// Errors returned when rendering outputs already carry the output's index.
+func cellError(i int, cell schema.Cell, err error) error {
+	var ce *schema.CellError
+	if !errors.As(err, &ce) {
+		ce = &schema.CellError{OutputIndex: -1, Err: err}
+		err = ce
+	}
+	ce.Index = i
+	if c, ok := cell.(schema.HasID); ok {
+		ce.ID = c.ID()
+	}
+	return fmt.Errorf("nb: render: %w", err)
+}
@@ -4,3 +4,9 @@ import _ "embed"
 
 //go:embed styles/jupyter.css
 var jupyterCSS []byte
+
+// CSS returns a copy of the stylesheet which Wrapper writes to the CSSWriter.
+// It is the same for every notebook, so pages which render several notebooks only need it once.
+func CSS() []byte {
+	return append([]byte(nil), jupyterCSS...)
+}
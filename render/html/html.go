@@ -1,6 +1,8 @@
 package html
 
 import (
+	"bytes"
+	"encoding/json"
 	"html"
 	"io"
 
@@ -11,6 +13,14 @@ import (
 
 type Config struct {
 	CSSWriter io.Writer
+
+	// IDPrefix is prepended to the ids of the cells' elements.
+	IDPrefix string
+}
+
+// CacheKey implements render.Keyer. The CSSWriter does not change the rendered cells and is not described.
+func (c Config) CacheKey() string {
+	return "id-prefix=" + c.IDPrefix
 }
 
 type Option func(*Config)
@@ -22,8 +32,17 @@ func WithCSSWriter(w io.Writer) Option {
 	}
 }
 
+// WithIDPrefix sets a prefix for the ids of the cells' elements (see CellID),
+// so that several notebooks can be rendered on the same page without duplicate ids.
+func WithIDPrefix(prefix string) Option {
+	return func(c *Config) {
+		c.IDPrefix = prefix
+	}
+}
+
 // Renderer renders the notebook as HTML.
 // It supports "markdown", "code", and "raw" cells with different mime-types of the their data.
+// Renderer and its Wrapper are safe for concurrent use.
 type Renderer struct {
 	render.CellWrapper
 	cfg Config
@@ -43,6 +62,19 @@ func NewRenderer(opts ...Option) *Renderer {
 	}
 }
 
+// CacheKey implements render.Keyer.
+func (r *Renderer) CacheKey() string {
+	return r.cfg.CacheKey()
+}
+
+// WithIndex implements render.IndexedWrapper for the embedded CellWrapper.
+func (r *Renderer) WithIndex(i int) render.CellWrapper {
+	if iw, ok := r.CellWrapper.(render.IndexedWrapper); ok {
+		return iw.WithIndex(i)
+	}
+	return r.CellWrapper
+}
+
 func (r *Renderer) RegisterFuncs(reg render.RenderCellFuncRegistry) {
 	// r.renderMarkdown should provide exact MimeType to override "text/*".
 	reg.Register(render.Pref{Type: schema.Markdown, MimeType: common.MarkdownText}, r.renderMarkdown)
@@ -53,7 +85,7 @@ func (r *Renderer) RegisterFuncs(reg render.RenderCellFuncRegistry) {
 	reg.Register(render.Pref{MimeType: common.Stderr}, r.renderRaw) // renders both "error" output and "stderr" stream
 
 	// Various types of raw cell contents and display_data/execute_result outputs.
-	reg.Register(render.Pref{MimeType: "application/json"}, r.renderRaw)
+	reg.Register(render.Pref{MimeType: "application/json"}, r.renderJSON)
 	reg.Register(render.Pref{MimeType: "text/*"}, r.renderRaw)
 	reg.Register(render.Pref{MimeType: "text/html"}, r.renderRawHTML)
 	reg.Register(render.Pref{MimeType: "image/*"}, r.renderImage)
@@ -61,54 +93,70 @@ func (r *Renderer) RegisterFuncs(reg render.RenderCellFuncRegistry) {
 
 // renderMarkdown renders markdown cells as pre-formatted text.
 func (r *Renderer) renderMarkdown(w io.Writer, cell schema.Cell) error {
-	io.WriteString(w, "<pre>")
-	w.Write(cell.Text())
-	io.WriteString(w, "</pre>")
-	return nil
+	tag := tagger{Writer: w}
+	tag.WriteString("<pre>")
+	tag.WriteBytes(cell.Text())
+	tag.WriteString("</pre>")
+	return tag.Err()
 }
 
 // renderCode renders the code blob and the code outputs.
 func (r *Renderer) renderCode(w io.Writer, cell schema.Cell) error {
+	tag := tagger{Writer: w}
 	code, ok := cell.(schema.CodeCell)
 	if !ok {
-		io.WriteString(w, "<pre><code>")
-		w.Write(cell.Text())
-		io.WriteString(w, "</code></pre>")
-		return nil
+		tag.WriteString("<pre><code>")
+		tag.WriteBytes(cell.Text())
+		tag.WriteString("</code></pre>")
+		return tag.Err()
 	}
 
-	io.WriteString(w, "<pre><code class=\"language-") // TODO: not sure if that's useful here
-	io.WriteString(w, code.Language())
-	io.WriteString(w, "\">")
-	w.Write(code.Text())
-	io.WriteString(w, "</code></pre>")
-
-	return nil
+	tag.WriteString("<pre><code class=\"language-") // TODO: not sure if that's useful here
+	tag.WriteString(code.Language())
+	tag.WriteString("\">")
+	tag.WriteBytes(code.Text())
+	tag.WriteString("</code></pre>")
+	return tag.Err()
 }
 
 // renderRawHTML writers raw contents of the cell directly to the document.
 func (r *Renderer) renderRawHTML(w io.Writer, cell schema.Cell) error {
-	w.Write(cell.Text())
-	return nil
+	_, err := w.Write(cell.Text())
+	return err
 }
 
 // renderImage writes base64-encoded image data.
 func (r *Renderer) renderImage(w io.Writer, cell schema.Cell) error {
-	io.WriteString(w, "<img src=\"data:")
-	io.WriteString(w, string(cell.MimeType()))
-	io.WriteString(w, ";base64, ")
-	w.Write(cell.Text())
-	io.WriteString(w, "\" />\n")
-	return nil
+	tag := tagger{Writer: w}
+	tag.WriteString("<img src=\"data:")
+	tag.WriteString(cell.MimeType())
+	tag.WriteString(";base64, ")
+	tag.WriteBytes(cell.Text())
+	tag.WriteString("\" />\n")
+	return tag.Err()
+}
+
+// renderJSON writes JSON data compacted, as the indentation it is stored with
+// in the notebook is of no use in the output. Invalid JSON is written as is.
+func (r *Renderer) renderJSON(w io.Writer, cell schema.Cell) error {
+	var buf bytes.Buffer
+	text := cell.Text()
+	if err := json.Compact(&buf, text); err == nil {
+		text = buf.Bytes()
+	}
+	tag := tagger{Writer: w}
+	tag.WriteString("<pre>")
+	tag.WriteString(html.EscapeString(string(text)))
+	tag.WriteString("</pre>")
+	return tag.Err()
 }
 
 // renderRaw writes raw contents of the cell in a new container.
 func (r *Renderer) renderRaw(w io.Writer, cell schema.Cell) error {
-	io.WriteString(w, "<pre>")
-	txt := cell.Text()
+	tag := tagger{Writer: w}
+	tag.WriteString("<pre>")
 	// Escape, because raw text may contain special HTML characters.
-	escaped := html.EscapeString(string(txt[:]))
-	w.Write([]byte(escaped))
-	io.WriteString(w, "</pre>")
-	return nil
+	tag.WriteString(html.EscapeString(string(cell.Text())))
+	tag.WriteString("</pre>")
+	return tag.Err()
 }
@@ -42,6 +42,16 @@ func TestRenderer(t *testing.T) {
 				cell: test.DisplayData(`{"one":1,"two":2}`, "application/json"),
 				want: &node{tag: "pre", content: `{"one":1,"two":2}`},
 			},
+			{
+				name: "indented application/json is compacted",
+				cell: test.DisplayData("{\n    \"one\": [1, 2],\n    \"two\": 2\n}", "application/json"),
+				want: &node{tag: "pre", content: `{"one":[1,2],"two":2}`},
+			},
+			{
+				name: "invalid application/json is kept",
+				cell: test.DisplayData(`{'one': 1}`, "application/json"),
+				want: &node{tag: "pre", content: `{'one': 1}`},
+			},
 			{
 				name: "stream to stdout",
 				cell: test.Stdout("Two o'clock, and all's well!"),
@@ -2,8 +2,10 @@ package html
 
 import (
 	"fmt"
+	stdhtml "html"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/bevzzz/nb/render"
@@ -18,54 +20,121 @@ TODO:
 */
 
 // Wrapper wraps cells in the HTML produced by the original Jupyter's nbconvert.
+//
+// Every cell gets an id (see CellID and WithIDPrefix), which its prompts link to, and data attributes
+// describing the source cell: data-cell-index, data-cell-type, data-execution-count, and data-tags.
+// The index is only known to the wrappers returned by WithIndex, which the renderer uses for every cell.
 type Wrapper struct {
 	Config
+
+	index   int
+	indexed bool // index is set
 }
 
 var _ render.CellWrapper = (*Wrapper)(nil)
+var _ render.ErrorWrapper = (*Wrapper)(nil)
+var _ render.IndexedWrapper = (*Wrapper)(nil)
+
+// WithIndex returns a copy of the wrapper for the i-th cell in the notebook.
+func (wr *Wrapper) WithIndex(i int) render.CellWrapper {
+	cp := *wr
+	cp.index, cp.indexed = i, true
+	return &cp
+}
+
+// CellID returns a stable id for the i-th cell's element. Like in nbconvert, it is "cell-id="
+// followed by the cell's ID for notebooks which have them (v4.5 and later); other cells are
+// identified by their position, e.g. "cell-3". CellID returns an empty string for cells
+// which have no ID if the index is negative.
+func CellID(cell schema.Cell, i int) string {
+	if c, ok := cell.(schema.HasID); ok && c.ID() != "" {
+		return "cell-id=" + c.ID()
+	}
+	if i < 0 {
+		return ""
+	}
+	return "cell-" + strconv.Itoa(i)
+}
 
-func (wr *Wrapper) WrapAll(w io.Writer, render func(io.Writer) error) error {
+// cellID returns the id of the cell's element, prefixed with IDPrefix.
+func (wr *Wrapper) cellID(cell schema.Cell) string {
+	i := -1
+	if wr.indexed {
+		i = wr.index
+	}
+	id := CellID(cell, i)
+	if id == "" {
+		return ""
+	}
+	return wr.IDPrefix + id
+}
+
+func (wr *Wrapper) WrapAll(w io.Writer, render func(io.Writer) error) (err error) {
 	tag := tagger{Writer: w}
-	defer tag.Close()
+	defer tag.Finish(&err)
 
 	if wr.CSSWriter != nil {
-		wr.CSSWriter.Write(jupyterCSS)
+		if _, err := wr.CSSWriter.Write(jupyterCSS); err != nil {
+			return err
+		}
 	}
 
 	tag.Open("div", attributes{"class": {"jp-Notebook"}})
+	if err := tag.Err(); err != nil {
+		return err
+	}
 	return render(w)
 }
 
-func (wr *Wrapper) Wrap(w io.Writer, cell schema.Cell, render render.RenderCellFunc) error {
+func (wr *Wrapper) Wrap(w io.Writer, cell schema.Cell, render render.RenderCellFunc) (err error) {
 	tag := tagger{Writer: w}
-	defer tag.Close()
+	defer tag.Finish(&err)
 
-	var ct string
+	var ct, typ string
 	switch cell.Type() {
 	case schema.Markdown:
-		ct = "jp-MarkdownCell"
+		ct, typ = "jp-MarkdownCell", "markdown"
 	case schema.Code:
-		ct = "jp-CodeCell"
+		ct, typ = "jp-CodeCell", "code"
 		// TODO: if no outputs, add jp-mod-noOutputs class
 	case schema.Raw:
-		ct = "jp-RawCell"
+		ct, typ = "jp-RawCell", "raw"
 	}
 
-	tag.Open("div", attributes{"class": {"jp-Cell", ct, "jp-Notebook-cell"}})
-	render(w, cell)
-	return nil
+	attr := attributes{"class": {"jp-Cell", ct, "jp-Notebook-cell"}}
+	if id := wr.cellID(cell); id != "" {
+		attr["id"] = []interface{}{stdhtml.EscapeString(id)}
+	}
+	if wr.indexed {
+		attr["data-cell-index"] = []interface{}{wr.index}
+	}
+	if typ != "" {
+		attr["data-cell-type"] = []interface{}{typ}
+	}
+	if ex, ok := cell.(schema.ExecutionCounter); ok && ex.ExecutionCount() > 0 {
+		attr["data-execution-count"] = []interface{}{ex.ExecutionCount()}
+	}
+	if tags := schema.Tags(cell); len(tags) > 0 {
+		attr["data-tags"] = []interface{}{stdhtml.EscapeString(strings.Join(tags, " "))}
+	}
+
+	tag.Open("div", attr)
+	if err := tag.Err(); err != nil {
+		return err
+	}
+	return render(w, cell)
 }
 
-func (wr *Wrapper) WrapInput(w io.Writer, cell schema.Cell, render render.RenderCellFunc) error {
+func (wr *Wrapper) WrapInput(w io.Writer, cell schema.Cell, render render.RenderCellFunc) (err error) {
 	tag := tagger{Writer: w}
-	defer tag.Close()
+	defer tag.Finish(&err)
 
 	tag.Open("div", attributes{
 		"class":    {"jp-Cell-inputWrapper"},
 		"tabindex": {0}})
 
 	tag.Open("div", attributes{"class": {"jp-Collapser", "jp-InputCollapser", "jp-Cell-inputCollapser"}})
-	io.WriteString(w, " ")
+	tag.WriteString(" ")
 	tag.CloseLast()
 
 	// TODO: add collapser-child <div class="jp-Collapser-child"></div> and collapsing functionality
@@ -76,7 +145,7 @@ func (wr *Wrapper) WrapInput(w io.Writer, cell schema.Cell, render render.Render
 	// Prompt In:[1]
 	tag.OpenInline("div", attributes{"class": {"jp-InputPrompt", "jp-InputArea-prompt"}})
 	if ex, ok := cell.(interface{ ExecutionCount() int }); ok {
-		fmt.Fprintf(w, "In\u00a0[%d]:", ex.ExecutionCount())
+		wr.writePrompt(&tag, cell, fmt.Sprintf("In\u00a0[%d]:", ex.ExecutionCount()))
 	}
 	tag.CloseLast()
 
@@ -105,13 +174,15 @@ func (wr *Wrapper) WrapInput(w io.Writer, cell schema.Cell, render render.Render
 		})
 	}
 
-	_ = render(w, cell)
-	return nil
+	if err := tag.Err(); err != nil {
+		return err
+	}
+	return render(w, cell)
 }
 
-func (wr *Wrapper) WrapOutput(w io.Writer, cell schema.Outputter, render render.RenderCellFunc) error {
+func (wr *Wrapper) WrapOutput(w io.Writer, cell schema.Outputter, render render.RenderCellFunc) (err error) {
 	tag := tagger{Writer: w}
-	defer tag.Close()
+	defer tag.Finish(&err)
 
 	tag.Open("div", attributes{"class": {"jp-Cell-outputWrapper"}})
 	tag.OpenInline("div", attributes{"class": {"jp-Collapser", "jp-OutputCollapser", "jp-Cell-outputCollapser"}})
@@ -162,7 +233,8 @@ func (wr *Wrapper) WrapOutput(w io.Writer, cell schema.Outputter, render render.
 	tag.OpenInline("div", attributes{"class": {"jp-OutputPrompt", "jp-OutputArea-prompt"}})
 	for _, out := range cell.Outputs() {
 		if ex, ok := out.(interface{ ExecutionCount() int }); ok {
-			fmt.Fprintf(w, "Out\u00a0[%d]:", ex.ExecutionCount())
+			c, _ := cell.(schema.Cell)
+			wr.writePrompt(&tag, c, fmt.Sprintf("Out\u00a0[%d]:", ex.ExecutionCount()))
 			break
 		}
 	}
@@ -172,13 +244,48 @@ func (wr *Wrapper) WrapOutput(w io.Writer, cell schema.Outputter, render render.
 		"class":          {renderedClass, "jp-OutputArea-output", outputtypeclass},
 		"data-mime-type": {datamimetype},
 	})
+	if err := tag.Err(); err != nil {
+		return err
+	}
 	for _, out := range cell.Outputs() {
-		_ = render(w, out)
+		if err := render(w, out); err != nil {
+			return err
+		}
 	}
 	tag.CloseLast()
 	return nil
 }
 
+// writePrompt writes the prompt as a link to the cell's element, if it has an id.
+func (wr *Wrapper) writePrompt(tag *tagger, cell schema.Cell, prompt string) {
+	var id string
+	if cell != nil {
+		id = wr.cellID(cell)
+	}
+	if id == "" {
+		tag.WriteString(prompt)
+		return
+	}
+	tag.WriteString("<a href=\"#" + stdhtml.EscapeString(id) + "\">")
+	tag.WriteString(prompt)
+	tag.WriteString("</a>")
+}
+
+// WrapError renders a placeholder for the cell that failed to render.
+func (wr *Wrapper) WrapError(w io.Writer, cell schema.Cell, cause error) (err error) {
+	tag := tagger{Writer: w}
+	defer tag.Finish(&err)
+
+	tag.Open("div", attributes{"class": {"jp-Cell", "jp-Notebook-cell", "jp-mod-renderError"}})
+	tag.Open("div", attributes{
+		"class":          {"jp-RenderedText", "jp-OutputArea-output"},
+		"data-mime-type": {common.Stderr},
+	})
+	tag.OpenInline("pre", nil)
+	tag.WriteString(stdhtml.EscapeString(cause.Error()))
+	return nil
+}
+
 // tagger is a straightforward utility for writing HTML tags.
 //
 // Example:
@@ -189,9 +296,12 @@ func (wr *Wrapper) WrapOutput(w io.Writer, cell schema.Outputter, render render.
 //	tag.Open("pre", attributes{"class": {"hl", "python"}})
 //
 // tagger also supports empty tags.
+//
+// Once a write fails, tagger stops writing and reports the error in Err.
 type tagger struct {
 	Writer io.Writer
 	opened []string
+	err    error
 }
 
 // Open opens the tag with the attributes.
@@ -206,19 +316,19 @@ func (t *tagger) OpenInline(tag string, attr attributes) {
 
 // Empty creates an empty HTML tag, like <input />.
 func (t *tagger) Empty(tag string, attr attributes) {
-	io.WriteString(t.Writer, "<")
-	io.WriteString(t.Writer, tag)
-	attr.WriteTo(t.Writer)
-	io.WriteString(t.Writer, " />")
+	t.WriteString("<")
+	t.WriteString(tag)
+	t.writeAttributes(attr)
+	t.WriteString(" />")
 }
 
 func (t *tagger) openTag(tag string, attr attributes, newline bool) {
-	io.WriteString(t.Writer, "<")
-	io.WriteString(t.Writer, tag)
-	attr.WriteTo(t.Writer)
-	io.WriteString(t.Writer, ">")
+	t.WriteString("<")
+	t.WriteString(tag)
+	t.writeAttributes(attr)
+	t.WriteString(">")
 	if newline {
-		io.WriteString(t.Writer, "\n")
+		t.WriteString("\n")
 	}
 	t.opened = append(t.opened, tag)
 }
@@ -233,6 +343,7 @@ func (t *tagger) Close() {
 	for i := l - 1; i >= 0; i-- {
 		t.closeTag(t.opened[i])
 	}
+	t.opened = t.opened[:0]
 }
 
 func (t *tagger) CloseLast() {
@@ -244,8 +355,47 @@ func (t *tagger) CloseLast() {
 	t.opened = t.opened[:l-1]
 }
 
+// Finish closes all opened tags and stores the first write error in err, unless it already holds one.
+// It is meant to be deferred in functions with a named error result.
+func (t *tagger) Finish(err *error) {
+	t.Close()
+	if *err == nil {
+		*err = t.err
+	}
+}
+
 func (t *tagger) closeTag(tag string) {
-	fmt.Fprintf(t.Writer, "</%s>\n", tag)
+	t.WriteString("</")
+	t.WriteString(tag)
+	t.WriteString(">\n")
+}
+
+// WriteString writes s unless a previous write has failed.
+func (t *tagger) WriteString(s string) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = io.WriteString(t.Writer, s)
+}
+
+// WriteBytes writes b unless a previous write has failed.
+func (t *tagger) WriteBytes(b []byte) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = t.Writer.Write(b)
+}
+
+func (t *tagger) writeAttributes(attr attributes) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = attr.WriteTo(t.Writer)
+}
+
+// Err returns the first error that occurred while writing.
+func (t *tagger) Err() error {
+	return t.err
 }
 
 type attributes map[string][]interface{}
@@ -2,12 +2,14 @@ package html_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
 
 	stdhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 
 	"github.com/stretchr/testify/require"
 
@@ -35,6 +37,24 @@ func TestWrapper_WrapAll(t *testing.T) {
 	checkDOM(t, &buf, &want)
 }
 
+func TestCSS(t *testing.T) {
+	// Arrange
+	var css bytes.Buffer
+	w := html.Wrapper{Config: html.Config{CSSWriter: &css}}
+
+	// Act
+	err := w.WrapAll(io.Discard, func(w io.Writer) error { return nil })
+	require.NoError(t, err)
+
+	// Assert
+	got := html.CSS()
+	require.NotEmpty(t, got)
+	require.Equal(t, css.Bytes(), got, "stylesheet written by WrapAll")
+
+	got[0] = 0
+	require.NotEqual(t, got, html.CSS(), "CSS should return a copy")
+}
+
 func TestWrapper_Wrap(t *testing.T) {
 	for _, tt := range []struct {
 		name string
@@ -99,6 +119,95 @@ func TestWrapper_Wrap(t *testing.T) {
 	}
 }
 
+func TestWrapper_WithIndex(t *testing.T) {
+	code := &test.CodeCell{Cell: test.Cell{CellType: schema.Code}, TimesExecuted: 3}
+
+	for _, tt := range []struct {
+		name string
+		cell schema.Cell
+		want map[string][]string
+	}{
+		{
+			name: "cell without id is identified by its index",
+			cell: test.Markdown(""),
+			want: map[string][]string{
+				"id":              {"cell-2"},
+				"data-cell-index": {"2"},
+				"data-cell-type":  {"markdown"},
+			},
+		},
+		{
+			name: "cell id is used when present",
+			cell: &identified{CodeCell: code, id: "a1b2", meta: `{"tags": ["hide-input", "<x>"]}`},
+			want: map[string][]string{
+				"id":                   {"cell-id=a1b2"},
+				"data-cell-index":      {"2"},
+				"data-cell-type":       {"code"},
+				"data-execution-count": {"3"},
+				"data-tags":            {"hide-input", "<x>"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var w html.Wrapper
+			var buf bytes.Buffer
+
+			// Act
+			err := w.WithIndex(2).Wrap(&buf, tt.cell, noopRender)
+			require.NoError(t, err)
+
+			// Assert
+			div, err := stdhtml.ParseFragment(&buf, &stdhtml.Node{Type: stdhtml.ElementNode, Data: "body", DataAtom: atom.Body})
+			require.NoError(t, err)
+			require.NotEmpty(t, div)
+			got := make(map[string][]string)
+			for _, attr := range div[0].Attr {
+				if attr.Key != "class" {
+					got[attr.Key] = strings.Split(attr.Val, " ")
+				}
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("prompts link to the cell", func(t *testing.T) {
+		// Arrange
+		var w html.Wrapper
+		var buf bytes.Buffer
+		cell := &identified{CodeCell: &test.CodeCell{
+			Cell:          test.Cell{CellType: schema.Code},
+			TimesExecuted: 3,
+			Out:           []schema.Cell{test.ExecuteResult("", common.PlainText, 3)},
+		}, id: "a1b2"}
+		cw := w.WithIndex(0)
+
+		// Act
+		require.NoError(t, cw.WrapInput(&buf, cell, noopRender))
+		require.NoError(t, cw.WrapOutput(&buf, cell, noopRender))
+
+		// Assert
+		require.Contains(t, buf.String(), "<a href=\"#cell-id=a1b2\">In\u00a0[3]:</a>")
+		require.Contains(t, buf.String(), "<a href=\"#cell-id=a1b2\">Out\u00a0[3]:</a>")
+	})
+}
+
+// identified adds an ID and metadata to a code cell.
+type identified struct {
+	schema.CodeCell
+	id   string
+	meta string
+}
+
+func (c *identified) ID() string          { return c.id }
+func (c *identified) RawMetadata() []byte { return []byte(c.meta) }
+
+func TestCellID(t *testing.T) {
+	require.Equal(t, "cell-id=x", html.CellID(&identified{CodeCell: &test.CodeCell{}, id: "x"}, 1))
+	require.Equal(t, "cell-1", html.CellID(test.Markdown(""), 1))
+	require.Equal(t, "", html.CellID(test.Markdown(""), -1))
+}
+
 func TestWrapper_WrapInput(t *testing.T) {
 	// Common elements
 	collapser := func() *node {
@@ -579,6 +688,67 @@ func (e *htmlDiff) Err() error {
 	return e.err
 }
 
+func TestWrapper_WrapError(t *testing.T) {
+	// Arrange
+	var w html.Wrapper
+	var buf bytes.Buffer
+	want := &node{
+		tag: "div",
+		attr: map[string][]string{
+			"class": {"jp-Cell", "jp-Notebook-cell", "jp-mod-renderError"},
+		},
+		children: []*node{{
+			tag: "div",
+			attr: map[string][]string{
+				"class":          {"jp-RenderedText", "jp-OutputArea-output"},
+				"data-mime-type": {common.Stderr},
+			},
+			children: []*node{{
+				tag:     "pre",
+				content: "cell 1: <oops>",
+			}},
+		}},
+	}
+
+	// Act
+	err := w.WrapError(&buf, test.Markdown(""), fmt.Errorf("cell 1: <oops>"))
+	require.NoError(t, err)
+
+	// Assert
+	checkDOM(t, &buf, want)
+}
+
+func TestWrapper_Errors(t *testing.T) {
+	errRender := errors.New("render failed")
+	failRender := func(io.Writer, schema.Cell) error { return errRender }
+	cell := &test.Cell{CellType: schema.Code}
+
+	t.Run("returns render error", func(t *testing.T) {
+		var w html.Wrapper
+		for name, wrap := range map[string]func() error{
+			"WrapInput":  func() error { return w.WrapInput(io.Discard, cell, failRender) },
+			"WrapOutput": func() error { return w.WrapOutput(io.Discard, outputs{test.Stdout("")}, failRender) },
+			"Wrap":       func() error { return w.Wrap(io.Discard, cell, failRender) },
+		} {
+			require.ErrorIs(t, wrap(), errRender, name)
+		}
+	})
+
+	t.Run("returns write error", func(t *testing.T) {
+		var w html.Wrapper
+		errWrite := errors.New("write failed")
+
+		err := w.WrapInput(failingWriter{errWrite}, cell, noopRender)
+
+		require.ErrorIs(t, err, errWrite)
+	})
+}
+
+// failingWriter fails every write with err.
+type failingWriter struct{ err error }
+
+func (fw failingWriter) Write([]byte) (int, error) { return 0, fw.err }
+
 // node describes the desired DOM structure.
 type node struct {
 	tag      string              // div, span, etc
@@ -1,6 +1,7 @@
 package render
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sort"
@@ -14,8 +15,11 @@ import (
 type Renderer interface {
 	// Render writes the contents of the notebook cells it supports.
 	//
-	// Implementations should not error on cell types, for which no RenderCellFunc is registered.
+	// By default, implementations should not error on cell types, for which no RenderCellFunc is registered.
 	// This is expected, as some [RawCells] will be rendered in some output formats and ignored in others.
+	// The base renderer skips such cells and stops on the first error returned by a RenderCellFunc or
+	// the cell wrapper. Other ErrorModes change that: in Strict mode cells without a RenderCellFunc
+	// fail with ErrNoRenderCellFunc, and in Lenient mode errors are collected in a Report.
 	//
 	// [RawCells]: https://nbformat.readthedocs.io/en/latest/format_description.html#raw-nbconvert-cells
 	Render(io.Writer, schema.Notebook) error
@@ -26,6 +30,14 @@ type Renderer interface {
 	AddOptions(...Option)
 }
 
+// ContextRenderer is implemented by renderers which support cancellation.
+type ContextRenderer interface {
+	// RenderContext is like Render, but stops rendering once ctx is done.
+	// Implementations should check for cancellation between cells and their outputs,
+	// and pass ctx to the RenderCellFuncContext registered for each cell.
+	RenderContext(context.Context, io.Writer, schema.Notebook) error
+}
+
 // CellRenderer registers a RenderCellFunc for every cell type it supports.
 //
 // Reminiscent of the [Visitor] pattern, it allows extending the base renderer
@@ -43,12 +55,48 @@ type RenderCellFuncRegistry interface {
 	Register(Pref, RenderCellFunc)
 }
 
+// ContextRegistry is implemented by registries which accept context-aware RenderCellFuncs.
+// CellRenderers should check for it in RegisterFuncs and fall back to Register otherwise:
+//
+//	if cr, ok := reg.(render.ContextRegistry); ok {
+//		cr.RegisterContext(pref, f)
+//	} else {
+//		reg.Register(pref, func(w io.Writer, c schema.Cell) error {
+//			return f(context.Background(), w, c)
+//		})
+//	}
+type ContextRegistry interface {
+	// RegisterContext adds a context-aware RenderCellFuncContext and a Pref selector for it.
+	// It overrides any function previously registered with the same Pref, context-aware or not.
+	RegisterContext(Pref, RenderCellFuncContext)
+}
+
 // RenderCellFunc writes contents of a specific cell type.
+// The base renderer recovers from panics in RenderCellFuncs and returns them as errors.
 type RenderCellFunc func(io.Writer, schema.Cell) error
 
+// RenderCellFuncContext writes contents of a specific cell type.
+// Long-running implementations should stop and return ctx.Err() once the context is done.
+type RenderCellFuncContext func(context.Context, io.Writer, schema.Cell) error
+
 type Config struct {
 	CellWrapper
 	CellRenderers []CellRenderer
+
+	// Concurrency is the number of cells rendered in parallel. Values less than 2 disable concurrent rendering.
+	Concurrency int
+
+	// ErrorMode controls how rendering errors are handled.
+	ErrorMode ErrorMode
+
+	// Report collects errors in Lenient mode.
+	Report *Report
+
+	// Visitors create a VisitFunc for every rendered notebook.
+	Visitors []func() VisitFunc
+
+	// CellCache stores rendered cells.
+	CellCache CellCache
 }
 
 type Option func(*Config)
@@ -68,6 +116,34 @@ func WithCellRenderers(crs ...CellRenderer) Option {
 	}
 }
 
+// WithConcurrency renders up to n cells in parallel, writing them to the output in their original order.
+//
+// Each cell is rendered into an intermediate buffer, so at most n cells (and their rendered output)
+// are held in memory at a time. Concurrent rendering is opt-in, as it requires that
+// every registered RenderCellFunc and the CellWrapper are safe for concurrent use.
+// This is true for the built-in HTML renderer, but may not be the case for functions
+// provided by the extensions or passed by the client.
+func WithConcurrency(n int) Option {
+	return func(cfg *Config) {
+		cfg.Concurrency = n
+	}
+}
+
+// VisitFunc is called for every cell in the notebook, in order, as the renderer reads it.
+type VisitFunc func(i int, cell schema.Cell)
+
+// WithVisitor registers a function which is called at the start of every Render and returns
+// the VisitFunc for that notebook's cells. This lets extensions collect information about
+// the notebook, e.g. build a search index, in the same pass that renders it.
+//
+// Visitors see every cell, including those for which no RenderCellFunc is registered.
+// A VisitFunc is always called from a single goroutine, even with WithConcurrency.
+func WithVisitor(newVisitor func() VisitFunc) Option {
+	return func(cfg *Config) {
+		cfg.Visitors = append(cfg.Visitors, newVisitor)
+	}
+}
+
 // CellWrapper renders common wrapping elements for every cell type.
 type CellWrapper interface {
 	// Wrap the entire cell.
@@ -85,15 +161,31 @@ type CellWrapper interface {
 	WrapAll(io.Writer, func(io.Writer) error) error
 }
 
+// IndexedWrapper is implemented by cell wrappers which need to know the position of the cell in the notebook,
+// e.g. to give every cell a unique id.
+type IndexedWrapper interface {
+	// WithIndex returns the CellWrapper for the i-th cell. It is called once per cell,
+	// before Wrap, and the returned wrapper is used for that cell only.
+	WithIndex(i int) CellWrapper
+}
+
 // renderer is a base Renderer implementation.
 // It does not support any cell types out of the box and should be extended by the client using the available Options.
+//
+// renderer is safe for concurrent use once it's been configured: its state is initialized
+// during the first call to Render and is never modified afterwards.
 type renderer struct {
 	once   sync.Once
 	config Config
 
+	concurrency        int
+	errorMode          ErrorMode
+	report             *Report
 	cellWrapper        CellWrapper
-	renderCellFuncsTmp map[Pref]RenderCellFunc // renderCellFuncsTmp holds intermediary preference entries.
-	renderCellFuncs    prefs                   // renderCellFuncs is sorted and will only be modified once.
+	visitors           []func() VisitFunc
+	cellCache          CellCache
+	renderCellFuncsTmp map[Pref]RenderCellFuncContext // renderCellFuncsTmp holds intermediary preference entries.
+	renderCellFuncs    prefs                          // renderCellFuncs is sorted and will only be modified once.
 }
 
 var _ RenderCellFuncRegistry = (*renderer)(nil)
@@ -101,14 +193,16 @@ var _ RenderCellFuncRegistry = (*renderer)(nil)
 // NewRenderer extends the base renderer with the passed options.
 func NewRenderer(opts ...Option) Renderer {
 	r := renderer{
-		renderCellFuncsTmp: make(map[Pref]RenderCellFunc),
+		renderCellFuncsTmp: make(map[Pref]RenderCellFuncContext),
 	}
 	r.AddOptions(opts...)
 	return &r
 }
 
 var _ Renderer = (*renderer)(nil)
+var _ ContextRenderer = (*renderer)(nil)
 var _ RenderCellFuncRegistry = (*renderer)(nil)
+var _ ContextRegistry = (*renderer)(nil)
 
 func (r *renderer) AddOptions(opts ...Option) {
 	for _, opt := range opts {
@@ -121,12 +215,25 @@ func (r *renderer) AddOptions(opts ...Option) {
 // Any function registered with the same Pref will be overridden. All configurations
 // should be done the first call to Render(), as later changes will have no effect.
 func (r *renderer) Register(pref Pref, f RenderCellFunc) {
+	r.renderCellFuncsTmp[pref] = func(_ context.Context, w io.Writer, cell schema.Cell) error {
+		return f(w, cell)
+	}
+}
+
+// RegisterContext registers a new RenderCellFuncContext with a preference selector.
+// It follows the same rules as Register.
+func (r *renderer) RegisterContext(pref Pref, f RenderCellFuncContext) {
 	r.renderCellFuncsTmp[pref] = f
 }
 
 func (r *renderer) init() {
 	r.once.Do(func() {
+		r.concurrency = r.config.Concurrency
+		r.errorMode = r.config.ErrorMode
+		r.report = r.config.Report
 		r.cellWrapper = r.config.CellWrapper
+		r.visitors = r.config.Visitors
+		r.cellCache = r.config.CellCache
 		for _, cr := range r.config.CellRenderers {
 			cr.RegisterFuncs(r)
 		}
@@ -144,56 +251,158 @@ func (r *renderer) init() {
 //
 // TODO: use sort.Find? need to try it out, like, because we have a mixed slice, where s[i] > s[i-1] might be true, but then s[i] and s[i-2] are semantically unrelated.
 // Definitely not sort.Search, because sort.Search assumes that all elements >=i satisfy the condition, which is not the case.
-func (r *renderer) render(w io.Writer, cell schema.Cell) error {
+func (r *renderer) render(ctx context.Context, w io.Writer, cell schema.Cell) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	for _, pref := range r.renderCellFuncs {
 		if !pref.Match(cell) {
 			continue
 		}
-		if err := pref.Render(w, cell); err != nil {
+		if err := pref.Render(ctx, w, cell); err != nil {
 			// We could implement a failover mechanism, where, if the first-preference render fails,
 			// we move on to the next matching option. The trouble here is that the first renderer
 			// couldn've already written to io.Writer and we might end up with a corrupted document.
 			//
 			// Using an intermediate buffer buf and copying from it to w on successful render is an option,
 			// but it adds some overhead and I wouldn't take it without a compelling case for this feature.
-			return fmt.Errorf("nb: render: %w", err)
+			return err
 		}
 		return nil
 	}
-	// TODO: currently we silently drop cells for which no render func is registered. Should we error?
+	if r.errorMode == Strict {
+		return fmt.Errorf("%s %q: %w", cell.Type(), cell.MimeType(), ErrNoRenderCellFunc)
+	}
 	return nil
 }
 
 func (r *renderer) Render(w io.Writer, nb schema.Notebook) error {
+	return r.RenderContext(context.Background(), w, nb)
+}
+
+func (r *renderer) RenderContext(ctx context.Context, w io.Writer, nb schema.Notebook) error {
 	r.init()
 
-	for _, cell := range nb.Cells() {
-		var err error
+	next := r.visit(cellIterator(nb))
+	if r.concurrency > 1 {
+		return r.renderConcurrent(ctx, w, next)
+	}
 
-		// TODO: lookup RenderCellFunc before opening the wrapper?
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cell, err := next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := r.writeCell(ctx, w, i, cell); err != nil {
+			return err
+		}
+	}
+}
 
-		if r.cellWrapper != nil {
-			err = r.cellWrapper.Wrap(w, cell, func(w io.Writer, c schema.Cell) error {
-				if err := r.cellWrapper.WrapInput(w, cell, r.render); err != nil {
-					return err
-				}
+// cellIterator returns a function which returns the next cell in the notebook and io.EOF once there are no more cells.
+// Notebooks which decode their cells lazily are read one cell at a time.
+func cellIterator(nb schema.Notebook) func() (schema.Cell, error) {
+	if cr, ok := nb.(schema.CellReader); ok {
+		return cr.ReadCell
+	}
 
-				if out, ok := cell.(interface{ schema.Outputter }); ok {
-					if err := r.cellWrapper.WrapOutput(w, out, r.render); err != nil {
-						return err
-					}
-				}
-				return nil
-			})
-		} else {
-			err = r.render(w, cell)
+	var i int
+	cells := nb.Cells()
+	return func() (schema.Cell, error) {
+		if i >= len(cells) {
+			return nil, io.EOF
 		}
+		i++
+		return cells[i-1], nil
+	}
+}
 
+// visit calls the visitors with every cell returned by next.
+func (r *renderer) visit(next func() (schema.Cell, error)) func() (schema.Cell, error) {
+	if len(r.visitors) == 0 {
+		return next
+	}
+	visit := make([]VisitFunc, len(r.visitors))
+	for i, v := range r.visitors {
+		visit[i] = v()
+	}
+	var i int
+	return func() (schema.Cell, error) {
+		cell, err := next()
 		if err != nil {
-			return err
+			return cell, err
+		}
+		for _, v := range visit {
+			v(i, cell)
 		}
+		i++
+		return cell, nil
 	}
-	return nil
+}
+
+// renderCell renders the i-th cell, reading it from the cell cache, if one is configured.
+//
+// Panics in RenderCellFuncs and the cell wrapper are recovered and returned as errors, regardless of the concurrency:
+// a panic in a worker goroutine would otherwise crash the program without giving the caller a chance to handle it.
+func (r *renderer) renderCell(ctx context.Context, w io.Writer, i int, cell schema.Cell) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	if r.cellCache != nil {
+		return r.renderCached(ctx, w, i, cell)
+	}
+	return r.wrapCell(ctx, w, i, cell)
+}
+
+// wrapCell renders the i-th cell in a cell wrapper, if one is configured.
+// Errors in rendering code cell outputs are annotated with the output's index.
+func (r *renderer) wrapCell(ctx context.Context, w io.Writer, i int, cell schema.Cell) error {
+	// render passes ctx to the RenderCellFuncs and checks for cancellation before every call,
+	// which, for cell wrappers, is before the input and each of the outputs.
+	render := func(w io.Writer, c schema.Cell) error {
+		return r.render(ctx, w, c)
+	}
+
+	// TODO: lookup RenderCellFunc before opening the wrapper?
+
+	if r.cellWrapper == nil {
+		return render(w, cell)
+	}
+	cw := r.cellWrapper
+	if iw, ok := cw.(IndexedWrapper); ok {
+		cw = iw.WithIndex(i)
+	}
+
+	// renderOutput relies on the wrapper rendering outputs in order, one call per output.
+	var n int
+	renderOutput := func(w io.Writer, c schema.Cell) error {
+		i := n
+		n++
+		if err := render(w, c); err != nil {
+			return &schema.CellError{OutputIndex: i, Err: err}
+		}
+		return nil
+	}
+
+	return cw.Wrap(w, cell, func(w io.Writer, c schema.Cell) error {
+		if err := cw.WrapInput(w, cell, render); err != nil {
+			return err
+		}
+
+		if out, ok := cell.(interface{ schema.Outputter }); ok {
+			if err := cw.WrapOutput(w, out, renderOutput); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // Pref describes target cell and mime- type.
@@ -254,10 +463,10 @@ func (p Pref) specificity() (s int) {
 	return
 }
 
-// pref adds RenderCellFunc to Pref to keep Pref hashable.
+// pref adds RenderCellFuncContext to Pref to keep Pref hashable.
 type pref struct {
 	Pref
-	Render RenderCellFunc
+	Render RenderCellFuncContext
 }
 
 // prefs is a RenderCellFunc collection that sorts in the order of descending Pref specificity.
@@ -1,9 +1,16 @@
 package render_test
 
 import (
+	"context"
+	"errors"
 	"io"
+	"math/rand"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bevzzz/nb/pkg/test"
 	"github.com/bevzzz/nb/render"
@@ -105,9 +112,364 @@ func TestRenderer_Render(t *testing.T) {
 
 }
 
+func TestRenderer_RenderContext(t *testing.T) {
+	t.Run("passes context to RenderCellFuncContext", func(t *testing.T) {
+		// Arrange
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "Hi, mom!")
+
+		r := render.NewRenderer()
+		reg := r.(render.ContextRegistry)
+		reg.RegisterContext(render.Pref{Type: schema.Markdown}, func(ctx context.Context, w io.Writer, c schema.Cell) error {
+			io.WriteString(w, ctx.Value(key{}).(string))
+			return nil
+		})
+		var sb strings.Builder
+
+		// Act
+		err := r.(render.ContextRenderer).RenderContext(ctx, &sb, test.Notebook(test.Markdown("")))
+		require.NoError(t, err)
+
+		// Assert
+		if got, want := sb.String(), "Hi, mom!"; got != want {
+			t.Errorf("wrong content: want %q, got %q", want, got)
+		}
+	})
+
+	t.Run("stops between cells and outputs", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			opts []render.Option
+			nb   schema.Notebook
+			want string
+		}{
+			{
+				name: "cells",
+				nb: test.Notebook(
+					test.Markdown("1"),
+					test.Markdown("cancel"),
+					test.Markdown("3"),
+				),
+				want: "1cancel",
+			},
+			{
+				name: "outputs",
+				opts: []render.Option{test.NoWrapper},
+				nb: test.Notebook(
+					&test.CodeCell{
+						Cell: test.Cell{CellType: schema.Code, Source: []byte("1")},
+						Out: []schema.Cell{
+							test.Stdout("cancel"),
+							test.Stdout("3"),
+						},
+					},
+				),
+				want: "1cancel",
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				// Arrange
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				r := render.NewRenderer(tt.opts...)
+				writeOrCancel := func(w io.Writer, c schema.Cell) error {
+					if txt := string(c.Text()); txt == "cancel" {
+						cancel()
+					}
+					w.Write(c.Text())
+					return nil
+				}
+				renderCellFuncs{
+					render.Pref{Type: schema.Markdown}: writeOrCancel,
+					render.Pref{Type: schema.Code}:     writeOrCancel,
+					render.Pref{Type: schema.Stream}:   writeOrCancel,
+				}.RegisterFuncs(r.(render.RenderCellFuncRegistry))
+				var sb strings.Builder
+
+				// Act
+				err := r.(render.ContextRenderer).RenderContext(ctx, &sb, tt.nb)
+
+				// Assert
+				require.ErrorIs(t, err, context.Canceled)
+				if got := sb.String(); got != tt.want {
+					t.Errorf("wrong content: want %q, got %q", tt.want, got)
+				}
+			})
+		}
+	})
+}
+
+func TestRenderer_WithConcurrency(t *testing.T) {
+	// sleepy renders cell's text after a random delay to shuffle the order in which cells are done.
+	sleepy := func(w io.Writer, c schema.Cell) error {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		w.Write(c.Text())
+		return nil
+	}
+
+	t.Run("writes cells in order", func(t *testing.T) {
+		// Arrange
+		var cells []schema.Cell
+		var want strings.Builder
+		for i := 0; i < 100; i++ {
+			s := strconv.Itoa(i) + ","
+			cells = append(cells, test.Markdown(s))
+			want.WriteString(s)
+		}
+
+		r := render.NewRenderer(render.WithConcurrency(8))
+		r.(render.RenderCellFuncRegistry).Register(render.Pref{Type: schema.Markdown}, sleepy)
+		var sb strings.Builder
+
+		// Act
+		err := r.Render(&sb, test.Notebook(cells...))
+		require.NoError(t, err)
+
+		// Assert
+		if got := sb.String(); got != want.String() {
+			t.Errorf("wrong content: want %q, got %q", want.String(), got)
+		}
+	})
+
+	t.Run("stops on first error", func(t *testing.T) {
+		// Arrange
+		errRender := errors.New("render failed")
+		var cells []schema.Cell
+		for i := 0; i < 100; i++ {
+			cells = append(cells, test.Markdown(strconv.Itoa(i)+","))
+		}
+		cells[10] = test.Raw("fail", common.PlainText)
+
+		r := render.NewRenderer(render.WithConcurrency(4))
+		renderCellFuncs{
+			render.Pref{Type: schema.Markdown}: sleepy,
+			render.Pref{Type: schema.Raw}: func(io.Writer, schema.Cell) error {
+				return errRender
+			},
+		}.RegisterFuncs(r.(render.RenderCellFuncRegistry))
+		var sb strings.Builder
+
+		// Act
+		err := r.Render(&sb, test.Notebook(cells...))
+
+		// Assert
+		require.ErrorIs(t, err, errRender)
+		if got, want := sb.String(), "0,1,2,3,4,5,6,7,8,9,"; got != want {
+			t.Errorf("wrong content: want %q, got %q", want, got)
+		}
+	})
+
+	t.Run("recovers from panic", func(t *testing.T) {
+		for _, concurrency := range []int{1, 2} {
+			// Arrange
+			r := render.NewRenderer(render.WithConcurrency(concurrency))
+			r.(render.RenderCellFuncRegistry).Register(render.Pref{Type: schema.Markdown}, func(io.Writer, schema.Cell) error {
+				panic("oops")
+			})
+
+			// Act
+			err := r.Render(io.Discard, test.Notebook(test.Markdown(""), test.Markdown("")))
+
+			// Assert
+			require.ErrorContains(t, err, "panic: oops", "concurrency %d", concurrency)
+		}
+	})
+}
+
+func TestRenderer_IndexedWrapper(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run("concurrency "+strconv.Itoa(concurrency), func(t *testing.T) {
+			// Arrange
+			var cells []schema.Cell
+			for i := 0; i < 20; i++ {
+				cells = append(cells, test.Markdown("x,"))
+			}
+			iw := &indexedWrapper{renderCellFuncs: renderCellFuncs{
+				render.Pref{Type: schema.Markdown}: func(w io.Writer, c schema.Cell) error {
+					_, err := w.Write(c.Text())
+					return err
+				},
+			}}
+			r := render.NewRenderer(render.WithCellRenderers(iw), render.WithConcurrency(concurrency))
+			var sb strings.Builder
+
+			// Act
+			err := r.Render(&sb, test.Notebook(cells...))
+			require.NoError(t, err)
+
+			// Assert
+			var want strings.Builder
+			for i := range cells {
+				want.WriteString(strconv.Itoa(i) + ":x,")
+			}
+			require.Equal(t, want.String(), sb.String())
+		})
+	}
+}
+
+func TestRenderer_ErrorMode(t *testing.T) {
+	errRender := errors.New("render failed")
+	failRaw := renderCellFuncs{
+		render.Pref{Type: schema.Markdown}: func(w io.Writer, c schema.Cell) error {
+			_, err := w.Write(c.Text())
+			return err
+		},
+		render.Pref{Type: schema.Raw}: func(w io.Writer, c schema.Cell) error {
+			io.WriteString(w, "half-rendered")
+			return errRender
+		},
+	}
+	nb := test.Notebook(
+		test.Markdown("a"),
+		test.Raw("", common.PlainText),
+		&test.Cell{CellType: schema.Code},
+		test.Markdown("b"),
+	)
+
+	t.Run("fail fast skips unmatched cells", func(t *testing.T) {
+		r := render.NewRenderer(render.WithCellRenderers(renderCellFuncs{
+			render.Pref{Type: schema.Markdown}: failRaw[render.Pref{Type: schema.Markdown}],
+		}))
+		var sb strings.Builder
+
+		err := r.Render(&sb, nb)
+
+		require.NoError(t, err)
+		require.Equal(t, "ab", sb.String())
+	})
+
+	t.Run("fail fast reports the cell index", func(t *testing.T) {
+		r := render.NewRenderer(render.WithCellRenderers(failRaw))
+
+		err := r.Render(io.Discard, nb)
+
+		require.ErrorIs(t, err, errRender)
+		var cellErr *schema.CellError
+		require.ErrorAs(t, err, &cellErr)
+		require.Equal(t, 1, cellErr.Index, "cell index")
+		require.Equal(t, -1, cellErr.OutputIndex, "output index")
+	})
+
+	t.Run("strict fails on unmatched cells", func(t *testing.T) {
+		r := render.NewRenderer(render.WithStrictErrors(), render.WithCellRenderers(renderCellFuncs{
+			render.Pref{Type: schema.Markdown}: failRaw[render.Pref{Type: schema.Markdown}],
+		}))
+
+		err := r.Render(io.Discard, nb)
+
+		require.ErrorIs(t, err, render.ErrNoRenderCellFunc)
+		require.ErrorContains(t, err, "cell 1")
+	})
+
+	for _, n := range []int{0, 4} {
+		t.Run("lenient collects errors with concurrency "+strconv.Itoa(n), func(t *testing.T) {
+			var report render.Report
+			r := render.NewRenderer(
+				render.WithLenientErrors(&report),
+				render.WithConcurrency(n),
+				render.WithCellRenderers(failRaw),
+			)
+			var sb strings.Builder
+
+			err := r.Render(&sb, nb)
+
+			require.NoError(t, err)
+			require.Equal(t, "ab", sb.String(), "failed cell should be omitted")
+			require.Len(t, report.Errors(), 1)
+			require.ErrorIs(t, report.Errors()[0], errRender)
+		})
+	}
+}
+
+func TestRenderer_WithCellCache(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run("concurrency "+strconv.Itoa(concurrency), func(t *testing.T) {
+			// Arrange
+			var rendered int32
+			iw := &indexedWrapper{renderCellFuncs: renderCellFuncs{
+				render.Pref{Type: schema.Markdown}: func(w io.Writer, c schema.Cell) error {
+					atomic.AddInt32(&rendered, 1)
+					if string(c.Text()) == "fail" {
+						return errors.New("render failed")
+					}
+					_, err := w.Write(c.Text())
+					return err
+				},
+			}}
+			cache := &cellCache{store: make(map[string][]byte)}
+			r := render.NewRenderer(render.WithCellRenderers(iw), render.WithCellCache(cache), render.WithConcurrency(concurrency))
+
+			// Act
+			var first, second strings.Builder
+			err := r.Render(&first, test.Notebook(test.Markdown("a"), test.Markdown("b"), test.Markdown("nocache")))
+			require.NoError(t, err)
+			err = r.Render(&second, test.Notebook(test.Markdown("a"), test.Markdown("c"), test.Markdown("nocache")))
+			require.NoError(t, err)
+			errFail := r.Render(io.Discard, test.Notebook(test.Markdown("fail")))
+
+			// Assert
+			require.Equal(t, "0:a1:b2:nocache", first.String())
+			require.Equal(t, "0:a1:c2:nocache", second.String())
+			require.EqualValues(t, 6, rendered, "unchanged cells should be read from the cache")
+			require.Error(t, errFail)
+			require.Len(t, cache.store, 3, "cells which failed to render or have no key are not cached")
+		})
+	}
+}
+
+// cellCache keys cells by their index and text, except for the ones with the text "nocache".
+type cellCache struct {
+	mu    sync.Mutex
+	store map[string][]byte
+}
+
+var _ render.CellCache = (*cellCache)(nil)
+
+func (c *cellCache) Key(i int, cell schema.Cell) (string, bool) {
+	return strconv.Itoa(i) + ":" + string(cell.Text()), string(cell.Text()) != "nocache"
+}
+
+func (c *cellCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.store[key]
+	return b, ok
+}
+
+func (c *cellCache) Put(key string, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store[key] = append([]byte(nil), b...)
+}
+
 // renderCellFuncs implements render.CellRenderer for a map[render.Pref]render.RenderCellFunc.
 type renderCellFuncs map[render.Pref]render.RenderCellFunc
 
+// indexedWrapper prefixes each cell with its index.
+type indexedWrapper struct {
+	renderCellFuncs
+	index int
+}
+
+var _ render.IndexedWrapper = (*indexedWrapper)(nil)
+
+func (iw *indexedWrapper) WithIndex(i int) render.CellWrapper {
+	return &indexedWrapper{renderCellFuncs: iw.renderCellFuncs, index: i}
+}
+
+func (iw *indexedWrapper) WrapAll(w io.Writer, render func(io.Writer) error) error { return render(w) }
+func (iw *indexedWrapper) Wrap(w io.Writer, c schema.Cell, r render.RenderCellFunc) error {
+	io.WriteString(w, strconv.Itoa(iw.index)+":")
+	return r(w, c)
+}
+func (iw *indexedWrapper) WrapInput(w io.Writer, c schema.Cell, r render.RenderCellFunc) error {
+	return r(w, c)
+}
+func (iw *indexedWrapper) WrapOutput(io.Writer, schema.Outputter, render.RenderCellFunc) error {
+	return nil
+}
+
 var _ render.CellRenderer = new(renderCellFuncs)
 
 func (sr renderCellFuncs) RegisterFuncs(reg render.RenderCellFuncRegistry) {
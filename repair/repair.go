@@ -0,0 +1,227 @@
+// Package repair recovers notebooks which contain git conflict markers.
+//
+// When git merges notebooks as text, conflicting changes are written to the file
+// between "<<<<<<<", "=======", and ">>>>>>>" lines, and the file is no longer valid JSON.
+// Bytes rebuilds both versions of the document ("ours" and "theirs"), decodes them,
+// and merges them back into a valid notebook cell by cell:
+//
+//   - cells which are identical in both versions are kept;
+//   - cells which only exist in one of the versions are kept and annotated with "ours" or "theirs";
+//   - cells which exist in both versions, but differ, are resolved according to the Mode.
+//
+// The notebook metadata and the outputs of conflicting cells are taken from "ours".
+// The base section of the diff3-style conflicts ("|||||||") is ignored.
+package repair
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/diff"
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/schema"
+)
+
+// Mode decides how to resolve cells which differ between the two versions.
+type Mode int
+
+const (
+	// KeepBoth keeps both versions of the cell, one after the other,
+	// annotated with "ours" and "theirs" respectively.
+	KeepBoth Mode = iota
+
+	// Mark keeps a single cell, surrounding the conflicting lines of its source with conflict markers.
+	Mark
+)
+
+// ErrNoConflicts is returned for documents without conflict markers.
+var ErrNoConflicts = errors.New("no conflict markers")
+
+type config struct {
+	mode          Mode
+	decodeOptions []decode.Option
+}
+
+// Option configures the repair.
+type Option func(*config)
+
+// WithMode sets how conflicting cells are resolved. The default is KeepBoth.
+func WithMode(m Mode) Option {
+	return func(cfg *config) {
+		cfg.mode = m
+	}
+}
+
+// WithDecodeOptions configures how both versions of the document are decoded.
+func WithDecodeOptions(opts ...decode.Option) Option {
+	return func(cfg *config) {
+		cfg.decodeOptions = append(cfg.decodeOptions, opts...)
+	}
+}
+
+// HasConflicts reports whether the document contains git conflict markers.
+func HasConflicts(b []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, len(b)+1)
+	for sc.Scan() {
+		if marker(sc.Text()) == start {
+			return true
+		}
+	}
+	return false
+}
+
+// Bytes repairs a notebook with git conflict markers. The returned notebook
+// lists the cells which needed resolution in its Conflicts and can be written with package encode.
+// Documents without conflict markers are rejected with ErrNoConflicts.
+func Bytes(b []byte, opts ...Option) (*merge.Notebook, error) {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	oursJSON, theirsJSON, err := split(b)
+	if err != nil {
+		return nil, fmt.Errorf("repair: %w", err)
+	}
+	ours, err := decode.Bytes(oursJSON, cfg.decodeOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("repair: ours: %w", err)
+	}
+	theirs, err := decode.Bytes(theirsJSON, cfg.decodeOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("repair: theirs: %w", err)
+	}
+	return cfg.resolve(ours, theirs), nil
+}
+
+// resolve merges two versions of the notebook without a common base.
+func (cfg *config) resolve(ours, theirs schema.Notebook) *merge.Notebook {
+	var meta []byte
+	if m, ok := ours.(schema.HasMetadata); ok {
+		meta = m.RawMetadata()
+	}
+	nb := merge.NewNotebook(ours.Version(), meta)
+
+	for _, c := range diff.Notebooks(ours, theirs).Cells {
+		switch c.Op {
+		case diff.Equal:
+			nb.Add(c.Old)
+		case diff.Delete:
+			nb.Add(c.Old, "ours")
+		case diff.Insert:
+			nb.Add(c.New, "theirs")
+		case diff.Modify:
+			if cfg.mode == KeepBoth {
+				nb.Add(c.Old, "ours")
+				nb.Add(c.New, "theirs")
+				continue
+			}
+
+			// Lines common to both versions serve as the base, so that only the differences are marked.
+			var common []string
+			for _, l := range c.Source {
+				if l.Op == diff.Equal {
+					common = append(common, l.Text)
+				}
+			}
+			cell, mc := merge.Copy(c.Old)
+			src, ok := merge.Text(strings.Join(common, "\n"), string(c.Old.Text()), string(c.New.Text()))
+			mc.Source = []byte(src)
+			if ok {
+				nb.Add(cell)
+			} else {
+				nb.Add(cell, "source")
+			}
+		}
+	}
+	return nb
+}
+
+type markerType int
+
+const (
+	none markerType = iota
+	start
+	base
+	sep
+	end
+)
+
+// marker detects conflict marker lines, which start with 7 marker characters
+// optionally followed by a space and a label, e.g. "<<<<<<< HEAD".
+func marker(line string) markerType {
+	line = strings.TrimSuffix(line, "\r")
+	for _, m := range []struct {
+		prefix string
+		typ    markerType
+	}{
+		{"<<<<<<<", start},
+		{"|||||||", base},
+		{"=======", sep},
+		{">>>>>>>", end},
+	} {
+		if line == m.prefix || strings.HasPrefix(line, m.prefix+" ") {
+			return m.typ
+		}
+	}
+	return none
+}
+
+// split rebuilds "ours" and "theirs" versions of the document.
+func split(b []byte) (ours, theirs []byte, err error) {
+	var o, t bytes.Buffer
+	state := none
+	var found bool
+	var lineno, opened int
+
+	for len(b) > 0 {
+		lineno++
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			i = len(b) - 1
+		}
+		line := b[:i+1]
+		b = b[i+1:]
+
+		m := marker(strings.TrimSuffix(string(line), "\n"))
+		switch {
+		case m == start && state == none:
+			state, found, opened = start, true, lineno
+			continue
+		case m == base && state == start:
+			state = base
+			continue
+		case m == sep && (state == start || state == base):
+			state = sep
+			continue
+		case m == end && state == sep:
+			state = none
+			continue
+		case m != none:
+			return nil, nil, fmt.Errorf("line %d: unexpected conflict marker %.7q", lineno, line)
+		}
+
+		switch state {
+		case none:
+			o.Write(line)
+			t.Write(line)
+		case start:
+			o.Write(line)
+		case sep:
+			t.Write(line)
+		}
+	}
+
+	if state != none {
+		return nil, nil, fmt.Errorf("line %d: unterminated conflict", opened)
+	}
+	if !found {
+		return nil, nil, ErrNoConflicts
+	}
+	return o.Bytes(), t.Bytes(), nil
+}
@@ -0,0 +1,129 @@
+package repair_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/encode"
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/repair"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/validate"
+)
+
+// conflicted is a notebook after a textual merge: cell "b" was modified in both branches
+// and cell "c" was only added in "theirs".
+const conflicted = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "id": "a",
+   "metadata": {},
+   "source": ["same"]
+  },
+  {
+   "cell_type": "markdown",
+   "id": "b",
+   "metadata": {},
+<<<<<<< HEAD
+   "source": ["1\n", "ours\n", "3"]
+  }
+=======
+   "source": ["1\n", "theirs\n", "3"]
+  },
+  {
+   "cell_type": "markdown",
+   "id": "c",
+   "metadata": {},
+   "source": ["new"]
+  }
+>>>>>>> feature
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`
+
+// sources lists the ids and sources of the cells.
+func sources(nb schema.Notebook) (got []string) {
+	for _, c := range nb.Cells() {
+		got = append(got, c.(schema.HasID).ID()+": "+string(c.Text()))
+	}
+	return
+}
+
+func TestBytes(t *testing.T) {
+	t.Run("keep both", func(t *testing.T) {
+		nb, err := repair.Bytes([]byte(conflicted))
+		require.NoError(t, err)
+
+		require.Equal(t, []string{
+			"a: same",
+			"b: 1\nours\n3",
+			"b: 1\ntheirs\n3",
+			"c: new",
+		}, sources(nb))
+		require.Equal(t, []merge.Conflict{
+			{Cell: 1, Part: "ours"},
+			{Cell: 2, Part: "theirs"},
+			{Cell: 3, Part: "theirs"},
+		}, nb.Conflicts)
+
+		b, err := encode.Bytes(nb)
+		require.NoError(t, err)
+		require.NoError(t, validate.Bytes(b), "duplicate ids are made unique")
+	})
+
+	t.Run("mark", func(t *testing.T) {
+		nb, err := repair.Bytes([]byte(conflicted), repair.WithMode(repair.Mark))
+		require.NoError(t, err)
+
+		require.Equal(t, []string{
+			"a: same",
+			"b: 1\n<<<<<<< local\nours\n=======\ntheirs\n>>>>>>> remote\n3",
+			"c: new",
+		}, sources(nb))
+		require.Equal(t, []merge.Conflict{
+			{Cell: 1, Part: "source"},
+			{Cell: 2, Part: "theirs"},
+		}, nb.Conflicts)
+	})
+
+	t.Run("diff3 base section is ignored", func(t *testing.T) {
+		diff3 := strings.Replace(conflicted, "=======\n", "||||||| base\n   \"source\": [\"1\\n\", \"2\\n\", \"3\"]\n  }\n=======\n", 1)
+
+		nb, err := repair.Bytes([]byte(diff3))
+		require.NoError(t, err)
+
+		require.Len(t, nb.Cells(), 4)
+	})
+
+	for _, tt := range []struct {
+		name string
+		doc  string
+		want error
+	}{
+		{name: "no conflicts", doc: `{"nbformat": 4, "nbformat_minor": 5, "metadata": {}, "cells": []}`, want: repair.ErrNoConflicts},
+		{name: "unterminated conflict", doc: strings.Replace(conflicted, ">>>>>>> feature\n", "", 1)},
+		{name: "unexpected marker", doc: strings.Replace(conflicted, "<<<<<<< HEAD\n", "", 1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repair.Bytes([]byte(tt.doc))
+
+			require.Error(t, err)
+			if tt.want != nil {
+				require.True(t, errors.Is(err, tt.want))
+			}
+		})
+	}
+}
+
+func TestHasConflicts(t *testing.T) {
+	require.True(t, repair.HasConflicts([]byte(conflicted)))
+	require.False(t, repair.HasConflicts([]byte(`{"source": ["<<<<<<< not a marker"]}`)))
+}
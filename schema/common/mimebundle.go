@@ -0,0 +1,127 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// MimeBundle contains rich output data keyed by mime-type.
+//
+// Each representation is kept as raw JSON and is only decoded when accessed.
+// Text-based data, which nbformat allows to store either as a string or as an array of lines,
+// is unquoted and joined, while JSON data ("application/json" and "+json" mime-types)
+// is returned verbatim, preserving the original formatting and key order.
+type MimeBundle map[string]json.RawMessage
+
+var _ schema.MimeBundle = (*MimeBundle)(nil)
+
+// richness lists mime-types in the order of preference. Mime-types not in the list
+// are preferred to "text/plain" only and are sorted alphabetically between themselves.
+var richness = []string{
+	"text/html",
+	"image/svg+xml",
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"text/markdown",
+	"text/latex",
+	"application/x-latex",
+	"application/json",
+	"application/javascript",
+	"text/javascript",
+	"application/pdf",
+}
+
+// MimeType returns the richest of the mime-types present in the bundle,
+// and falls back to "text/plain" otherwise.
+func (mb MimeBundle) MimeType() string {
+	for _, mime := range richness {
+		if _, ok := mb[mime]; ok {
+			return mime
+		}
+	}
+
+	var other []string
+	for mime := range mb {
+		if mime != PlainText {
+			other = append(other, mime)
+		}
+	}
+	if len(other) > 0 {
+		sort.Strings(other)
+		return other[0]
+	}
+	return PlainText
+}
+
+// Text returns data with the richer mime-type.
+func (mb MimeBundle) Text() []byte {
+	return mb.Data(mb.MimeType())
+}
+
+// Data returns mime-type-specific content if present and a nil slice otherwise.
+// Multiline strings are joined, JSON values are returned verbatim.
+func (mb MimeBundle) Data(mime string) []byte {
+	raw, ok := mb[mime]
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	if IsJSON(mime) {
+		return raw
+	}
+	return multilineText(raw)
+}
+
+// Raw returns the raw JSON value stored for the mime-type.
+func (mb MimeBundle) Raw(mime string) json.RawMessage {
+	return mb[mime]
+}
+
+// MimeTypes lists all mime-types in the bundle in alphabetical order.
+func (mb MimeBundle) MimeTypes() []string {
+	mimes := make([]string, 0, len(mb))
+	for mime := range mb {
+		mimes = append(mimes, mime)
+	}
+	sort.Strings(mimes)
+	return mimes
+}
+
+// PlainText returns data for "text/plain" mime-type and a nil slice otherwise.
+func (mb MimeBundle) PlainText() []byte {
+	return mb.Data(PlainText)
+}
+
+// IsJSON reports whether the data for the mime-type is stored as a JSON value rather than a (multiline) string.
+func IsJSON(mime string) bool {
+	return mime == "application/json" || strings.HasSuffix(mime, "+json")
+}
+
+// multilineText decodes raw JSON string or string array.
+// Values of other types are returned verbatim.
+func multilineText(raw json.RawMessage) []byte {
+	switch raw[0] {
+	case '"':
+		// Strings without escape sequences, e.g. base64-encoded images,
+		// can be unquoted without allocating a new slice.
+		if bytes.IndexByte(raw, '\\') == -1 {
+			return raw[1 : len(raw)-1]
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil
+		}
+		return []byte(s)
+	case '[':
+		var s MultilineString
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil
+		}
+		return s.Text()
+	}
+	return raw
+}
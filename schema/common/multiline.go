@@ -1,45 +1,57 @@
 package common
 
 import (
+	"bytes"
 	"encoding/json"
-	"reflect"
+	"fmt"
 )
 
 // MultilineString stores multi-line text as strings or string arrays in the raw JSON.
-// TODO(optimization): check if we can scan into [][]byte directly
 type MultilineString []string
 
 func (s *MultilineString) UnmarshalJSON(data []byte) error {
-	var nums interface{}
-	err := json.Unmarshal(data, &nums)
-	if err != nil {
-		return err
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 {
+		return nil
 	}
 
-	items := reflect.ValueOf(nums)
-	switch items.Kind() {
-	case reflect.String:
-		*s = append(*s, items.String())
-
-	case reflect.Slice:
-		*s = make(MultilineString, 0, items.Len())
-		for i := 0; i < items.Len(); i++ {
-			item := items.Index(i)
-			switch item.Kind() {
-			case reflect.String:
-				*s = append(*s, item.String())
-			case reflect.Interface:
-				*s = append(*s, item.Interface().(string))
-			}
+	switch data[0] {
+	case '"':
+		var line string
+		if err := json.Unmarshal(data, &line); err != nil {
+			return err
+		}
+		*s = MultilineString{line}
+	case '[':
+		var lines []string
+		if err := json.Unmarshal(data, &lines); err != nil {
+			return err
 		}
+		*s = lines
+	case 'n': // null
+		*s = nil
+	default:
+		return fmt.Errorf("multiline string: unexpected JSON value %.10q", data)
 	}
 	return nil
 }
 
 // Text concatenates all lines in a multiline string into a single byte slice.
-func (s MultilineString) Text() (txt []byte) {
+func (s MultilineString) Text() []byte {
+	switch len(s) {
+	case 0:
+		return nil
+	case 1:
+		return []byte(s[0])
+	}
+
+	var n int
+	for _, line := range s {
+		n += len(line)
+	}
+	txt := make([]byte, 0, n)
 	for _, line := range s {
 		txt = append(txt, line...)
 	}
-	return
+	return txt
 }
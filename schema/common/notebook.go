@@ -12,6 +12,12 @@ type Notebook struct {
 	Metadata     json.RawMessage `json:"metadata"` // TODO: omitempty
 }
 
+var _ schema.HasMetadata = (*Notebook)(nil)
+
+func (n *Notebook) RawMetadata() []byte {
+	return n.Metadata
+}
+
 func (n *Notebook) Version() schema.Version {
 	return schema.Version{
 		Major: n.VersionMajor,
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"encoding/json"
+
+	"github.com/bevzzz/nb/schema"
+)
+
+// UnrecognizedJSON is a custom mime-type for cells and outputs of unrecognized types.
+const UnrecognizedJSON = "application/vnd.nb.unrecognized+json"
+
+// Unrecognized is a cell or an output whose type is not defined in the notebook's schema,
+// e.g. one produced by a newer frontend or an extension. It keeps the original JSON,
+// so that it can be inspected or written back unchanged.
+type Unrecognized struct {
+	// Kind is the reported "cell_type" or "output_type".
+	Kind string
+
+	// Raw is the original JSON of the cell or output.
+	Raw json.RawMessage
+}
+
+var _ schema.Cell = (*Unrecognized)(nil)
+
+// NewUnrecognized copies the raw JSON of an unrecognized cell or output.
+func NewUnrecognized(kind string, raw []byte) *Unrecognized {
+	return &Unrecognized{Kind: kind, Raw: append(json.RawMessage(nil), raw...)}
+}
+
+func (u *Unrecognized) Type() schema.CellType {
+	return schema.Unrecognized
+}
+
+func (u *Unrecognized) MimeType() string {
+	return UnrecognizedJSON
+}
+
+func (u *Unrecognized) Text() []byte {
+	return u.Raw
+}
+
+// PeekType reads the value of the type key, e.g. "cell_type", decoding only the top-level keys of the object.
+func PeekType(data []byte, key string) (kind string, ok bool) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", false
+	}
+	if err := json.Unmarshal(obj[key], &kind); err != nil {
+		return "", false
+	}
+	return kind, true
+}
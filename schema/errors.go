@@ -0,0 +1,39 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CellError records the location of a cell or output that could not be decoded or rendered.
+// Use errors.As to retrieve it from the errors returned by the decode and render packages.
+type CellError struct {
+	// Index is the position of the cell in the notebook.
+	Index int
+
+	// ID is the cell's ID. It is only available for cells which implement HasID.
+	ID string
+
+	// OutputIndex is the position of the output in the code cell, or -1 if the error is not specific to an output.
+	OutputIndex int
+
+	Err error
+}
+
+func (e *CellError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "cell %d", e.Index)
+	if e.ID != "" {
+		fmt.Fprintf(&sb, " (id %q)", e.ID)
+	}
+	if e.OutputIndex >= 0 {
+		fmt.Fprintf(&sb, ": output %d", e.OutputIndex)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(e.Err.Error())
+	return sb.String()
+}
+
+func (e *CellError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,83 @@
+package schema
+
+// Snapshot is a notebook held in memory. Unlike notebooks decoded from a stream (see CellReader),
+// its cells can be read any number of times, so packages which rewrite notebooks before they are
+// rendered or encoded return their results as snapshots.
+type Snapshot struct {
+	version Version
+	meta    []byte
+	cells   []Cell
+}
+
+var _ Notebook = (*Snapshot)(nil)
+var _ HasMetadata = (*Snapshot)(nil)
+
+// NewSnapshot creates a notebook with the metadata and the cells. The cells are not copied.
+func NewSnapshot(v Version, meta []byte, cells []Cell) *Snapshot {
+	return &Snapshot{version: v, meta: meta, cells: cells}
+}
+
+// ReadAll reads the cells of the notebook into memory. Snapshots are returned as is.
+// Notebooks which report the errors that occur while reading cells with an Err method,
+// like the streams returned by decode.Reader, are checked after the cells are read.
+func ReadAll(nb Notebook) (*Snapshot, error) {
+	if s, ok := nb.(*Snapshot); ok {
+		return s, nil
+	}
+	s := Snapshot{version: nb.Version(), cells: nb.Cells()}
+	if e, ok := nb.(interface{ Err() error }); ok {
+		if err := e.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if m, ok := nb.(HasMetadata); ok {
+		s.meta = m.RawMetadata()
+	}
+	return &s, nil
+}
+
+// MapCells reads the cells of the notebook once and replaces every cell with the one returned by f.
+// The cells are only copied if f replaces any of them, so the original notebook is never modified.
+// MapCells stops on the first error returned by f or by ReadAll.
+func MapCells(nb Notebook, f func(i int, cell Cell) (Cell, error)) (*Snapshot, error) {
+	s, err := ReadAll(nb)
+	if err != nil {
+		return nil, err
+	}
+	cells := s.cells
+	copied := false
+	for i, cell := range s.cells {
+		c, err := f(i, cell)
+		if err != nil {
+			return nil, err
+		}
+		if c == cell {
+			continue
+		}
+		if !copied {
+			cells, copied = append([]Cell(nil), cells...), true
+		}
+		cells[i] = c
+	}
+	if !copied {
+		return s, nil
+	}
+	return NewSnapshot(s.version, s.meta, cells), nil
+}
+
+func (s *Snapshot) Version() Version {
+	return s.version
+}
+
+func (s *Snapshot) Cells() []Cell {
+	return s.cells
+}
+
+func (s *Snapshot) RawMetadata() []byte {
+	return s.meta
+}
+
+// Append adds the cells to the end of the notebook.
+func (s *Snapshot) Append(cells ...Cell) {
+	s.cells = append(s.cells, cells...)
+}
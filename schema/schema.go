@@ -30,6 +30,14 @@ type Notebook interface {
 	Cells() []Cell
 }
 
+// CellReader is implemented by notebooks which decode their cells lazily.
+// Consumers should prefer it to Cells() when processing large notebooks,
+// as it allows discarding each cell once it's no longer needed.
+type CellReader interface {
+	// ReadCell returns the next cell in the notebook and io.EOF once there are no more cells.
+	ReadCell() (Cell, error)
+}
+
 type NotebookMetadata interface {
 	// Language reports the language of the document's associated kernel.
 	Language() string
@@ -51,6 +59,20 @@ type HasAttachments interface {
 	Attachments() Attachments
 }
 
+// HasID is implemented by cells which carry a [cell ID].
+//
+// [cell ID]: https://jupyter.org/enhancement-proposals/62-cell-id/cell-id.html
+type HasID interface {
+	// ID is only defined for v4.5 and above and may be omitted in the JSON. Cells without an ID should return "".
+	ID() string
+}
+
+// HasMetadata is implemented by notebooks and cells which keep their raw JSON metadata.
+type HasMetadata interface {
+	// RawMetadata returns the "metadata" object as it appears in the document or nil if it is omitted.
+	RawMetadata() []byte
+}
+
 // CellType reports the intended cell type to the components that work
 // with notebook cells through the Cell interface.
 //
@@ -0,0 +1,31 @@
+package schema
+
+import "encoding/json"
+
+// Tags returns the [tags] listed in the cell's metadata, or nil if the cell has none
+// or its metadata cannot be read.
+//
+// [tags]: https://nbformat.readthedocs.io/en/latest/format_description.html#cell-metadata
+func Tags(cell Cell) []string {
+	m, ok := cell.(HasMetadata)
+	if !ok || len(m.RawMetadata()) == 0 {
+		return nil
+	}
+	var meta struct {
+		Tags []string `json:"tags"`
+	}
+	if json.Unmarshal(m.RawMetadata(), &meta) != nil {
+		return nil
+	}
+	return meta.Tags
+}
+
+// HasTag reports whether the tag is listed in the cell's metadata.
+func HasTag(cell Cell, tag string) bool {
+	for _, t := range Tags(cell) {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -19,10 +19,20 @@ import (
 )
 
 func init() {
-	d := new(decoder)
-	decode.RegisterDecoder(schema.Version{Major: 3, Minor: 0}, d)
-	decode.RegisterDecoder(schema.Version{Major: 2, Minor: 0}, d)
-	decode.RegisterDecoder(schema.Version{Major: 1, Minor: 0}, d)
+	Register(decode.DefaultRegistry())
+}
+
+// Register adds the decoder for v3.0, v2.0, and v1.0 to the registry.
+func Register(r *decode.Registry) {
+	d := NewDecoder()
+	r.Register(schema.Version{Major: 3, Minor: 0}, d)
+	r.Register(schema.Version{Major: 2, Minor: 0}, d)
+	r.Register(schema.Version{Major: 1, Minor: 0}, d)
+}
+
+// NewDecoder returns a decoder for v3.0 and earlier versions.
+func NewDecoder() decode.Decoder {
+	return new(decoder)
 }
 
 // decoder decodes cell contents and metadata for nbformat v3.0, v2.0, and v1.0.
@@ -30,46 +40,73 @@ type decoder struct{}
 
 var _ decode.Decoder = (*decoder)(nil)
 
-func (d *decoder) ExtractCells(data []byte) ([]json.RawMessage, error) {
-	var raw struct {
-		Worksheets []struct {
-			Cells []json.RawMessage `json:"cells"`
-		} `json:"worksheets"`
-	}
-	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, err
-	}
-
-	var cells []json.RawMessage
-	for i := range raw.Worksheets {
-		cells = append(cells, raw.Worksheets[i].Cells...)
-	}
-	return cells, nil
-}
-
 func (d *decoder) DecodeMeta(data []byte) (schema.NotebookMetadata, error) {
 	return nil, nil
 }
 
-func (d *decoder) DecodeCell(m map[string]interface{}, data []byte, meta schema.NotebookMetadata) (schema.Cell, error) {
-	var ct interface{}
-	var c schema.Cell
-	switch ct = m["cell_type"]; ct {
+// DecodeCell decodes the cell in a single pass and then selects its concrete type.
+func (d *decoder) DecodeCell(data []byte, meta schema.NotebookMetadata) (schema.Cell, error) {
+	var raw cell
+	if err := json.Unmarshal(data, &raw); err != nil {
+		// Cells of unknown types may define fields which clash with the known ones.
+		if kind, ok := common.PeekType(data, "cell_type"); ok && !isCellType(kind) {
+			return common.NewUnrecognized(kind, data), nil
+		}
+		return nil, decode.LocateOutputError(data, err, new(Output).UnmarshalJSON)
+	}
+
+	switch raw.CellType {
 	case "markdown":
-		c = &Markdown{}
+		return &Markdown{Source: raw.Source}, nil
 	case "heading":
-		c = &Heading{}
+		return &Heading{Markdown: Markdown{Source: raw.Source}, Level: raw.Level}, nil
 	case "raw":
-		c = &Raw{}
+		c := Raw{Source: raw.Source}
+		if len(raw.Metadata) > 0 {
+			if err := json.Unmarshal(raw.Metadata, &c.Metadata); err != nil {
+				return nil, fmt.Errorf("raw: %w", err)
+			}
+		}
+		return &c, nil
 	case "code":
-		c = &Code{}
-	default:
-		return nil, fmt.Errorf("unknown cell type %q", ct)
+		return &Code{
+			Source:        raw.Input,
+			TimesExecuted: raw.PromptNumber,
+			Out:           raw.Outputs,
+			Lang:          raw.Language,
+		}, nil
 	}
-	if err := json.Unmarshal(data, &c); err != nil {
-		return nil, fmt.Errorf("%s: %w", ct, err)
+	return common.NewUnrecognized(raw.CellType, data), nil
+}
+
+// isCellType reports whether the cell type is defined in the schema.
+func isCellType(kind string) bool {
+	switch kind {
+	case "markdown", "heading", "raw", "code":
+		return true
+	}
+	return false
+}
+
+// isOutputType reports whether the output type is defined in the schema.
+func isOutputType(kind string) bool {
+	switch kind {
+	case "stream", "display_data", "pyout", "pyerr":
+		return true
 	}
-	return c, nil
+	return false
+}
+
+// cell is a union of the fields of all cell types.
+type cell struct {
+	CellType     string                 `json:"cell_type"`
+	Source       common.MultilineString `json:"source"`
+	Metadata     json.RawMessage        `json:"metadata"`
+	Level        int                    `json:"level"`
+	Input        common.MultilineString `json:"input"`
+	Language     string                 `json:"language"`
+	PromptNumber int                    `json:"prompt_number"`
+	Outputs      []Output               `json:"outputs"`
 }
 
 type (
@@ -138,31 +175,109 @@ type Output struct {
 	cell schema.Cell
 }
 
+// NewOutput wraps an output cell, e.g. a copy of a decoded output with modified contents.
+func NewOutput(cell schema.Cell) Output {
+	return Output{cell: cell}
+}
+
+// output is a union of the fields of all output types.
+type output struct {
+	OutputType     string          `json:"output_type"`
+	Stream         string          `json:"stream"`
+	Metadata       json.RawMessage `json:"metadata"`
+	PromptNumber   int             `json:"prompt_number"`
+	ExceptionName  string          `json:"ename"`
+	ExceptionValue string          `json:"evalue"`
+	Traceback      []string        `json:"traceback"`
+
+	// Prior to v4.0 mime-bundle data was stored on the output object
+	// and keyed by a short name instead of the full mime-type.
+	PNG        json.RawMessage `json:"png"`
+	JPEG       json.RawMessage `json:"jpeg"`
+	HTML       json.RawMessage `json:"html"`
+	SVG        json.RawMessage `json:"svg"`
+	Javascript json.RawMessage `json:"javascript"`
+	JSON       json.RawMessage `json:"json"`
+	PDF        json.RawMessage `json:"pdf"`
+	LaTeX      json.RawMessage `json:"latex"`
+	Txt        json.RawMessage `json:"text"`
+}
+
+// mimeBundle collects the data stored on the output in a mime-bundle.
+func (out *output) mimeBundle() (MimeBundle, error) {
+	mb := make(MimeBundle)
+	for mime, raw := range map[string]json.RawMessage{
+		"image/png":           out.PNG,
+		"image/jpeg":          out.JPEG,
+		"text/html":           out.HTML,
+		"image/svg+xml":       out.SVG,
+		"text/javascript":     out.Javascript,
+		"application/pdf":     out.PDF,
+		"application/x-latex": out.LaTeX,
+		common.PlainText:      out.Txt,
+	} {
+		if len(raw) > 0 {
+			mb[mime] = raw
+		}
+	}
+
+	// JSON data is stored as a multiline string, which needs to be decoded
+	// to be consistent with the later versions that store the JSON object directly.
+	// Text which is not valid JSON is kept as a JSON string, so that the bundle remains valid JSON.
+	if len(out.JSON) > 0 {
+		var s common.MultilineString
+		if err := json.Unmarshal(out.JSON, &s); err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+		text := s.Text()
+		if !json.Valid(text) {
+			text, _ = json.Marshal(string(text))
+		}
+		mb["application/json"] = text
+	}
+	return mb, nil
+}
+
 func (out *Output) UnmarshalJSON(data []byte) error {
-	var v map[string]interface{}
-	if err := json.Unmarshal(data, &v); err != nil {
+	var raw output
+	if err := json.Unmarshal(data, &raw); err != nil {
+		if kind, ok := common.PeekType(data, "output_type"); ok && !isOutputType(kind) {
+			out.cell = common.NewUnrecognized(kind, data)
+			return nil
+		}
 		return fmt.Errorf("code outputs: %w", err)
 	}
 
-	var t interface{}
-	var c schema.Cell
-	switch t = v["output_type"]; t {
+	switch raw.OutputType {
 	case "stream":
-		c = &StreamOutput{}
-	case "display_data":
-		c = &DisplayDataOutput{}
-	case "pyout":
-		c = &ExecuteResultOutput{}
+		// Stream text shares the "text" key with the plain text representation in the mime-bundle.
+		stream := StreamOutput{Target: raw.Stream}
+		if len(raw.Txt) > 0 {
+			if err := json.Unmarshal(raw.Txt, &stream.Source); err != nil {
+				return fmt.Errorf("%q output: %w", raw.OutputType, err)
+			}
+		}
+		out.cell = &stream
+	case "display_data", "pyout":
+		mb, err := raw.mimeBundle()
+		if err != nil {
+			return fmt.Errorf("%q output: %w", raw.OutputType, err)
+		}
+		dd := DisplayDataOutput{MimeBundle: mb, Metadata: raw.Metadata}
+		if raw.OutputType == "display_data" {
+			out.cell = &dd
+			break
+		}
+		out.cell = &ExecuteResultOutput{DisplayDataOutput: dd, TimesExecuted: raw.PromptNumber}
 	case "pyerr":
-		c = &ErrorOutput{}
+		out.cell = &ErrorOutput{
+			ExceptionName:  raw.ExceptionName,
+			ExceptionValue: raw.ExceptionValue,
+			Traceback:      raw.Traceback,
+		}
 	default:
-		return fmt.Errorf("unknown output type %q", t)
-	}
-
-	if err := json.Unmarshal(data, &c); err != nil {
-		return fmt.Errorf("%q output: %w", t, err)
+		out.cell = common.NewUnrecognized(raw.OutputType, data)
 	}
-	out.cell = c
 	return nil
 }
 
@@ -198,88 +313,22 @@ func (stream *StreamOutput) Text() []byte {
 // DisplayDataOutput are rich-format outputs generated by running the code in the parent cell.
 type DisplayDataOutput struct {
 	MimeBundle
-	Metadata map[string]interface{} `json:"metadata"`
+	Metadata json.RawMessage `json:"metadata"`
 }
 
 var _ schema.Cell = (*DisplayDataOutput)(nil)
+var _ schema.HasMetadata = (*DisplayDataOutput)(nil)
 
 func (dd *DisplayDataOutput) Type() schema.CellType {
 	return schema.DisplayData
 }
 
-// MimeBundle contains rich output data keyed by mime-type.
-type MimeBundle struct {
-	PNG        common.MultilineString `json:"png,omitempty"`
-	JPEG       common.MultilineString `json:"jpeg,omitempty"`
-	HTML       common.MultilineString `json:"html,omitempty"`
-	SVG        common.MultilineString `json:"svg,omitempty"`
-	Javascript common.MultilineString `json:"javascript,omitempty"`
-	JSON       common.MultilineString `json:"json,omitempty"`
-	PDF        common.MultilineString `json:"pdf,omitempty"`
-	LaTeX      common.MultilineString `json:"latex,omitempty"`
-	Txt        common.MultilineString `json:"text,omitempty"`
-}
-
-var _ schema.MimeBundle = (*MimeBundle)(nil)
-
-// MimeType returns the richer of the mime-types present in the bundle,
-// and falls back to "text/plain" otherwise.
-func (mb MimeBundle) MimeType() string {
-	switch {
-	case mb.PNG != nil:
-		return "image/png"
-	case mb.JPEG != nil:
-		return "image/jpeg"
-	case mb.HTML != nil:
-		return "text/html"
-	case mb.SVG != nil:
-		return "image/svg+xml"
-	case mb.Javascript != nil:
-		return "text/javascript"
-	case mb.JSON != nil:
-		return "application/json"
-	case mb.PDF != nil:
-		return "application/pdf"
-	case mb.LaTeX != nil:
-		return "application/x-latex"
-	}
-	return common.PlainText
+func (dd *DisplayDataOutput) RawMetadata() []byte {
+	return dd.Metadata
 }
 
-// Text returns data with the richer mime-type.
-func (mb MimeBundle) Text() []byte {
-	return mb.Data(mb.MimeType())
-}
-
-// Data returns mime-type-specific content if present and a nil slice otherwise.
-func (mb MimeBundle) Data(mime string) []byte {
-	switch mime {
-	case "image/png":
-		return mb.PNG.Text()
-	case "image/jpeg":
-		return mb.JPEG.Text()
-	case "text/html":
-		return mb.HTML.Text()
-	case "image/svg+xml":
-		return mb.SVG.Text()
-	case "text/javascript":
-		return mb.Javascript.Text()
-	case "application/json":
-		return mb.JSON.Text()
-	case "application/pdf":
-		return mb.PDF.Text()
-	case "application/x-latex":
-		return mb.LaTeX.Text()
-	case common.PlainText:
-		return mb.Txt.Text()
-	}
-	return nil
-}
-
-// PlainText returns data for "text/plain" mime-type and a nil slice otherwise.
-func (mb MimeBundle) PlainText() []byte {
-	return mb.Data(common.PlainText)
-}
+// MimeBundle contains rich output data keyed by mime-type.
+type MimeBundle = common.MimeBundle
 
 // ExecuteResultOutput is the result of executing the code in the cell.
 // Its contents are identical to those of DisplayDataOutput with the addition of the execution count.
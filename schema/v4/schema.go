@@ -17,13 +17,20 @@ import (
 )
 
 func init() {
-	d := new(decoder)
-	decode.RegisterDecoder(schema.Version{Major: 4, Minor: 5}, d)
-	decode.RegisterDecoder(schema.Version{Major: 4, Minor: 4}, d)
-	decode.RegisterDecoder(schema.Version{Major: 4, Minor: 3}, d)
-	decode.RegisterDecoder(schema.Version{Major: 4, Minor: 2}, d)
-	decode.RegisterDecoder(schema.Version{Major: 4, Minor: 1}, d)
-	decode.RegisterDecoder(schema.Version{Major: 4, Minor: 0}, d)
+	Register(decode.DefaultRegistry())
+}
+
+// Register adds the decoder for v4.0 through v4.5 to the registry.
+func Register(r *decode.Registry) {
+	d := NewDecoder()
+	for minor := 0; minor <= 5; minor++ {
+		r.Register(schema.Version{Major: 4, Minor: minor}, d)
+	}
+}
+
+// NewDecoder returns a decoder for v4.0 and later minor versions.
+func NewDecoder() decode.Decoder {
+	return new(decoder)
 }
 
 // decoder decodes cell contents and metadata for nbformat v4.0.
@@ -31,16 +38,6 @@ type decoder struct{}
 
 var _ decode.Decoder = (*decoder)(nil)
 
-func (d *decoder) ExtractCells(data []byte) ([]json.RawMessage, error) {
-	var raw struct {
-		Cells []json.RawMessage `json:"cells"`
-	}
-	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, err
-	}
-	return raw.Cells, nil
-}
-
 func (d *decoder) DecodeMeta(data []byte) (schema.NotebookMetadata, error) {
 	var nm NotebookMetadata
 	if err := json.Unmarshal(data, &nm); err != nil {
@@ -49,23 +46,81 @@ func (d *decoder) DecodeMeta(data []byte) (schema.NotebookMetadata, error) {
 	return &nm, nil
 }
 
-func (d *decoder) DecodeCell(m map[string]interface{}, data []byte, meta schema.NotebookMetadata) (schema.Cell, error) {
-	var ct interface{}
-	var c schema.Cell
-	switch ct = m["cell_type"]; ct {
+// DecodeCell decodes the cell in a single pass and then selects its concrete type.
+func (d *decoder) DecodeCell(data []byte, meta schema.NotebookMetadata) (schema.Cell, error) {
+	var raw cell
+	if err := json.Unmarshal(data, &raw); err != nil {
+		// Cells of unknown types may define fields which clash with the known ones.
+		if kind, ok := common.PeekType(data, "cell_type"); ok && !isCellType(kind) {
+			return common.NewUnrecognized(kind, data), nil
+		}
+		return nil, decode.LocateOutputError(data, err, new(Output).UnmarshalJSON)
+	}
+
+	switch raw.CellType {
 	case "markdown":
-		c = &Markdown{}
+		return &Markdown{
+			Markdown: common.Markdown{Source: raw.Source},
+			CellID:   raw.ID,
+			Att:      raw.Attachments,
+			Meta:     raw.Metadata,
+		}, nil
 	case "raw":
-		c = &Raw{}
+		c := Raw{
+			Raw:    common.Raw{Source: raw.Source},
+			CellID: raw.ID,
+			Att:    raw.Attachments,
+			Meta:   raw.Metadata,
+		}
+		if len(raw.Metadata) > 0 {
+			if err := json.Unmarshal(raw.Metadata, &c.Metadata); err != nil {
+				return nil, fmt.Errorf("raw: %w", err)
+			}
+		}
+		return &c, nil
 	case "code":
-		c = &Code{Lang: meta.Language()}
-	default:
-		return nil, fmt.Errorf("unknown cell type %q", ct)
+		c := Code{
+			CellID:        raw.ID,
+			Source:        raw.Source,
+			TimesExecuted: raw.ExecutionCount,
+			Out:           raw.Outputs,
+			Meta:          raw.Metadata,
+		}
+		if meta != nil {
+			c.Lang = meta.Language()
+		}
+		return &c, nil
 	}
-	if err := json.Unmarshal(data, &c); err != nil {
-		return nil, fmt.Errorf("%s: %w", ct, err)
+	return common.NewUnrecognized(raw.CellType, data), nil
+}
+
+// isCellType reports whether the cell type is defined in the schema.
+func isCellType(kind string) bool {
+	switch kind {
+	case "markdown", "raw", "code":
+		return true
 	}
-	return c, nil
+	return false
+}
+
+// isOutputType reports whether the output type is defined in the schema.
+func isOutputType(kind string) bool {
+	switch kind {
+	case "stream", "display_data", "execute_result", "error":
+		return true
+	}
+	return false
+}
+
+// cell is a union of the fields of all cell types.
+type cell struct {
+	ID             string                 `json:"id"`
+	CellType       string                 `json:"cell_type"`
+	Source         common.MultilineString `json:"source"`
+	Metadata       json.RawMessage        `json:"metadata"`
+	Attachments    Attachments            `json:"attachments"`
+	ExecutionCount int                    `json:"execution_count"`
+	Outputs        []Output               `json:"outputs"`
 }
 
 type NotebookMetadata struct {
@@ -84,10 +139,22 @@ func (nm *NotebookMetadata) Language() string {
 // Markdown defines the schema for a "markdown" cell.
 type Markdown struct {
 	common.Markdown
-	Att Attachments `json:"attachments,omitempty"`
+	CellID string          `json:"id,omitempty"`
+	Att    Attachments     `json:"attachments,omitempty"`
+	Meta   json.RawMessage `json:"-"`
 }
 
 var _ schema.HasAttachments = (*Markdown)(nil)
+var _ schema.HasID = (*Markdown)(nil)
+var _ schema.HasMetadata = (*Markdown)(nil)
+
+func (md *Markdown) ID() string {
+	return md.CellID
+}
+
+func (md *Markdown) RawMetadata() []byte {
+	return md.Meta
+}
 
 func (md *Markdown) Attachments() schema.Attachments {
 	return md.Att
@@ -96,10 +163,22 @@ func (md *Markdown) Attachments() schema.Attachments {
 // Raw defines the schema for a "raw" cell.
 type Raw struct {
 	common.Raw
-	Att Attachments `json:"attachments,omitempty"`
+	CellID string          `json:"id,omitempty"`
+	Att    Attachments     `json:"attachments,omitempty"`
+	Meta   json.RawMessage `json:"-"`
 }
 
 var _ schema.HasAttachments = (*Raw)(nil)
+var _ schema.HasID = (*Raw)(nil)
+var _ schema.HasMetadata = (*Raw)(nil)
+
+func (raw *Raw) ID() string {
+	return raw.CellID
+}
+
+func (raw *Raw) RawMetadata() []byte {
+	return raw.Meta
+}
 
 func (raw *Raw) Attachments() schema.Attachments {
 	return raw.Att
@@ -120,14 +199,26 @@ func (att Attachments) MimeBundle(filename string) schema.MimeBundle {
 
 // Code defines the schema for a "code" cell.
 type Code struct {
+	CellID        string                 `json:"id,omitempty"`
 	Source        common.MultilineString `json:"source"`
 	TimesExecuted int                    `json:"execution_count"`
 	Out           []Output               `json:"outputs"`
 	Lang          string                 `json:"-"`
+	Meta          json.RawMessage        `json:"-"`
 }
 
 var _ schema.CodeCell = (*Code)(nil)
 var _ schema.Outputter = (*Code)(nil)
+var _ schema.HasID = (*Code)(nil)
+var _ schema.HasMetadata = (*Code)(nil)
+
+func (code *Code) ID() string {
+	return code.CellID
+}
+
+func (code *Code) RawMetadata() []byte {
+	return code.Meta
+}
 
 func (code *Code) Type() schema.CellType {
 	return schema.Code
@@ -162,31 +253,53 @@ type Output struct {
 	cell schema.Cell
 }
 
+// NewOutput wraps an output cell, e.g. one produced by executing the code cell.
+func NewOutput(cell schema.Cell) Output {
+	return Output{cell: cell}
+}
+
+// output is a union of the fields of all output types.
+type output struct {
+	OutputType     string                 `json:"output_type"`
+	Name           string                 `json:"name"`
+	Text           common.MultilineString `json:"text"`
+	Data           MimeBundle             `json:"data"`
+	Metadata       json.RawMessage        `json:"metadata"`
+	ExecutionCount int                    `json:"execution_count"`
+	ExceptionName  string                 `json:"ename"`
+	ExceptionValue string                 `json:"evalue"`
+	Traceback      []string               `json:"traceback"`
+}
+
 func (out *Output) UnmarshalJSON(data []byte) error {
-	var v map[string]interface{}
-	if err := json.Unmarshal(data, &v); err != nil {
+	var raw output
+	if err := json.Unmarshal(data, &raw); err != nil {
+		if kind, ok := common.PeekType(data, "output_type"); ok && !isOutputType(kind) {
+			out.cell = common.NewUnrecognized(kind, data)
+			return nil
+		}
 		return fmt.Errorf("code outputs: %w", err)
 	}
 
-	var t interface{}
-	var c schema.Cell
-	switch t = v["output_type"]; t {
+	switch raw.OutputType {
 	case "stream":
-		c = &StreamOutput{}
+		out.cell = &StreamOutput{Target: raw.Name, Source: raw.Text}
 	case "display_data":
-		c = &DisplayDataOutput{}
+		out.cell = &DisplayDataOutput{MimeBundle: raw.Data, Metadata: raw.Metadata}
 	case "execute_result":
-		c = &ExecuteResultOutput{}
+		out.cell = &ExecuteResultOutput{
+			DisplayDataOutput: DisplayDataOutput{MimeBundle: raw.Data, Metadata: raw.Metadata},
+			TimesExecuted:     raw.ExecutionCount,
+		}
 	case "error":
-		c = &ErrorOutput{}
+		out.cell = &ErrorOutput{
+			ExceptionName:  raw.ExceptionName,
+			ExceptionValue: raw.ExceptionValue,
+			Traceback:      raw.Traceback,
+		}
 	default:
-		return fmt.Errorf("unknown output type %q", t)
-	}
-
-	if err := json.Unmarshal(data, &c); err != nil {
-		return fmt.Errorf("%q output: %w", t, err)
+		out.cell = common.NewUnrecognized(raw.OutputType, data)
 	}
-	out.cell = c
 	return nil
 }
 
@@ -222,61 +335,22 @@ func (stream *StreamOutput) Text() []byte {
 // DisplayDataOutput are rich-format outputs generated by running the code in the parent cell.
 type DisplayDataOutput struct {
 	MimeBundle `json:"data"`
-	Metadata   map[string]interface{} `json:"metadata"`
+	Metadata   json.RawMessage `json:"metadata"`
 }
 
 var _ schema.Cell = (*DisplayDataOutput)(nil)
+var _ schema.HasMetadata = (*DisplayDataOutput)(nil)
 
 func (dd *DisplayDataOutput) Type() schema.CellType {
 	return schema.DisplayData
 }
 
-// MimeBundle contains rich output data keyed by mime-type.
-type MimeBundle map[string]interface{}
-
-var _ schema.MimeBundle = (*MimeBundle)(nil)
-
-// MimeType returns the richer of the mime-types present in the bundle,
-// and falls back to "text/plain" otherwise.
-func (mb MimeBundle) MimeType() string {
-	for mime := range mb {
-		if mime != common.PlainText {
-			return mime
-		}
-	}
-	return common.PlainText
-}
-
-// Text returns data with the richer mime-type.
-func (mb MimeBundle) Text() []byte {
-	return mb.Data(mb.MimeType())
+func (dd *DisplayDataOutput) RawMetadata() []byte {
+	return dd.Metadata
 }
 
-// Data returns mime-type-specific content if present and a nil slice otherwise.
-func (mb MimeBundle) Data(mime string) []byte {
-	if txt, ok := mb[mime]; ok {
-
-		switch v := txt.(type) {
-		case []byte:
-			return v
-		case string:
-			return []byte(v)
-		// case []string: TODO: handle MultilineString case
-		case map[string]interface{}:
-			// TODO(optimization): see if there's a way to keep this as raw bytes during unmarshaling to doing the work twice.
-			if b, err := json.Marshal(txt); err == nil {
-				return b
-			}
-			return nil
-		}
-	}
-	return nil
-}
-
-// PlainText returns data for "text/plain" mime-type and a nil slice otherwise.
-func (mb MimeBundle) PlainText() []byte {
-	return mb.Data(common.PlainText)
-}
+// MimeBundle contains rich output data keyed by mime-type.
+type MimeBundle = common.MimeBundle
 
 // ExecuteResultOutput is the result of executing the code in the cell.
 // Its contents are identical to those of DisplayDataOutput with the addition of the execution count.
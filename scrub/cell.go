@@ -0,0 +1,289 @@
+package scrub
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v3 "github.com/bevzzz/nb/schema/v3"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+// scrubber redacts the contents of a cell and collects the findings.
+type scrubber struct {
+	rules    []Rule
+	cell     int
+	id       string
+	findings []Finding
+}
+
+// scrubCell returns a redacted copy of the cell or the cell itself if nothing needs to be redacted.
+// Decoded cells are copied into values of the same type, so that renderers and encoders treat them
+// like the original. Cells of other types are copied with merge.Copy.
+func (sc *scrubber) scrubCell(c schema.Cell) schema.Cell {
+	switch c := c.(type) {
+	case *v4.Markdown:
+		if src, ok := sc.source(c.Text()); ok {
+			cp := *c
+			cp.Source = multiline(src)
+			return &cp
+		}
+	case *v4.Raw:
+		if src, ok := sc.source(c.Text()); ok {
+			cp := *c
+			cp.Source = multiline(src)
+			return &cp
+		}
+	case *common.Markdown:
+		if src, ok := sc.source(c.Text()); ok {
+			cp := *c
+			cp.Source = multiline(src)
+			return &cp
+		}
+	case *common.Raw:
+		if src, ok := sc.source(c.Text()); ok {
+			cp := *c
+			cp.Source = multiline(src)
+			return &cp
+		}
+	case *v3.Heading:
+		// Text() adds the heading signs to the source.
+		if src, ok := sc.source(c.Source.Text()); ok {
+			cp := *c
+			cp.Source = multiline(src)
+			return &cp
+		}
+	case *v4.Code:
+		src, srcOK := sc.source(c.Text())
+		outs, outOK := sc.outputs(c.Outputs())
+		if srcOK || outOK {
+			cp := *c
+			cp.Source = multiline(src)
+			cp.Out = make([]v4.Output, len(outs))
+			for i := range outs {
+				cp.Out[i] = v4.NewOutput(outs[i])
+			}
+			return &cp
+		}
+	case *v3.Code:
+		src, srcOK := sc.source(c.Text())
+		outs, outOK := sc.outputs(c.Outputs())
+		if srcOK || outOK {
+			cp := *c
+			cp.Source = multiline(src)
+			cp.Out = make([]v3.Output, len(outs))
+			for i := range outs {
+				cp.Out[i] = v3.NewOutput(outs[i])
+			}
+			return &cp
+		}
+	case *common.Unrecognized:
+		// Unrecognized cells are kept verbatim.
+	default:
+		src, srcOK := sc.source(c.Text())
+		var outs []schema.Cell
+		outOK := false
+		if out, ok := c.(schema.Outputter); ok {
+			outs, outOK = sc.outputs(out.Outputs())
+		}
+		if srcOK || outOK {
+			cp, mc := merge.Copy(c)
+			mc.Source = src
+			if code, ok := cp.(*merge.CodeCell); ok {
+				code.Out = outs
+			}
+			return cp
+		}
+	}
+	return c
+}
+
+// source redacts the cell's source.
+func (sc *scrubber) source(text []byte) ([]byte, bool) {
+	return sc.scrub(text, -1, "", 0)
+}
+
+// outputs returns the outputs with redacted copies of those that have any findings.
+func (sc *scrubber) outputs(outs []schema.Cell) ([]schema.Cell, bool) {
+	changed := false
+	scrubbed := make([]schema.Cell, len(outs))
+	for i, out := range outs {
+		var ok bool
+		scrubbed[i], ok = sc.scrubOutput(i, out)
+		changed = changed || ok
+	}
+	return scrubbed, changed
+}
+
+func (sc *scrubber) scrubOutput(i int, out schema.Cell) (schema.Cell, bool) {
+	switch out := out.(type) {
+	case *v4.StreamOutput:
+		if text, ok := sc.scrub(out.Text(), i, "", 0); ok {
+			cp := *out
+			cp.Source = multiline(text)
+			return &cp, true
+		}
+	case *v3.StreamOutput:
+		if text, ok := sc.scrub(out.Text(), i, "", 0); ok {
+			cp := *out
+			cp.Source = multiline(text)
+			return &cp, true
+		}
+	case *v4.DisplayDataOutput:
+		if mb, ok := sc.bundle(i, out.MimeBundle); ok {
+			cp := *out
+			cp.MimeBundle = mb
+			return &cp, true
+		}
+	case *v3.DisplayDataOutput:
+		if mb, ok := sc.bundle(i, out.MimeBundle); ok {
+			cp := *out
+			cp.MimeBundle = mb
+			return &cp, true
+		}
+	case *v4.ExecuteResultOutput:
+		if mb, ok := sc.bundle(i, out.MimeBundle); ok {
+			cp := *out
+			cp.MimeBundle = mb
+			return &cp, true
+		}
+	case *v3.ExecuteResultOutput:
+		if mb, ok := sc.bundle(i, out.MimeBundle); ok {
+			cp := *out
+			cp.MimeBundle = mb
+			return &cp, true
+		}
+	case *v4.ErrorOutput:
+		if value, tb, ok := sc.exception(i, out.ExceptionValue, out.Traceback); ok {
+			cp := *out
+			cp.ExceptionValue, cp.Traceback = value, tb
+			return &cp, true
+		}
+	case *v3.ErrorOutput:
+		if value, tb, ok := sc.exception(i, out.ExceptionValue, out.Traceback); ok {
+			cp := *out
+			cp.ExceptionValue, cp.Traceback = value, tb
+			return &cp, true
+		}
+	case *common.Unrecognized:
+	default:
+		if !isText(out.MimeType()) && out.Type() != schema.Stream && out.Type() != schema.Error {
+			break
+		}
+		if text, ok := sc.scrub(out.Text(), i, out.MimeType(), 0); ok {
+			return &output{Cell: out, text: text}, true
+		}
+	}
+	return out, false
+}
+
+// bundle redacts the textual representations in the mime-bundle. Binary data, like images, is not scanned.
+func (sc *scrubber) bundle(i int, mb common.MimeBundle) (common.MimeBundle, bool) {
+	var cp common.MimeBundle
+	for _, mime := range mb.MimeTypes() {
+		if !isText(mime) {
+			continue
+		}
+		text, ok := sc.scrub(mb.Data(mime), i, mime, 0)
+		if !ok {
+			continue
+		}
+		if cp == nil {
+			cp = make(common.MimeBundle, len(mb))
+			for k, v := range mb {
+				cp[k] = v
+			}
+		}
+		if common.IsJSON(mime) && json.Valid(text) {
+			cp[mime] = text
+		} else {
+			cp[mime], _ = json.Marshal(string(text))
+		}
+	}
+	return cp, cp != nil
+}
+
+// exception redacts the exception value and the traceback. Line numbers of the findings
+// in the traceback are counted in the text of the output, where its entries are joined with newlines.
+func (sc *scrubber) exception(i int, value string, traceback []string) (string, []string, bool) {
+	v, changed := sc.scrub([]byte(value), i, "", -1)
+	if changed {
+		value = string(v)
+	}
+
+	var tb []string
+	offset := 0
+	for j, entry := range traceback {
+		if text, ok := sc.scrub([]byte(entry), i, "", offset); ok {
+			if tb == nil {
+				tb = append([]string(nil), traceback...)
+			}
+			tb[j] = string(text)
+			changed = true
+		}
+		offset += strings.Count(entry, "\n") + 1
+	}
+	if tb == nil {
+		tb = traceback
+	}
+	return value, tb, changed
+}
+
+// scrub redacts the text and records the findings for the output (-1 for the source).
+// Line numbers are shifted by offset, and a negative offset sets them to 0.
+func (sc *scrubber) scrub(text []byte, output int, mime string, offset int) ([]byte, bool) {
+	matches := find(sc.rules, text)
+	if len(matches) == 0 {
+		return text, false
+	}
+	for _, m := range matches {
+		line := m.line + offset
+		if offset < 0 {
+			line = 0
+		}
+		sc.findings = append(sc.findings, Finding{
+			Rule:     m.rule.Name,
+			Cell:     sc.cell,
+			CellID:   sc.id,
+			Output:   output,
+			MimeType: mime,
+			Line:     line,
+		})
+	}
+	return redact(text, matches), true
+}
+
+// isText reports whether the data for the mime-type is text which should be scanned.
+func isText(mime string) bool {
+	return strings.HasPrefix(mime, "text/") || common.IsJSON(mime) ||
+		mime == "image/svg+xml" || mime == "application/javascript" ||
+		mime == common.Stdout || mime == common.Stderr
+}
+
+// output is a redacted copy of an output of a type which is not known to the package.
+// Only its text is replaced, other optional interfaces of the original are not preserved.
+type output struct {
+	schema.Cell
+	text []byte
+}
+
+func (o *output) Text() []byte {
+	return o.text
+}
+
+// multiline splits the text into lines, keeping the line endings.
+func multiline(b []byte) common.MultilineString {
+	var lines common.MultilineString
+	for s := string(b); s != ""; {
+		i := strings.IndexByte(s, '\n')
+		if i == -1 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
@@ -0,0 +1,111 @@
+package scrub
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+)
+
+// Rule describes a kind of sensitive data.
+type Rule struct {
+	// Name identifies the rule in findings and options, e.g. "aws-access-key-id".
+	Name string
+
+	// Pattern matches the sensitive data. If it has a subexpression named "secret",
+	// only that part of the match is redacted, e.g. the token in "Authorization: Bearer <token>".
+	Pattern *regexp.Regexp
+
+	// Replacement is substituted for the redacted text. Defaults to DefaultReplacement.
+	Replacement string
+}
+
+// DefaultReplacement is used for rules which do not specify a Replacement.
+const DefaultReplacement = "[REDACTED]"
+
+// NewRule creates a rule with the default replacement. It panics if the pattern does not compile.
+func NewRule(name, pattern string) Rule {
+	return Rule{Name: name, Pattern: regexp.MustCompile(pattern)}
+}
+
+// DefaultRules returns rules for common credentials, email addresses, and paths to home directories,
+// which reveal the user's name. The latter are replaced with "~" rather than redacted.
+func DefaultRules() []Rule {
+	home := NewRule("home-path", `(?:/home|/Users)/[^/\s"'<>:]+|\b[A-Za-z]:\\+Users\\+[^\\\s"'<>:]+`)
+	home.Replacement = "~"
+
+	return []Rule{
+		NewRule("private-key", `-----BEGIN[A-Z ]* PRIVATE KEY-----[\s\S]*?-----END[A-Z ]* PRIVATE KEY-----`),
+		NewRule("aws-access-key-id", `\b(?:AKIA|ASIA|AIDA|AROA|AIPA|ANPA|ANVA|AGPA)[A-Z0-9]{16}\b`),
+		NewRule("aws-secret-access-key", `(?i)\baws_?secret_?access_?key\b["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`),
+		NewRule("github-token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+		NewRule("slack-token", `\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		NewRule("bearer-token", `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]{8,}=*)`),
+		NewRule("api-key", `(?i)\b(?:api[_-]?key|api[_-]?token|access[_-]?token|auth[_-]?token|secret[_-]?key|password)\b["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9\-_.~+/=]{16,})`),
+		NewRule("email", `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`),
+		home,
+	}
+}
+
+// match is a part of the text to be redacted.
+type match struct {
+	rule       *Rule
+	start, end int
+	line       int // 1-based line of the match start
+}
+
+// find matches the text against all rules. Overlapping matches are resolved in favour of the one which starts first,
+// or the longest one if they start at the same position, so that each part of the text is redacted only once.
+func find(rules []Rule, text []byte) []match {
+	var all []match
+	for i := range rules {
+		r := &rules[i]
+		secret := r.Pattern.SubexpIndex("secret")
+		for _, loc := range r.Pattern.FindAllSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if secret > 0 && loc[2*secret] >= 0 {
+				start, end = loc[2*secret], loc[2*secret+1]
+			}
+			if start < end {
+				all = append(all, match{rule: r, start: start, end: end})
+			}
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end > all[j].end
+	})
+	matches := all[:0]
+	pos, line := 0, 1
+	for _, m := range all {
+		if len(matches) > 0 && m.start < matches[len(matches)-1].end {
+			continue
+		}
+		line += bytes.Count(text[pos:m.start], []byte("\n"))
+		pos, m.line = m.start, line
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// redact replaces the matches in the text.
+func redact(text []byte, matches []match) []byte {
+	var buf bytes.Buffer
+	pos := 0
+	for _, m := range matches {
+		buf.Write(text[pos:m.start])
+		if m.rule.Replacement != "" {
+			buf.WriteString(m.rule.Replacement)
+		} else {
+			buf.WriteString(DefaultReplacement)
+		}
+		pos = m.end
+	}
+	buf.Write(text[pos:])
+	return buf.Bytes()
+}
@@ -0,0 +1,202 @@
+// Package scrub redacts credentials and personal data from notebooks before they are published.
+//
+// Cell sources, stream outputs, tracebacks, and the textual representations of rich outputs
+// (text/plain, text/html, JSON, etc.) are matched against a set of rules, see DefaultRules.
+// Matches are replaced in copies of the decoded cells, so the scrubbed notebook can be passed
+// to any renderer or encoded back to JSON:
+//
+//	clean, findings, err := scrub.Notebook(nb)
+//
+// As an extension, the Scrubber redacts every notebook before it is rendered:
+//
+//	c := nb.New(nb.WithExtensions(scrub.New()))
+//
+// In report-only mode the notebook is left unchanged, and only the findings are reported.
+package scrub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+)
+
+// Finding locates sensitive data in the notebook. It does not include the data itself,
+// so that it can be logged safely.
+type Finding struct {
+	// Rule is the name of the rule which matched.
+	Rule string `json:"rule"`
+
+	// Cell is the index of the cell in the notebook.
+	Cell int `json:"cell"`
+
+	// CellID is the ID of the cell, if it has one.
+	CellID string `json:"cell_id,omitempty"`
+
+	// Output is the index of the output in the cell or -1 if the match is in the cell's source.
+	Output int `json:"output"`
+
+	// MimeType is the representation of a rich output that the match is in.
+	MimeType string `json:"mime_type,omitempty"`
+
+	// Line is the 1-based line of the match in the source or output. It is 0 for the exception value of error outputs.
+	Line int `json:"line"`
+}
+
+// String formats the finding as "cell 3 (abc): output 1 (text/html): line 2: email".
+func (f Finding) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "cell %d", f.Cell)
+	if f.CellID != "" {
+		fmt.Fprintf(&sb, " (%s)", f.CellID)
+	}
+	if f.Output >= 0 {
+		fmt.Fprintf(&sb, ": output %d", f.Output)
+		if f.MimeType != "" {
+			fmt.Fprintf(&sb, " (%s)", f.MimeType)
+		}
+	}
+	if f.Line > 0 {
+		fmt.Fprintf(&sb, ": line %d", f.Line)
+	}
+	fmt.Fprintf(&sb, ": %s", f.Rule)
+	return sb.String()
+}
+
+// Option configures a Scrubber.
+type Option func(*Scrubber)
+
+// WithRules adds rules to the scrubber. A rule replaces the rule of the same name if it is already configured.
+func WithRules(rules ...Rule) Option {
+	return func(s *Scrubber) {
+	next:
+		for _, r := range rules {
+			for i := range s.rules {
+				if s.rules[i].Name == r.Name {
+					s.rules[i] = r
+					continue next
+				}
+			}
+			s.rules = append(s.rules, r)
+		}
+	}
+}
+
+// WithDisabled disables rules by name.
+func WithDisabled(names ...string) Option {
+	return func(s *Scrubber) {
+		disabled := make(map[string]bool, len(names))
+		for _, name := range names {
+			disabled[name] = true
+		}
+		rules := s.rules[:0]
+		for _, r := range s.rules {
+			if !disabled[r.Name] {
+				rules = append(rules, r)
+			}
+		}
+		s.rules = rules
+	}
+}
+
+// WithReportOnly reports the findings without redacting them.
+func WithReportOnly() Option {
+	return func(s *Scrubber) {
+		s.reportOnly = true
+	}
+}
+
+// WithReport calls f with the findings for every notebook, including those without any.
+// This is how findings are reported when the Scrubber is used as an extension.
+func WithReport(f func([]Finding)) Option {
+	return func(s *Scrubber) {
+		s.report = f
+	}
+}
+
+// Scrubber redacts sensitive data from notebooks. It is also an extension, which scrubs notebooks before rendering.
+type Scrubber struct {
+	rules      []Rule
+	reportOnly bool
+	report     func([]Finding)
+}
+
+var _ nb.Extension = (*Scrubber)(nil)
+
+// New creates a scrubber with the default rules.
+func New(opts ...Option) *Scrubber {
+	s := Scrubber{rules: DefaultRules()}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return &s
+}
+
+// Notebook scrubs the notebook with a scrubber configured with the options.
+func Notebook(notebook schema.Notebook, opts ...Option) (schema.Notebook, []Finding, error) {
+	return New(opts...).Notebook(notebook)
+}
+
+// Notebook returns a copy of the notebook with the sensitive data redacted and the findings ordered by cell.
+// Cells without any findings are not copied. In report-only mode the returned notebook holds the original cells.
+// The cells of the notebook are read once, so that notebooks decoded from a stream can be rendered afterwards,
+// and the error which stopped the stream, if any, is returned.
+func (s *Scrubber) Notebook(notebook schema.Notebook) (schema.Notebook, []Finding, error) {
+	original, err := schema.ReadAll(notebook)
+	if err != nil {
+		return nil, nil, fmt.Errorf("scrub: %w", err)
+	}
+
+	var findings []Finding
+	clean, _ := schema.MapCells(original, func(i int, c schema.Cell) (schema.Cell, error) {
+		sc := scrubber{rules: s.rules, cell: i}
+		if id, ok := c.(schema.HasID); ok {
+			sc.id = id.ID()
+		}
+		scrubbed := sc.scrubCell(c)
+		findings = append(findings, sc.findings...)
+		return scrubbed, nil
+	})
+
+	if s.report != nil {
+		s.report(findings)
+	}
+	if s.reportOnly {
+		return original, findings, nil
+	}
+	return clean, findings, nil
+}
+
+// Extend scrubs every notebook before it is rendered. The cells of the notebook are read into memory.
+func (s *Scrubber) Extend(n *nb.Notebook) {
+	n.WrapRenderer(func(r render.Renderer) render.Renderer {
+		return &renderer{Renderer: r, s: s}
+	})
+}
+
+// renderer scrubs notebooks before passing them to the wrapped renderer.
+type renderer struct {
+	render.Renderer
+	s *Scrubber
+}
+
+var _ render.ContextRenderer = (*renderer)(nil)
+
+func (r *renderer) Render(w io.Writer, notebook schema.Notebook) error {
+	return r.RenderContext(context.Background(), w, notebook)
+}
+
+func (r *renderer) RenderContext(ctx context.Context, w io.Writer, notebook schema.Notebook) error {
+	notebook, _, err := r.s.Notebook(notebook)
+	if err != nil {
+		return err
+	}
+	if cr, ok := r.Renderer.(render.ContextRenderer); ok {
+		return cr.RenderContext(ctx, w, notebook)
+	}
+	return r.Renderer.Render(w, notebook)
+}
@@ -0,0 +1,163 @@
+// Package search builds a static search index of notebooks as they are rendered.
+//
+// The index holds one Document per cell with the cell's plain text, the section it belongs to,
+// and the anchor of its HTML element, so that search results can link straight to the cell.
+// It is written as a JSON array which client-side search libraries, like lunr or Pagefind,
+// can load as is:
+//
+//	idx := search.NewIndex()
+//	c := nb.New(nb.WithRenderOptions(idx.Option("guide.html")))
+//	c.Convert(w, guide)
+//	idx.WriteJSON(indexFile)
+//
+// Documents are collected in the same pass that renders the notebook (see render.WithVisitor).
+package search
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bevzzz/nb/extension/toc"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+	"github.com/bevzzz/nb/schema"
+)
+
+// Document is the searchable content of a cell.
+type Document struct {
+	// ID is unique across the index: the page URL followed by the cell's anchor.
+	ID string `json:"id"`
+
+	// URL links to the cell's element in the rendered page.
+	URL string `json:"url"`
+
+	// Anchor is the id of the cell's element, see html.CellID.
+	Anchor string `json:"anchor"`
+
+	// Cell is the position of the cell in the notebook.
+	Cell int `json:"cell"`
+
+	// Type is "markdown", "code", or "raw".
+	Type string `json:"type"`
+
+	// Title is the text of the closest heading preceding or in the cell.
+	Title string `json:"title,omitempty"`
+
+	// Section is the anchor of that heading, as added by package extension/toc.
+	Section string `json:"section,omitempty"`
+
+	// Headings is the path of headings from the top level to Title.
+	Headings []string `json:"headings,omitempty"`
+
+	// Text is the plain text of markdown cells, the source of code cells, and the text of their outputs.
+	Text string `json:"text"`
+}
+
+// Index collects documents from rendered notebooks. It is safe for concurrent use.
+type Index struct {
+	mu   sync.Mutex
+	docs map[string][]Document // by page URL
+}
+
+// NewIndex creates an empty index.
+func NewIndex() *Index {
+	return &Index{docs: make(map[string][]Document)}
+}
+
+// Option adds the cells of every notebook rendered with it to the index as the page at url.
+// Rendering the same page again replaces its documents.
+func (idx *Index) Option(url string) render.Option {
+	return render.WithVisitor(func() render.VisitFunc {
+		var p page
+		idx.mu.Lock()
+		idx.docs[url] = nil
+		idx.mu.Unlock()
+
+		return func(i int, cell schema.Cell) {
+			doc, ok := p.visit(i, cell)
+			if !ok {
+				return
+			}
+			doc.URL = url + "#" + doc.Anchor
+			doc.ID = doc.URL
+
+			idx.mu.Lock()
+			idx.docs[url] = append(idx.docs[url], doc)
+			idx.mu.Unlock()
+		}
+	})
+}
+
+// Documents returns the documents in the index, ordered by page URL and cell.
+func (idx *Index) Documents() []Document {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	urls := make([]string, 0, len(idx.docs))
+	for url := range idx.docs {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	docs := []Document{}
+	for _, url := range urls {
+		docs = append(docs, idx.docs[url]...)
+	}
+	return docs
+}
+
+// WriteJSON writes the documents as a JSON array.
+func (idx *Index) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(idx.Documents())
+}
+
+// page tracks the section headings while the cells of a notebook are visited.
+type page struct {
+	slug  toc.Slugger
+	stack []*toc.Heading // path from the top-level heading to the current one
+}
+
+// visit creates a document for the cell. Cells without any text are skipped,
+// but their headings still count towards the section context.
+func (p *page) visit(i int, cell schema.Cell) (Document, bool) {
+	var typ, text string
+	switch cell.Type() {
+	case schema.Markdown:
+		typ, text = "markdown", markdownText(cell.Text())
+	case schema.Code:
+		typ, text = "code", codeText(cell)
+	case schema.Raw:
+		typ, text = "raw", strings.TrimSpace(string(cell.Text()))
+	default:
+		return Document{}, false
+	}
+
+	for _, h := range toc.Headings(cell, i, &p.slug) {
+		for len(p.stack) > 0 && p.stack[len(p.stack)-1].Level >= h.Level {
+			p.stack = p.stack[:len(p.stack)-1]
+		}
+		p.stack = append(p.stack, h)
+	}
+	if text == "" {
+		return Document{}, false
+	}
+
+	doc := Document{
+		Anchor: html.CellID(cell, i),
+		Cell:   i,
+		Type:   typ,
+		Text:   text,
+	}
+	if n := len(p.stack); n > 0 {
+		doc.Title, doc.Section = p.stack[n-1].Text, p.stack[n-1].ID
+		for _, h := range p.stack {
+			doc.Headings = append(doc.Headings, h.Text)
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,98 @@
+package search_test
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/pkg/test"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	"github.com/bevzzz/nb/search"
+)
+
+func TestIndex(t *testing.T) {
+	notebook := test.Notebook(
+		test.Markdown("# Guide\nSome *intro* with a [link](https://example.com) and <b>HTML</b>."),
+		&test.CodeCell{
+			Cell: test.Cell{CellType: schema.Code, Source: []byte("print('hi')")},
+			Out: []schema.Cell{
+				test.Stdout("hi\n"),
+				test.ErrorOutput("\x1b[31mValueError\x1b[0m: oops"),
+				test.DisplayData("<p>A &amp; B</p>", "text/html"),
+				test.DisplayData("iVBORw0KGgo=", "image/png"),
+			},
+		},
+		test.Markdown("## Install\n\n```sh\ngo get\n```"),
+		test.Markdown(""),
+		test.Raw("raw text", common.PlainText),
+	)
+
+	idx := search.NewIndex()
+	c := nb.New(nb.WithRenderOptions(idx.Option("guide.html")))
+	require.NoError(t, c.Renderer().Render(io.Discard, notebook))
+
+	require.Equal(t, []search.Document{
+		{
+			ID: "guide.html#cell-0", URL: "guide.html#cell-0", Anchor: "cell-0", Cell: 0, Type: "markdown",
+			Title: "Guide", Section: "guide", Headings: []string{"Guide"},
+			Text: "Guide\nSome intro with a link and HTML .",
+		},
+		{
+			ID: "guide.html#cell-1", URL: "guide.html#cell-1", Anchor: "cell-1", Cell: 1, Type: "code",
+			Title: "Guide", Section: "guide", Headings: []string{"Guide"},
+			Text: "print('hi')\nhi\nValueError: oops\nA & B",
+		},
+		{
+			ID: "guide.html#cell-2", URL: "guide.html#cell-2", Anchor: "cell-2", Cell: 2, Type: "markdown",
+			Title: "Install", Section: "install", Headings: []string{"Guide", "Install"},
+			Text: "Install\n\ngo get",
+		},
+		{
+			ID: "guide.html#cell-4", URL: "guide.html#cell-4", Anchor: "cell-4", Cell: 4, Type: "raw",
+			Title: "Install", Section: "install", Headings: []string{"Guide", "Install"},
+			Text: "raw text",
+		},
+	}, idx.Documents())
+
+	t.Run("rendering the page again replaces its documents", func(t *testing.T) {
+		require.NoError(t, c.Renderer().Render(io.Discard, test.Notebook(test.Markdown("new"))))
+
+		docs := idx.Documents()
+		require.Len(t, docs, 1)
+		require.Equal(t, "new", docs[0].Text)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var sb strings.Builder
+		require.NoError(t, idx.WriteJSON(&sb))
+
+		var got []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(sb.String()), &got))
+		require.Equal(t, []map[string]interface{}{
+			{"id": "guide.html#cell-0", "url": "guide.html#cell-0", "anchor": "cell-0", "cell": 0.0, "type": "markdown", "text": "new"},
+		}, got)
+	})
+}
+
+func TestIndex_concurrent(t *testing.T) {
+	var cells []schema.Cell
+	for i := 0; i < 50; i++ {
+		cells = append(cells, test.Markdown("text"))
+	}
+
+	idx := search.NewIndex()
+	c := nb.New(nb.WithRenderOptions(idx.Option("a.html"), render.WithConcurrency(4)))
+	require.NoError(t, c.Renderer().Render(io.Discard, test.Notebook(cells...)))
+
+	docs := idx.Documents()
+	require.Len(t, docs, 50)
+	for i, doc := range docs {
+		require.Equal(t, i, doc.Cell)
+	}
+}
@@ -0,0 +1,92 @@
+package search
+
+import (
+	stdhtml "html"
+	"regexp"
+	"strings"
+
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+)
+
+var (
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTag     = regexp.MustCompile(`<[^>]+>`)
+	image       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	link        = regexp.MustCompile(`\[([^\]]*)\](?:\([^)]*\)|\[[^\]]*\])`)
+	blockPrefix = regexp.MustCompile(`(?m)^ {0,3}(?:#{1,6}[ \t]+|>[ \t]?|[-*+][ \t]+|\d+[.)][ \t]+)`)
+	fenceLine   = regexp.MustCompile("(?m)^ {0,3}(?:```+|~~~+).*$")
+	ruleLine    = regexp.MustCompile(`(?m)^ {0,3}(?:[-=*_][ \t]*){3,}$`)
+	ansi        = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	spaces      = regexp.MustCompile(`[ \t]+`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// markdownText strips markdown syntax and HTML tags, keeping the text of links and images.
+func markdownText(md []byte) string {
+	s := string(md)
+	s = fenceLine.ReplaceAllString(s, "")
+	s = ruleLine.ReplaceAllString(s, "")
+	s = blockPrefix.ReplaceAllString(s, "")
+	s = image.ReplaceAllString(s, "$1")
+	s = link.ReplaceAllString(s, "$1")
+	s = strings.NewReplacer("`", "", "**", "", "*", "", "__", "", "~~", "").Replace(s)
+	return htmlText(s)
+}
+
+// htmlText removes tags and comments and unescapes HTML entities.
+func htmlText(s string) string {
+	s = htmlComment.ReplaceAllString(s, "")
+	s = htmlTag.ReplaceAllString(s, " ")
+	return normalize(stdhtml.UnescapeString(s))
+}
+
+// codeText joins the source of the code cell with the text of its outputs.
+func codeText(cell schema.Cell) string {
+	parts := []string{strings.TrimSpace(string(cell.Text()))}
+	if out, ok := cell.(schema.Outputter); ok {
+		for _, o := range out.Outputs() {
+			parts = append(parts, outputText(o))
+		}
+	}
+
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, "\n")
+}
+
+// outputText extracts text from stream and error outputs and from the textual
+// representations of rich outputs. Images and other binary data are skipped.
+func outputText(out schema.Cell) string {
+	mime := out.MimeType()
+	switch {
+	case mime == common.Stdout, mime == common.Stderr:
+		return normalize(ansi.ReplaceAllString(string(out.Text()), ""))
+	case mime == "text/html":
+		return htmlText(string(out.Text()))
+	case mime == common.MarkdownText:
+		return markdownText(out.Text())
+	case strings.HasPrefix(mime, "text/"):
+		return normalize(string(out.Text()))
+	}
+	if mb, ok := out.(interface{ PlainText() []byte }); ok {
+		return normalize(string(mb.PlainText()))
+	}
+	return ""
+}
+
+// normalize collapses runs of spaces and blank lines.
+func normalize(s string) string {
+	s = spaces.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReloadPath is the path of the Server-Sent Events stream of a Handler with live reload.
+const ReloadPath = "/.nb-reload"
+
+// WithLiveReload makes the pages and listings reload when r is notified about changes.
+// The handler serves r at ReloadPath and adds a script which listens to it to every page.
+func WithLiveReload(r *Reloader) Option {
+	return func(h *Handler) {
+		h.reloader = r
+	}
+}
+
+// Reloader notifies browsers about changes with Server-Sent Events. It is safe for concurrent use.
+type Reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+var _ http.Handler = (*Reloader)(nil)
+
+// NewReloader creates a Reloader without clients.
+func NewReloader() *Reloader {
+	return &Reloader{clients: make(map[chan struct{}]bool)}
+}
+
+// Reload sends a "reload" event to all connected clients.
+func (r *Reloader) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.clients {
+		select {
+		case c <- struct{}{}:
+		default: // the client has a reload pending
+		}
+	}
+}
+
+// ServeHTTP streams the events to the client until it disconnects.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	c := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.clients[c] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-c:
+			if _, err := w.Write([]byte("event: reload\ndata: {}\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// reloadURL is the URL of the event stream relative to a page in dir.
+func reloadURL(dir string) string {
+	if dir == "." {
+		return "." + ReloadPath
+	}
+	return strings.Repeat("../", strings.Count(dir, "/")+1) + strings.TrimPrefix(ReloadPath, "/")
+}
+
+// Watch polls the file system for changes every interval and calls changed with the paths
+// of the files which were added, modified, or removed, until ctx is done.
+// Changes are detected by comparing the sizes and modification times of the files.
+// Hidden files and directories, like ".ipynb_checkpoints", are not watched.
+func Watch(ctx context.Context, fsys fs.FS, interval time.Duration, changed func(names []string)) error {
+	prev, err := scan(fsys)
+	if err != nil {
+		return err
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		next, err := scan(fsys)
+		if err != nil {
+			continue // the tree may be changing, try again later
+		}
+		var names []string
+		for name, s := range next {
+			if old, ok := prev[name]; !ok || old.size != s.size || !old.modTime.Equal(s.modTime) {
+				names = append(names, name)
+			}
+		}
+		for name := range prev {
+			if _, ok := next[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		prev = next
+		if len(names) > 0 {
+			sort.Strings(names)
+			changed(names)
+		}
+	}
+}
+
+// stat is the part of the file info which changes when the file is modified.
+type stat struct {
+	size    int64
+	modTime time.Time
+}
+
+func scan(fsys fs.FS) (map[string]stat, error) {
+	files := make(map[string]stat)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[p] = stat{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,113 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/server"
+)
+
+func TestWithLiveReload(t *testing.T) {
+	r := server.NewReloader()
+	ts := httptest.NewServer(server.New(testFS(), server.WithLiveReload(r)))
+	defer ts.Close()
+
+	t.Run("pages listen to the event stream", func(t *testing.T) {
+		// Slashes are escaped in JavaScript strings by html/template.
+		for target, want := range map[string]string{
+			"/":                   `new EventSource(".\/.nb-reload")`,
+			"/sub/dir/":           `new EventSource("..\/..\/.nb-reload")`,
+			"/sub/dir/deep.ipynb": `new EventSource("..\/..\/.nb-reload")`,
+		} {
+			resp, err := http.Get(ts.URL + target)
+			require.NoError(t, err)
+			require.Contains(t, body(t, resp), want, target)
+			resp.Body.Close()
+		}
+	})
+
+	t.Run("reload event", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+server.ReloadPath, nil)
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// The client is registered once the response headers are sent.
+		r.Reload()
+
+		sc := bufio.NewScanner(resp.Body)
+		require.True(t, sc.Scan())
+		require.Equal(t, "event: reload", sc.Text())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := server.New(testFS())
+		require.Equal(t, http.StatusNotFound, get(t, h, server.ReloadPath).StatusCode)
+		require.NotContains(t, body(t, get(t, h, "/report.ipynb")), "EventSource")
+	})
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+	write("a.ipynb", "a")
+	write("b.ipynb", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string)
+	done := make(chan error)
+	go func() {
+		done <- server.Watch(ctx, os.DirFS(dir), 10*time.Millisecond, func(names []string) { changes <- names })
+	}()
+
+	next := func() []string {
+		select {
+		case names := <-changes:
+			return names
+		case <-time.After(5 * time.Second):
+			t.Fatal("no changes detected")
+			return nil
+		}
+	}
+
+	// Files written before the initial scan are not reported, so wait until the watcher picks up a change.
+	for ready := "r"; ; ready += "r" {
+		write("ready", ready)
+		select {
+		case <-changes:
+		case <-time.After(50 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	write("a.ipynb", "modified")
+	write("sub/c.ipynb", "c")
+	write(".ipynb_checkpoints/a.ipynb", "hidden")
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.ipynb")))
+
+	got := next()
+	for len(got) < 3 {
+		got = append(got, next()...) // changes may be picked up by different polls
+	}
+	require.ElementsMatch(t, []string{"a.ipynb", "b.ipynb", "sub/c.ipynb"}, got)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
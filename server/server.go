@@ -0,0 +1,448 @@
+// Package server serves the notebooks from a file system as HTML pages, in the manner of nbviewer.
+//
+// The Handler renders notebooks on request and lists the contents of directories. Other files,
+// like images referenced by the notebooks, are served as is. Rendered notebooks are cached (in memory by default)
+// by the hash of their contents, which also serves as their ETag:
+//
+//	h := server.New(os.DirFS("notebooks"))
+//	http.Handle("/nb/", http.StripPrefix("/nb", h))
+//
+// Pages are rendered with nb's default HTML renderer, which leaves markdown cells as is. Pass a converter
+// configured with a markdown renderer and other extensions with WithNotebook.
+//
+// The format of a notebook is selected with the "format" query parameter: "html" (default) renders a page,
+// "raw" downloads the original file, and more formats can be added with WithFormat.
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/cache"
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+	"github.com/bevzzz/nb/schema"
+)
+
+// Format renders notebooks for a "format" query parameter.
+type Format struct {
+	// ContentType is set in the response header.
+	ContentType string
+
+	// Render writes the notebook read from the file at name.
+	Render func(w io.Writer, name string, nb schema.Notebook) error
+}
+
+// DefaultCacheSize is the default limit on the total size of the cached responses.
+const DefaultCacheSize = 64 << 20
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithFormat adds or replaces the format with the name. The "raw" format cannot be replaced.
+func WithFormat(name string, f Format) Option {
+	return func(h *Handler) {
+		h.formats[name] = f
+	}
+}
+
+// WithNotebook renders the HTML pages with the configured converter, e.g. one with a markdown renderer.
+// The renderer of n must produce HTML, as the rendered cells are placed into the notebook container on the page.
+// WithExtensions and WithRenderOptions only configure the default converter and are ignored if WithNotebook is passed.
+func WithNotebook(n *nb.Notebook) Option {
+	return func(h *Handler) {
+		h.notebook = n
+	}
+}
+
+// WithExtensions adds extensions to the converter which renders the HTML pages.
+func WithExtensions(exts ...nb.Extension) Option {
+	return func(h *Handler) {
+		h.extensions = append(h.extensions, exts...)
+	}
+}
+
+// WithRenderOptions configures the renderer of the HTML pages.
+func WithRenderOptions(opts ...render.Option) Option {
+	return func(h *Handler) {
+		h.renderOptions = append(h.renderOptions, opts...)
+	}
+}
+
+// WithTemplates replaces the templates of the notebook page and the directory listing.
+// The page template receives a Page and the listing template receives a Listing.
+// A nil template keeps the default one.
+func WithTemplates(page, listing *template.Template) Option {
+	return func(h *Handler) {
+		if page != nil {
+			h.page = page
+		}
+		if listing != nil {
+			h.listing = listing
+		}
+	}
+}
+
+// WithCacheSize limits the total size of the cached responses in bytes. A size of 0 disables the cache.
+func WithCacheSize(size int) Option {
+	return WithCache(cache.NewMemory(size))
+}
+
+// WithCache keeps the rendered notebooks in the store, e.g. a cache.Dir shared between restarts.
+// The keys describe the configuration of the converter (see cache.ConfigKey), but not the templates
+// or the formats added with WithFormat, so handlers which differ in those should not share a store.
+func WithCache(store cache.Store) Option {
+	return func(h *Handler) {
+		h.cache = store
+	}
+}
+
+// Handler serves the notebooks in a file system. It is safe for concurrent use.
+type Handler struct {
+	fsys    fs.FS
+	formats map[string]Format
+	cache   cache.Store
+
+	page, listing *template.Template
+	css           template.CSS
+
+	notebook      *nb.Notebook
+	extensions    []nb.Extension
+	renderOptions []render.Option
+	renderer      render.Renderer
+	wrapper       render.CellWrapper
+	reloader      *Reloader
+	configKey     string
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+//go:embed page.html
+var pageTemplate string
+
+//go:embed listing.html
+var listingTemplate string
+
+var (
+	defaultPage    = template.Must(template.New("page").Parse(pageTemplate))
+	defaultListing = template.Must(template.New("listing").Parse(listingTemplate))
+)
+
+// New creates a handler which serves the notebooks in fsys.
+func New(fsys fs.FS, opts ...Option) *Handler {
+	h := Handler{
+		fsys:    fsys,
+		formats: make(map[string]Format),
+		cache:   cache.NewMemory(DefaultCacheSize),
+		page:    defaultPage,
+		listing: defaultListing,
+	}
+	h.formats["html"] = Format{ContentType: "text/html; charset=utf-8", Render: h.renderPage}
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	h.css = template.CSS(html.CSS())
+
+	if h.notebook == nil {
+		h.notebook = nb.New(
+			nb.WithRenderOptions(h.renderOptions...),
+			nb.WithExtensions(h.extensions...),
+		)
+	}
+	h.renderer, h.wrapper = h.notebook.Renderer(), html.NewRenderer()
+	h.configKey = cache.ConfigKey(h.notebook)
+	return &h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.reloader != nil && r.URL.Path == ReloadPath {
+		h.reloader.ServeHTTP(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			redirect(w, r, path.Base(r.URL.Path)+"/")
+			return
+		}
+		h.serveDir(w, r, name, info)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		redirect(w, r, "../"+path.Base(name))
+		return
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	if path.Ext(name) != ".ipynb" {
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(b))
+		return
+	}
+	h.serveNotebook(w, r, name, info, b)
+}
+
+// serveNotebook serves the notebook in the requested format. The ETag is derived from the contents of the file
+// and the format, so conditional requests are answered without rendering the notebook.
+func (h *Handler) serveNotebook(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo, b []byte) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+	w.Header().Set("ETag", `"`+hash[:32]+"-"+format+`"`)
+
+	if format == "raw" {
+		w.Header().Set("Content-Type", "application/x-ipynb+json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(b))
+		return
+	}
+
+	f, ok := h.formats[format]
+	if !ok {
+		w.Header().Del("ETag")
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	if notModified(r, w.Header().Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Formats may include the name of the file, so the key is not only the content hash.
+	key := h.configKey + "\x00" + hash + "\x00" + name + "\x00" + format
+	out, ok := h.cache.Get(key)
+	if !ok {
+		nb, err := decode.Bytes(b)
+		if err != nil {
+			w.Header().Del("ETag")
+			http.Error(w, fmt.Sprintf("%s: %v", name, err), http.StatusUnprocessableEntity)
+			return
+		}
+		var buf bytes.Buffer
+		if err := f.Render(&buf, name, nb); err != nil {
+			w.Header().Del("ETag")
+			http.Error(w, fmt.Sprintf("%s: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		out = buf.Bytes()
+		_ = h.cache.Put(key, out)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(out))
+}
+
+// Page is passed to the page template.
+type Page struct {
+	// Title is the file name of the notebook.
+	Title string
+
+	// Name is the file name of the notebook and Breadcrumbs link to its parent directories.
+	Name        string
+	Breadcrumbs []Link
+
+	// CSS is the stylesheet of the rendered notebook.
+	CSS template.CSS
+
+	// Body is the rendered notebook.
+	Body template.HTML
+
+	// Reload is the relative URL of the live reload event stream, if enabled.
+	Reload string
+}
+
+// Link is a link relative to the current page.
+type Link struct {
+	Name string
+	URL  string
+}
+
+// renderPage renders the notebook as an HTML page.
+func (h *Handler) renderPage(w io.Writer, name string, nb schema.Notebook) error {
+	var body bytes.Buffer
+	// The renderer does not call WrapAll, which opens the notebook container.
+	err := h.wrapper.WrapAll(&body, func(w io.Writer) error {
+		return h.renderer.Render(w, nb)
+	})
+	if err != nil {
+		return err
+	}
+	return h.page.Execute(w, Page{
+		Title:       path.Base(name),
+		Name:        path.Base(name),
+		Breadcrumbs: breadcrumbs(path.Dir(name)),
+		CSS:         h.css,
+		Body:        template.HTML(body.String()),
+		Reload:      h.reloadURL(path.Dir(name)),
+	})
+}
+
+// reloadURL is the URL of the live reload event stream relative to a page in dir,
+// or an empty string if live reload is disabled.
+func (h *Handler) reloadURL(dir string) string {
+	if h.reloader == nil {
+		return ""
+	}
+	return reloadURL(dir)
+}
+
+// Listing is passed to the directory listing template.
+type Listing struct {
+	// Title is the path of the directory.
+	Title string
+
+	// Name is the name of the directory and Breadcrumbs link to its parent directories.
+	Name        string
+	Breadcrumbs []Link
+
+	// Entries are sorted by name, directories first.
+	Entries []Entry
+
+	// Reload is the relative URL of the live reload event stream, if enabled.
+	Reload string
+}
+
+// Entry is a file or a directory in the listing.
+type Entry struct {
+	Name     string
+	URL      string
+	Dir      bool
+	Notebook bool
+}
+
+func (h *Handler) serveDir(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo) {
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	// Listings are served at the directory's path with a trailing slash, like pages in that directory.
+	l := Listing{Title: "/", Name: "Home", Reload: h.reloadURL(name)}
+	if name != "." {
+		l.Title, l.Name = "/"+name+"/", path.Base(name)
+		l.Breadcrumbs = breadcrumbs(path.Join(name, ".."))
+		for i := range l.Breadcrumbs {
+			l.Breadcrumbs[i].URL = "../" + strings.TrimPrefix(l.Breadcrumbs[i].URL, "./")
+		}
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		entry := Entry{
+			Name:     e.Name(),
+			URL:      "./" + url.PathEscape(e.Name()),
+			Dir:      e.IsDir(),
+			Notebook: !e.IsDir() && path.Ext(e.Name()) == ".ipynb",
+		}
+		if entry.Dir {
+			entry.URL += "/"
+		}
+		l.Entries = append(l.Entries, entry)
+	}
+	sort.SliceStable(l.Entries, func(i, j int) bool {
+		return l.Entries[i].Dir && !l.Entries[j].Dir
+	})
+
+	var buf bytes.Buffer
+	if err := h.listing.Execute(&buf, l); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(buf.Bytes()))
+}
+
+// breadcrumbs links to the directory and its parents from a page in that directory.
+func breadcrumbs(dir string) []Link {
+	var parts []string
+	if dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+	links := make([]Link, 0, len(parts)+1)
+	up := strings.Repeat("../", len(parts))
+	links = append(links, Link{Name: "Home", URL: "./" + up})
+	for i, p := range parts {
+		links = append(links, Link{Name: p, URL: "./" + strings.Repeat("../", len(parts)-i-1)})
+	}
+	return links
+}
+
+// notModified checks the ETag against If-None-Match.
+func notModified(r *http.Request, etag string) bool {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// redirect to a path relative to the current one, keeping the query.
+func redirect(w http.ResponseWriter, r *http.Request, to string) {
+	if q := r.URL.RawQuery; q != "" {
+		to += "?" + q
+	}
+	w.Header().Set("Location", to)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
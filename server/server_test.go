@@ -0,0 +1,264 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/cache"
+	"github.com/bevzzz/nb/extension"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/server"
+)
+
+const notebook = `{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+	{"id": "a", "cell_type": "markdown", "metadata": {}, "source": "# Report"},
+	{"id": "b", "cell_type": "code", "metadata": {}, "execution_count": 1, "source": "print('hi')",
+		"outputs": [{"output_type": "stream", "name": "stdout", "text": "hi\n"}]}
+]}`
+
+var modTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"report.ipynb":         {Data: []byte(notebook), ModTime: modTime},
+		"broken.ipynb":         {Data: []byte(`{"nbformat": 4`), ModTime: modTime},
+		"img/plot.png":         {Data: []byte("\x89PNG"), ModTime: modTime},
+		"sub/dir/deep.ipynb":   {Data: []byte(notebook), ModTime: modTime},
+		".ipynb_checkpoints/x": {Data: []byte("hidden"), ModTime: modTime},
+	}
+}
+
+func get(t *testing.T, h http.Handler, target string, header ...string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func body(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestHandler(t *testing.T) {
+	h := server.New(testFS())
+
+	for _, tt := range []struct {
+		name        string
+		target      string
+		status      int
+		contentType string
+		contains    []string
+		location    string
+	}{
+		{
+			name:        "directory listing",
+			target:      "/",
+			status:      http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			contains: []string{
+				`<li class="nb-Viewer-dir"><a href="./img/">img/</a></li>`,
+				`<li class="nb-Viewer-notebook"><a href="./report.ipynb">report.ipynb</a></li>`,
+			},
+		},
+		{
+			name:     "nested directory links to its parents",
+			target:   "/sub/dir/",
+			status:   http.StatusOK,
+			contains: []string{`<a href="../../">Home</a> / <a href="../">sub</a> / dir`},
+		},
+		{
+			name:        "notebook page",
+			target:      "/report.ipynb",
+			status:      http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			contains:    []string{"<title>report.ipynb</title>", `<div class="jp-Notebook">`, "print(", "jp-RenderedText"},
+		},
+		{
+			name:     "notebook page links to its directories",
+			target:   "/sub/dir/deep.ipynb",
+			status:   http.StatusOK,
+			contains: []string{`<a href="./../../">Home</a> / <a href="./../">sub</a> / <a href="./">dir</a> / deep.ipynb`},
+		},
+		{
+			name:        "raw download",
+			target:      "/report.ipynb?format=raw",
+			status:      http.StatusOK,
+			contentType: "application/x-ipynb+json",
+			contains:    []string{`"nbformat": 4`},
+		},
+		{
+			name:        "other files are served as is",
+			target:      "/img/plot.png",
+			status:      http.StatusOK,
+			contentType: "image/png",
+		},
+		{
+			name:     "unknown format",
+			target:   "/report.ipynb?format=pdf",
+			status:   http.StatusBadRequest,
+			contains: []string{`unknown format "pdf"`},
+		},
+		{
+			name:   "invalid notebook",
+			target: "/broken.ipynb",
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "not found",
+			target: "/missing.ipynb",
+			status: http.StatusNotFound,
+		},
+		{
+			name:     "directory without trailing slash",
+			target:   "/sub/dir?x=1",
+			status:   http.StatusMovedPermanently,
+			location: "dir/?x=1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := get(t, h, tt.target)
+			got := body(t, resp)
+
+			require.Equal(t, tt.status, resp.StatusCode, got)
+			if tt.contentType != "" {
+				require.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			}
+			for _, s := range tt.contains {
+				require.Contains(t, got, s)
+			}
+			if tt.location != "" {
+				require.Equal(t, tt.location, resp.Header.Get("Location"))
+			}
+		})
+	}
+
+	t.Run("hidden files are not listed", func(t *testing.T) {
+		require.NotContains(t, body(t, get(t, h, "/")), "ipynb_checkpoints")
+	})
+
+	t.Run("raw download is an attachment", func(t *testing.T) {
+		resp := get(t, h, "/report.ipynb?format=raw")
+		require.Equal(t, `attachment; filename="report.ipynb"`, resp.Header.Get("Content-Disposition"))
+	})
+
+	t.Run("only GET and HEAD are allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/report.ipynb", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		require.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+	})
+}
+
+func TestHandler_conditional(t *testing.T) {
+	h := server.New(testFS())
+
+	resp := get(t, h, "/report.ipynb")
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	require.Equal(t, modTime.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+
+	t.Run("etag depends on the format", func(t *testing.T) {
+		raw := get(t, h, "/report.ipynb?format=raw").Header.Get("ETag")
+		require.NotEqual(t, etag, raw)
+		require.Equal(t, etag[:33], raw[:33], "same content hash")
+	})
+
+	t.Run("if-none-match", func(t *testing.T) {
+		resp := get(t, h, "/report.ipynb", "If-None-Match", `"other", `+etag)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+		require.Empty(t, body(t, resp))
+	})
+
+	t.Run("if-modified-since", func(t *testing.T) {
+		resp := get(t, h, "/report.ipynb", "If-Modified-Since", modTime.Add(time.Hour).Format(http.TimeFormat))
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("stale etag", func(t *testing.T) {
+		resp := get(t, h, "/report.ipynb", "If-None-Match", `"stale-html"`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestWithFormat(t *testing.T) {
+	renders := 0
+	h := server.New(testFS(), server.WithFormat("cells", server.Format{
+		ContentType: "text/plain; charset=utf-8",
+		Render: func(w io.Writer, name string, nb schema.Notebook) error {
+			renders++
+			_, err := io.WriteString(w, name+": "+strings.Repeat("*", len(nb.Cells())))
+			return err
+		},
+	}))
+
+	for i := 0; i < 3; i++ {
+		resp := get(t, h, "/sub/dir/deep.ipynb?format=cells")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		require.Equal(t, "sub/dir/deep.ipynb: **", body(t, resp))
+	}
+	require.Equal(t, 1, renders, "rendered notebook should be cached")
+
+	resp := get(t, h, "/report.ipynb?format=cells")
+	require.Equal(t, "report.ipynb: **", body(t, resp), "files with the same contents are cached separately")
+	require.Equal(t, 2, renders)
+
+	t.Run("cache disabled", func(t *testing.T) {
+		renders = 0
+		h := server.New(testFS(), server.WithCacheSize(0), server.WithFormat("cells", server.Format{
+			Render: func(w io.Writer, name string, nb schema.Notebook) error {
+				renders++
+				return nil
+			},
+		}))
+		get(t, h, "/report.ipynb?format=cells")
+		get(t, h, "/report.ipynb?format=cells")
+		require.Equal(t, 2, renders)
+	})
+}
+
+func TestWithNotebook(t *testing.T) {
+	md := extension.NewMarkdown(func(w io.Writer, cell schema.Cell) error {
+		_, err := io.WriteString(w, "<h1>"+strings.TrimPrefix(string(cell.Text()), "# ")+"</h1>")
+		return err
+	})
+	h := server.New(testFS(), server.WithNotebook(nb.New(nb.WithExtensions(md))))
+
+	resp := get(t, h, "/report.ipynb")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	page := body(t, resp)
+	require.Contains(t, page, "<h1>Report</h1>")
+	require.Contains(t, page, `<div class="jp-Notebook">`, "cells are placed into the notebook container")
+}
+
+func TestWithCache(t *testing.T) {
+	store := cache.NewMemory(1 << 20)
+	prefixed := nb.New(nb.WithRenderer(render.NewRenderer(
+		render.WithCellRenderers(html.NewRenderer(html.WithIDPrefix("nb-"))),
+	)))
+
+	page := body(t, get(t, server.New(testFS(), server.WithCache(store)), "/report.ipynb"))
+	require.Contains(t, page, `id="cell-id=a"`)
+
+	h := server.New(testFS(), server.WithCache(store), server.WithNotebook(prefixed))
+	page = body(t, get(t, h, "/report.ipynb"))
+	require.Contains(t, page, `id="nb-cell-id=a"`, "handlers with different renderer options should not share the output")
+}
@@ -0,0 +1,104 @@
+package site
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bevzzz/nb/merge"
+	"github.com/bevzzz/nb/schema"
+	"github.com/bevzzz/nb/schema/common"
+	v4 "github.com/bevzzz/nb/schema/v4"
+)
+
+var (
+	// mdLink matches the destination of inline links and images: [text](dest "title").
+	mdLink = regexp.MustCompile(`(\]\(\s*<?)([^)\s>]+)`)
+
+	// mdRef matches the destination of link reference definitions: [label]: dest.
+	mdRef = regexp.MustCompile(`(?m)(^ {0,3}\[[^\]]+\]:[ \t]*<?)([^\s>]+)`)
+
+	// htmlAttr matches link attributes in inline HTML.
+	htmlAttr = regexp.MustCompile(`((?:href|src)\s*=\s*["'])([^"']+)`)
+)
+
+// linker rewrites links to other notebooks in the markdown cells of a notebook in dir,
+// and collects the local files they reference.
+type linker struct {
+	src    fs.FS
+	dir    string
+	assets map[string]bool
+}
+
+// notebook rewrites the markdown cells of the notebook. Cells without links to other notebooks are not copied.
+func (l *linker) notebook(nb schema.Notebook) (schema.Notebook, error) {
+	return schema.MapCells(nb, func(_ int, cell schema.Cell) (schema.Cell, error) {
+		if cell.Type() != schema.Markdown {
+			return cell, nil
+		}
+		text, changed := l.rewrite(cell.Text())
+		if !changed {
+			return cell, nil
+		}
+		return withSource(cell, text), nil
+	})
+}
+
+// withSource copies the markdown cell with a new source. Decoded cells are copied into values
+// of the same type, so that renderers treat them like the original.
+func withSource(cell schema.Cell, text []byte) schema.Cell {
+	switch c := cell.(type) {
+	case *v4.Markdown:
+		cp := *c
+		cp.Source = common.MultilineString{string(text)}
+		return &cp
+	case *common.Markdown:
+		cp := *c
+		cp.Source = common.MultilineString{string(text)}
+		return &cp
+	}
+	c := merge.NewCell(cell)
+	c.Source = text
+	return c
+}
+
+// rewrite replaces the links in the markdown text.
+func (l *linker) rewrite(text []byte) ([]byte, bool) {
+	changed := false
+	for _, re := range []*regexp.Regexp{mdLink, mdRef, htmlAttr} {
+		text = re.ReplaceAllFunc(text, func(m []byte) []byte {
+			sub := re.FindSubmatchIndex(m)
+			dest := string(m[sub[4]:sub[5]])
+			if link, ok := l.link(dest); ok && link != dest {
+				changed = true
+				return append(append([]byte(nil), m[:sub[4]]...), link...)
+			}
+			return m
+		})
+	}
+	return text, changed
+}
+
+// link resolves a relative link. Links to notebooks are rewritten to their pages,
+// links to other files in the source tree are recorded as assets.
+// Absolute URLs, fragments, and links outside of the source tree are kept as is.
+func (l *linker) link(dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return dest, false
+	}
+	target := path.Join(l.dir, u.Path)
+	if !fs.ValidPath(target) {
+		return dest, false
+	}
+	if path.Ext(u.Path) == ".ipynb" {
+		u.Path = strings.TrimSuffix(u.Path, ".ipynb") + ".html"
+		return u.String(), true
+	}
+	if info, err := fs.Stat(l.src, target); err == nil && info.Mode().IsRegular() {
+		l.assets[target] = true
+	}
+	return dest, true
+}
@@ -0,0 +1,83 @@
+package site
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/bevzzz/nb/extension/toc"
+	"github.com/bevzzz/nb/schema"
+)
+
+// Title looks for the "title" key in the notebook's metadata and the first heading in its markdown cells.
+// If neither is present, the title is the file name without the extension.
+func Title(nb schema.Notebook, name string) string {
+	if m, ok := nb.(schema.HasMetadata); ok && len(m.RawMetadata()) > 0 {
+		var meta struct {
+			Title string `json:"title"`
+		}
+		if json.Unmarshal(m.RawMetadata(), &meta) == nil && meta.Title != "" {
+			return meta.Title
+		}
+	}
+
+	var slug toc.Slugger
+	for i, cell := range nb.Cells() {
+		if hs := toc.Headings(cell, i, &slug); len(hs) > 0 {
+			return hs[0].Text
+		}
+	}
+	return strings.TrimSuffix(path.Base(name), path.Ext(name))
+}
+
+// images lists the image mime-types which can be used as thumbnails with their file extensions.
+var images = []struct{ mime, ext string }{
+	{"image/png", ".png"},
+	{"image/jpeg", ".jpg"},
+	{"image/gif", ".gif"},
+	{"image/svg+xml", ".svg"},
+}
+
+// Thumbnail returns the last image in the outputs of the notebook's code cells and the extension of its file.
+// It returns a nil slice if there are no images.
+func Thumbnail(nb schema.Notebook) ([]byte, string) {
+	cells := nb.Cells()
+	for i := len(cells) - 1; i >= 0; i-- {
+		out, ok := cells[i].(schema.Outputter)
+		if !ok {
+			continue
+		}
+		outs := out.Outputs()
+		for j := len(outs) - 1; j >= 0; j-- {
+			if b, ext := image(outs[j]); b != nil {
+				return b, ext
+			}
+		}
+	}
+	return nil, ""
+}
+
+// image decodes the image in the output. Outputs with several representations are checked for each of the images.
+func image(out schema.Cell) ([]byte, string) {
+	bundle, _ := out.(interface{ Data(string) []byte })
+	for _, img := range images {
+		var data []byte
+		if bundle != nil {
+			data = bundle.Data(img.mime)
+		} else if out.MimeType() == img.mime {
+			data = out.Text()
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if img.mime == "image/svg+xml" {
+			return data, img.ext
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+		if err == nil && len(b) > 0 {
+			return b, img.ext
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,546 @@
+// Package site builds a static website from a tree of notebooks.
+//
+// Every notebook is rendered to an HTML page next to where it is in the source tree, so that
+// "guide/intro.ipynb" becomes "guide/intro.html". Each directory with notebooks gets an index page
+// which lists them with their titles and thumbnails, unless it has its own "index.ipynb".
+// Links to other notebooks in markdown cells are rewritten to link to their pages, and the local files
+// referenced from markdown, like images, are copied to the output directory:
+//
+//	res, err := site.Build(os.DirFS("notebooks"), "public")
+//
+// Builds are incremental: the content hashes of the inputs are stored in a manifest in the output directory,
+// and notebooks which have not changed since the last build are not rendered again. The manifest does not record
+// how the pages were rendered, so use WithForce to rebuild everything after changing the options or templates.
+package site
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bevzzz/nb"
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/render"
+	"github.com/bevzzz/nb/render/html"
+)
+
+const (
+	// ManifestName is the file in the output directory which records the inputs of the last build.
+	ManifestName = ".nb-site.json"
+
+	// StylesheetName is the file in the output directory which styles the notebooks.
+	StylesheetName = "nb.css"
+)
+
+//go:embed page.html
+var pageTemplate string
+
+//go:embed index.html
+var indexTemplate string
+
+var (
+	defaultPage  = template.Must(template.New("page").Parse(pageTemplate))
+	defaultIndex = template.Must(template.New("index").Parse(indexTemplate))
+)
+
+// Page is passed to the page template.
+type Page struct {
+	// Title is the notebook's title (see Title).
+	Title string
+
+	// Stylesheet and Index are relative URLs of the stylesheet and the index page of the directory.
+	// Index is empty for the top-level "index.ipynb".
+	Stylesheet string
+	Index      string
+
+	// Body is the rendered notebook.
+	Body template.HTML
+}
+
+// Index is passed to the index template.
+type Index struct {
+	// Title is the name of the directory, or the site's title for the top level.
+	Title string
+
+	// Stylesheet and Parent are relative URLs of the stylesheet and the index page of the parent directory.
+	// Parent is empty for the top level.
+	Stylesheet string
+	Parent     string
+
+	// Dirs are the subdirectories with notebooks and Pages are the notebooks in the directory, sorted by name.
+	Dirs  []Link
+	Pages []Card
+}
+
+// Link is a relative link.
+type Link struct {
+	Name string
+	URL  string
+}
+
+// Card describes a notebook in the index.
+type Card struct {
+	Title string
+	Name  string // file name of the notebook
+	URL   string
+
+	// Thumbnail is the relative URL of the last image in the notebook's outputs, if any.
+	Thumbnail string
+}
+
+// Result lists the paths of the inputs and outputs of a build, relative to their directories.
+type Result struct {
+	// Built notebooks were rendered and Skipped ones have not changed since the last build.
+	Built   []string
+	Skipped []string
+
+	// Copied are the assets which were added or changed.
+	Copied []string
+
+	// Removed are the outputs of the previous build whose inputs are gone.
+	Removed []string
+}
+
+// Option configures a Builder.
+type Option func(*Builder)
+
+// WithExtensions adds extensions to the converter which renders the notebooks.
+func WithExtensions(exts ...nb.Extension) Option {
+	return func(b *Builder) {
+		b.extensions = append(b.extensions, exts...)
+	}
+}
+
+// WithRenderOptions configures the renderer of the notebooks.
+func WithRenderOptions(opts ...render.Option) Option {
+	return func(b *Builder) {
+		b.renderOptions = append(b.renderOptions, opts...)
+	}
+}
+
+// WithTemplates replaces the templates of the notebook pages and the index pages.
+// The page template receives a Page and the index template receives an Index.
+// A nil template keeps the default one.
+func WithTemplates(page, index *template.Template) Option {
+	return func(b *Builder) {
+		if page != nil {
+			b.page = page
+		}
+		if index != nil {
+			b.index = index
+		}
+	}
+}
+
+// WithTitle sets the title of the top-level index page. The default is "Notebooks".
+func WithTitle(title string) Option {
+	return func(b *Builder) {
+		b.title = title
+	}
+}
+
+// WithForce rebuilds all notebooks and copies all assets, even if they have not changed.
+func WithForce() Option {
+	return func(b *Builder) {
+		b.force = true
+	}
+}
+
+// Builder renders notebooks to a static website.
+type Builder struct {
+	page, index *template.Template
+	title       string
+	force       bool
+	css         []byte
+
+	extensions    []nb.Extension
+	renderOptions []render.Option
+	renderer      render.Renderer
+	wrapper       render.CellWrapper
+}
+
+// New creates a Builder.
+func New(opts ...Option) *Builder {
+	b := Builder{
+		page:  defaultPage,
+		index: defaultIndex,
+		title: "Notebooks",
+	}
+	for _, opt := range opts {
+		opt(&b)
+	}
+
+	b.css = html.CSS()
+
+	hr := html.NewRenderer()
+	c := nb.New(
+		nb.WithRenderer(render.NewRenderer(render.WithCellRenderers(hr))),
+		nb.WithRenderOptions(b.renderOptions...),
+		nb.WithExtensions(b.extensions...),
+	)
+	b.renderer, b.wrapper = c.Renderer(), hr
+	return &b
+}
+
+// Build renders the notebooks in src to the directory dst with the default Builder.
+func Build(src fs.FS, dst string, opts ...Option) (*Result, error) {
+	return New(opts...).Build(src, dst)
+}
+
+// manifest records the inputs of a build.
+type manifest struct {
+	// Pages are keyed by the path of the notebook.
+	Pages map[string]*pageInfo `json:"pages"`
+
+	// Assets map the paths of the copied files to the hashes of their contents.
+	Assets map[string]string `json:"assets"`
+
+	// Indexes are the generated index pages.
+	Indexes []string `json:"indexes"`
+}
+
+type pageInfo struct {
+	Hash      string   `json:"hash"`
+	Title     string   `json:"title"`
+	Thumbnail string   `json:"thumbnail,omitempty"`
+	Assets    []string `json:"assets,omitempty"`
+}
+
+// Build renders the notebooks in src to the directory dst, creating it if necessary.
+// Hidden files and directories, like ".ipynb_checkpoints", are ignored.
+func (b *Builder) Build(src fs.FS, dst string) (*Result, error) {
+	prev := loadManifest(dst)
+	next := manifest{Pages: make(map[string]*pageInfo), Assets: make(map[string]string)}
+	var res Result
+
+	notebooks, err := find(src)
+	if err != nil {
+		return nil, fmt.Errorf("site: %w", err)
+	}
+
+	for _, name := range notebooks {
+		data, err := fs.ReadFile(src, name)
+		if err != nil {
+			return nil, fmt.Errorf("site: %w", err)
+		}
+		hash := hashOf(data)
+		if old, ok := prev.Pages[name]; ok && old.Hash == hash && !b.force && exists(dst, pageName(name)) {
+			next.Pages[name] = old
+			res.Skipped = append(res.Skipped, name)
+			continue
+		}
+		info, err := b.buildPage(src, dst, name, data)
+		if err != nil {
+			return nil, fmt.Errorf("site: %s: %w", name, err)
+		}
+		info.Hash = hash
+		next.Pages[name] = info
+		res.Built = append(res.Built, name)
+	}
+
+	if err := b.copyAssets(src, dst, prev, &next, &res); err != nil {
+		return nil, fmt.Errorf("site: %w", err)
+	}
+	if err := writeFile(dst, StylesheetName, b.css); err != nil {
+		return nil, fmt.Errorf("site: %w", err)
+	}
+	if err := b.buildIndexes(dst, &next); err != nil {
+		return nil, fmt.Errorf("site: %w", err)
+	}
+	res.Removed = removeStale(dst, prev, &next)
+
+	if err := saveManifest(dst, &next); err != nil {
+		return nil, fmt.Errorf("site: %w", err)
+	}
+	return &res, nil
+}
+
+// find lists the notebooks in the source tree, skipping hidden files and directories.
+func find(src fs.FS) ([]string, error) {
+	var notebooks []string
+	err := fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && path.Ext(p) == ".ipynb" {
+			notebooks = append(notebooks, p)
+		}
+		return nil
+	})
+	return notebooks, err
+}
+
+// buildPage renders the notebook and writes its thumbnail.
+func (b *Builder) buildPage(src fs.FS, dst, name string, data []byte) (*pageInfo, error) {
+	decoded, err := decode.Bytes(data)
+	if err != nil {
+		return nil, err
+	}
+	info := pageInfo{Title: Title(decoded, name)}
+
+	l := linker{src: src, dir: path.Dir(name), assets: make(map[string]bool)}
+	rewritten, err := l.notebook(decoded)
+	if err != nil {
+		return nil, err
+	}
+	for a := range l.assets {
+		info.Assets = append(info.Assets, a)
+	}
+	sort.Strings(info.Assets)
+
+	var body bytes.Buffer
+	// The renderer does not call WrapAll, which opens the notebook container.
+	err = b.wrapper.WrapAll(&body, func(w io.Writer) error {
+		return b.renderer.Render(w, rewritten)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Dir(name)
+	p := Page{
+		Title:      info.Title,
+		Stylesheet: relative(dir, StylesheetName),
+		Index:      "index.html",
+	}
+	if path.Base(name) == "index.ipynb" {
+		p.Index = ""
+		if dir != "." {
+			p.Index = "../index.html"
+		}
+	}
+	p.Body = template.HTML(body.String())
+
+	var page bytes.Buffer
+	if err := b.page.Execute(&page, p); err != nil {
+		return nil, err
+	}
+	if err := writeFile(dst, pageName(name), page.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if img, ext := Thumbnail(decoded); img != nil {
+		info.Thumbnail = strings.TrimSuffix(name, ".ipynb") + ".thumb" + ext
+		if err := writeFile(dst, info.Thumbnail, img); err != nil {
+			return nil, err
+		}
+	}
+	return &info, nil
+}
+
+// copyAssets copies the files referenced by the notebooks which have changed since the last build.
+func (b *Builder) copyAssets(src fs.FS, dst string, prev, next *manifest, res *Result) error {
+	assets := make(map[string]bool)
+	for _, info := range next.Pages {
+		for _, a := range info.Assets {
+			assets[a] = true
+		}
+	}
+	names := make([]string, 0, len(assets))
+	for a := range assets {
+		names = append(names, a)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := fs.ReadFile(src, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // removed since the notebook which references it was built
+		} else if err != nil {
+			return err
+		}
+		hash := hashOf(data)
+		next.Assets[name] = hash
+		if prev.Assets[name] == hash && !b.force && exists(dst, name) {
+			continue
+		}
+		if err := writeFile(dst, name, data); err != nil {
+			return err
+		}
+		res.Copied = append(res.Copied, name)
+	}
+	return nil
+}
+
+// buildIndexes writes the index pages of the directories with notebooks.
+func (b *Builder) buildIndexes(dst string, m *manifest) error {
+	pages := make(map[string][]string) // notebooks by directory
+	subdirs := make(map[string]map[string]bool)
+	for name := range m.Pages {
+		dir := path.Dir(name)
+		pages[dir] = append(pages[dir], name)
+		for dir != "." {
+			parent := path.Dir(dir)
+			if subdirs[parent] == nil {
+				subdirs[parent] = make(map[string]bool)
+			}
+			subdirs[parent][path.Base(dir)] = true
+			if _, ok := pages[parent]; !ok {
+				pages[parent] = nil
+			}
+			dir = parent
+		}
+	}
+
+	dirs := make([]string, 0, len(pages))
+	for dir := range pages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if _, ok := m.Pages[path.Join(dir, "index.ipynb")]; ok {
+			continue
+		}
+		idx := Index{Title: b.title, Stylesheet: relative(dir, StylesheetName)}
+		if dir != "." {
+			idx.Title, idx.Parent = path.Base(dir), "../index.html"
+		}
+
+		names := make([]string, 0, len(subdirs[dir]))
+		for sub := range subdirs[dir] {
+			names = append(names, sub)
+		}
+		sort.Strings(names)
+		for _, sub := range names {
+			idx.Dirs = append(idx.Dirs, Link{Name: sub, URL: sub + "/index.html"})
+		}
+
+		sort.Strings(pages[dir])
+		for _, name := range pages[dir] {
+			info := m.Pages[name]
+			card := Card{Title: info.Title, Name: path.Base(name), URL: path.Base(pageName(name))}
+			if info.Thumbnail != "" {
+				card.Thumbnail = path.Base(info.Thumbnail)
+			}
+			idx.Pages = append(idx.Pages, card)
+		}
+
+		var buf bytes.Buffer
+		if err := b.index.Execute(&buf, idx); err != nil {
+			return err
+		}
+		name := path.Join(dir, "index.html")
+		if err := writeFile(dst, name, buf.Bytes()); err != nil {
+			return err
+		}
+		m.Indexes = append(m.Indexes, name)
+	}
+	return nil
+}
+
+// removeStale deletes the outputs of the previous build which are not part of the next one.
+func removeStale(dst string, prev, next *manifest) []string {
+	keep := make(map[string]bool)
+	for name, info := range next.Pages {
+		keep[pageName(name)] = true
+		keep[info.Thumbnail] = true
+	}
+	for name := range next.Assets {
+		keep[name] = true
+	}
+	for _, name := range next.Indexes {
+		keep[name] = true
+	}
+
+	var stale []string
+	for name, info := range prev.Pages {
+		stale = append(stale, pageName(name), info.Thumbnail)
+	}
+	for name := range prev.Assets {
+		stale = append(stale, name)
+	}
+	stale = append(stale, prev.Indexes...)
+	sort.Strings(stale)
+
+	var removed []string
+	for _, name := range stale {
+		if name == "" || keep[name] {
+			continue
+		}
+		if err := os.Remove(osPath(dst, name)); err == nil {
+			removed = append(removed, name)
+		}
+		keep[name] = true // listed once
+	}
+	return removed
+}
+
+// loadManifest reads the manifest of the previous build. A missing or invalid manifest means that
+// everything has to be built.
+func loadManifest(dst string) *manifest {
+	var m manifest
+	if data, err := os.ReadFile(osPath(dst, ManifestName)); err == nil {
+		if json.Unmarshal(data, &m) != nil {
+			m = manifest{}
+		}
+	}
+	return &m
+}
+
+func saveManifest(dst string, m *manifest) error {
+	sort.Strings(m.Indexes)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(dst, ManifestName, data)
+}
+
+// pageName is the path of the notebook's page.
+func pageName(name string) string {
+	return strings.TrimSuffix(name, ".ipynb") + ".html"
+}
+
+// relative returns the URL of a file at the top level of the site relative to dir.
+func relative(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return strings.Repeat("../", strings.Count(dir, "/")+1) + name
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func osPath(dst, name string) string {
+	return filepath.Join(dst, filepath.FromSlash(name))
+}
+
+func exists(dst, name string) bool {
+	_, err := os.Stat(osPath(dst, name))
+	return err == nil
+}
+
+// writeFile writes the data to the file in dst, creating the directories as needed.
+// Files which already have the same contents are not modified.
+func writeFile(dst, name string, data []byte) error {
+	p := osPath(dst, name)
+	if old, err := os.ReadFile(p); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
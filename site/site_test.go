@@ -0,0 +1,183 @@
+package site_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/site"
+)
+
+// intro links to the guide and an image, and has a plot in its outputs.
+const intro = `{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+	{"id": "a", "cell_type": "markdown", "metadata": {}, "source": [
+		"# Introduction\n",
+		"See [the guide](guide/usage.ipynb#setup), ![logo](img/logo.png) and [docs](https://example.com/a.ipynb).\n",
+		"<a href=\"guide/usage.ipynb\">guide</a>"
+	]},
+	{"id": "b", "cell_type": "code", "metadata": {}, "execution_count": 1, "source": "plot()", "outputs": [
+		{"output_type": "display_data", "metadata": {}, "data": {"image/png": "aGVsbG8=", "text/plain": "<Figure>"}}
+	]}
+]}`
+
+const usage = `{"metadata": {"title": "Usage"}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+	{"id": "a", "cell_type": "markdown", "metadata": {}, "source": "Back to [intro](../intro.ipynb)"}
+]}`
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"intro.ipynb":                          {Data: []byte(intro)},
+		"guide/usage.ipynb":                    {Data: []byte(usage)},
+		"img/logo.png":                         {Data: []byte("logo")},
+		"img/unused.png":                       {Data: []byte("unused")},
+		"guide/.ipynb_checkpoints/usage.ipynb": {Data: []byte(usage)},
+	}
+}
+
+func read(t *testing.T, dst, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestBuild(t *testing.T) {
+	dst := t.TempDir()
+	res, err := site.Build(testFS(), dst, site.WithTitle("Gallery"))
+	require.NoError(t, err)
+
+	require.Equal(t, &site.Result{
+		Built:  []string{"guide/usage.ipynb", "intro.ipynb"},
+		Copied: []string{"img/logo.png"},
+	}, res)
+
+	t.Run("pages", func(t *testing.T) {
+		page := read(t, dst, "intro.html")
+		require.Contains(t, page, "<title>Introduction</title>")
+		require.Contains(t, page, `href="nb.css"`)
+		require.Contains(t, page, "[the guide](guide/usage.html#setup)")
+		require.Contains(t, page, "(https://example.com/a.ipynb)", "absolute links are kept")
+		require.Contains(t, page, `<a href="guide/usage.html">guide</a>`)
+		require.Equal(t, 1, strings.Count(page, "jp-Cell-outputWrapper"), "only code cells have outputs")
+		require.NotContains(t, page, "In\u00a0[0]:", "markdown cells have no prompt")
+
+		page = read(t, dst, "guide/usage.html")
+		require.Contains(t, page, `href="../nb.css"`)
+		require.Contains(t, page, "[intro](../intro.html)")
+	})
+
+	t.Run("assets and thumbnails", func(t *testing.T) {
+		require.Equal(t, "logo", read(t, dst, "img/logo.png"))
+		require.NoFileExists(t, filepath.Join(dst, "img", "unused.png"))
+		require.Equal(t, "hello", read(t, dst, "intro.thumb.png"))
+		require.NotEmpty(t, read(t, dst, site.StylesheetName))
+	})
+
+	t.Run("indexes", func(t *testing.T) {
+		index := read(t, dst, "index.html")
+		require.Contains(t, index, "<h1>Gallery</h1>")
+		require.Contains(t, index, `<a href="guide/index.html">guide/</a>`)
+		require.Contains(t, index, `<a href="intro.html" title="intro.ipynb"><img src="intro.thumb.png" alt=""><span>Introduction</span></a>`)
+
+		index = read(t, dst, "guide/index.html")
+		require.Contains(t, index, `<a href="../index.html">Up</a>`)
+		require.Contains(t, index, `<span>Usage</span>`)
+		require.NotContains(t, index, "img/index.html")
+	})
+
+	t.Run("unchanged notebooks are skipped", func(t *testing.T) {
+		fsys := testFS()
+		fsys["guide/usage.ipynb"] = &fstest.MapFile{Data: []byte(usage + "\n")}
+
+		res, err := site.Build(fsys, dst, site.WithTitle("Gallery"))
+		require.NoError(t, err)
+		require.Equal(t, &site.Result{
+			Built:   []string{"guide/usage.ipynb"},
+			Skipped: []string{"intro.ipynb"},
+		}, res)
+		require.Contains(t, read(t, dst, "index.html"), "<span>Introduction</span>", "index keeps skipped notebooks")
+	})
+
+	t.Run("force", func(t *testing.T) {
+		res, err := site.Build(testFS(), dst, site.WithForce())
+		require.NoError(t, err)
+		require.Len(t, res.Built, 2)
+		require.Equal(t, []string{"img/logo.png"}, res.Copied)
+	})
+
+	t.Run("removed notebooks", func(t *testing.T) {
+		fsys := testFS()
+		delete(fsys, "intro.ipynb")
+
+		res, err := site.Build(fsys, dst)
+		require.NoError(t, err)
+		require.Equal(t, []string{"img/logo.png", "intro.html", "intro.thumb.png"}, res.Removed)
+		require.NoFileExists(t, filepath.Join(dst, "intro.html"))
+		require.FileExists(t, filepath.Join(dst, "guide", "usage.html"))
+		require.FileExists(t, filepath.Join(dst, "index.html"), "parent directories are still indexed")
+	})
+}
+
+func TestBuild_indexNotebook(t *testing.T) {
+	dst := t.TempDir()
+	fsys := testFS()
+	fsys["index.ipynb"] = &fstest.MapFile{Data: []byte(usage)}
+
+	_, err := site.Build(fsys, dst)
+	require.NoError(t, err)
+	require.Contains(t, read(t, dst, "index.html"), "<title>Usage</title>", "index.ipynb replaces the generated index")
+	require.Contains(t, read(t, dst, "guide/index.html"), `<a href="../index.html">Up</a>`)
+}
+
+func TestTitle(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		notebook string
+		want     string
+	}{
+		{
+			name:     "metadata",
+			notebook: usage,
+			want:     "Usage",
+		},
+		{
+			name:     "first heading",
+			notebook: intro,
+			want:     "Introduction",
+		},
+		{
+			name:     "file name",
+			notebook: `{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": []}`,
+			want:     "report",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			nb, err := decode.Bytes([]byte(tt.notebook))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, site.Title(nb, "dir/report.ipynb"))
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	nb, err := decode.Bytes([]byte(`{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [
+		{"id": "a", "cell_type": "code", "metadata": {}, "execution_count": 1, "source": "", "outputs": [
+			{"output_type": "display_data", "metadata": {}, "data": {"image/png": "Zmlyc3Q="}},
+			{"output_type": "display_data", "metadata": {}, "data": {"text/html": "<svg/>", "image/svg+xml": "<svg/>"}}
+		]},
+		{"id": "b", "cell_type": "code", "metadata": {}, "execution_count": 2, "source": "", "outputs": [
+			{"output_type": "stream", "name": "stdout", "text": "no images"}
+		]}
+	]}`))
+	require.NoError(t, err)
+
+	img, ext := site.Thumbnail(nb)
+	require.Equal(t, "<svg/>", string(img))
+	require.Equal(t, ".svg", ext)
+}
@@ -0,0 +1,509 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// node is a compiled JSON Schema (draft-04). Only the keywords used by the nbformat schemas are supported.
+type node struct {
+	ref *node // ref is the schema referenced by "$ref". Other keywords are ignored if it is set.
+
+	types    []string
+	enum     []interface{}
+	required []string
+
+	properties        map[string]*node
+	patternProperties []patternNode
+	// additionalProperties is nil if any additional property is allowed.
+	// A schema which fails on any value is used if they are not allowed.
+	additionalProperties *node
+	forbidden            bool // forbidden is true for the "false" schema.
+
+	items       *node
+	uniqueItems bool
+
+	minimum, maximum     *float64
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	allOf, anyOf, oneOf []*node
+	not                 *node
+}
+
+type patternNode struct {
+	re   *regexp.Regexp
+	node *node
+}
+
+// compiler compiles a schema document, resolving local references.
+type compiler struct {
+	doc  interface{}
+	refs map[string]*node
+}
+
+// compile parses the schema document and compiles its root schema.
+func compile(data []byte) (*node, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	c := compiler{doc: doc, refs: make(map[string]*node)}
+	return c.compile(doc, "#")
+}
+
+func (c *compiler) compile(v interface{}, at string) (*node, error) {
+	switch v := v.(type) {
+	case bool:
+		return &node{forbidden: !v}, nil
+	case map[string]interface{}:
+		return c.compileObject(v, at)
+	}
+	return nil, fmt.Errorf("%s: schema must be an object or a boolean", at)
+}
+
+func (c *compiler) compileObject(obj map[string]interface{}, at string) (n *node, err error) {
+	n = new(node)
+	if ref, ok := obj["$ref"].(string); ok {
+		n.ref, err = c.resolve(ref)
+		return n, err
+	}
+
+	switch t := obj["type"].(type) {
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				n.types = append(n.types, s)
+			}
+		}
+	}
+
+	if enum, ok := obj["enum"].([]interface{}); ok {
+		n.enum = enum
+	}
+	if req, ok := obj["required"].([]interface{}); ok {
+		for _, v := range req {
+			if s, ok := v.(string); ok {
+				n.required = append(n.required, s)
+			}
+		}
+	}
+
+	if props, ok := obj["properties"].(map[string]interface{}); ok {
+		n.properties = make(map[string]*node, len(props))
+		for k, v := range props {
+			if n.properties[k], err = c.compile(v, at+"/properties/"+k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if props, ok := obj["patternProperties"].(map[string]interface{}); ok {
+		for _, pattern := range sortedKeys(props) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s/patternProperties: %w", at, err)
+			}
+			pn, err := c.compile(props[pattern], at+"/patternProperties/"+pattern)
+			if err != nil {
+				return nil, err
+			}
+			n.patternProperties = append(n.patternProperties, patternNode{re: re, node: pn})
+		}
+	}
+	if v, ok := obj["additionalProperties"]; ok {
+		if n.additionalProperties, err = c.compile(v, at+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, ok := obj["items"]; ok {
+		if n.items, err = c.compile(v, at+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	n.uniqueItems, _ = obj["uniqueItems"].(bool)
+
+	n.minimum = number(obj["minimum"])
+	n.maximum = number(obj["maximum"])
+	n.minLength = integer(obj["minLength"])
+	n.maxLength = integer(obj["maxLength"])
+	if p, ok := obj["pattern"].(string); ok {
+		if n.pattern, err = regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %w", at, err)
+		}
+	}
+
+	for _, kw := range []struct {
+		name string
+		dst  *[]*node
+	}{{"allOf", &n.allOf}, {"anyOf", &n.anyOf}, {"oneOf", &n.oneOf}} {
+		list, _ := obj[kw.name].([]interface{})
+		for i, v := range list {
+			sub, err := c.compile(v, fmt.Sprintf("%s/%s/%d", at, kw.name, i))
+			if err != nil {
+				return nil, err
+			}
+			*kw.dst = append(*kw.dst, sub)
+		}
+	}
+	if v, ok := obj["not"]; ok {
+		if n.not, err = c.compile(v, at+"/not"); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// resolve compiles the schema referenced by a local JSON pointer, e.g. "#/definitions/cell".
+// Compiled references are cached, which also allows recursive schemas.
+func (c *compiler) resolve(ref string) (*node, error) {
+	if n, ok := c.refs[ref]; ok {
+		return n, nil
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("%s: only local references are supported", ref)
+	}
+
+	v := c.doc
+	for _, tok := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: cannot resolve reference", ref)
+		}
+		if v, ok = obj[unescape(tok)]; !ok {
+			return nil, fmt.Errorf("%s: cannot resolve reference", ref)
+		}
+	}
+
+	// Register a placeholder before compiling to break reference cycles.
+	n := new(node)
+	c.refs[ref] = n
+	compiled, err := c.compile(v, ref)
+	if err != nil {
+		return nil, err
+	}
+	*n = *compiled
+	return n, nil
+}
+
+// validator collects violations while walking the document.
+type validator struct {
+	violations []Violation
+	failFast   bool // failFast stops validation after the first violation.
+}
+
+func (v *validator) report(path, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// valid reports whether the value conforms to the schema without recording any violations.
+func valid(n *node, value interface{}) bool {
+	v := validator{failFast: true}
+	v.validate(n, value, "")
+	return len(v.violations) == 0
+}
+
+// validate checks value against n and records violations found at path.
+func (v *validator) validate(n *node, value interface{}, path string) {
+	if v.failFast && len(v.violations) > 0 {
+		return
+	}
+	for n.ref != nil {
+		n = n.ref
+	}
+	if n.forbidden {
+		v.report(path, "value is not allowed")
+		return
+	}
+
+	if len(n.types) > 0 && !matchType(n.types, value) {
+		v.report(path, "expected %s, got %s", strings.Join(n.types, " or "), typeOf(value))
+		return
+	}
+	if n.enum != nil && !inEnum(n.enum, value) {
+		v.report(path, "must be one of %s", formatEnum(n.enum))
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(n, value, path)
+	case []interface{}:
+		v.validateArray(n, value, path)
+	case string:
+		v.validateString(n, value, path)
+	case json.Number:
+		v.validateNumber(n, value, path)
+	}
+
+	for _, sub := range n.allOf {
+		v.validate(sub, value, path)
+	}
+	if len(n.anyOf) > 0 {
+		var ok bool
+		for _, sub := range n.anyOf {
+			if ok = valid(sub, value); ok {
+				break
+			}
+		}
+		if !ok {
+			v.report(path, "does not match any of the allowed schemas")
+		}
+	}
+	if len(n.oneOf) > 0 {
+		v.validateOneOf(n.oneOf, value, path)
+	}
+	if n.not != nil && valid(n.not, value) {
+		v.report(path, "matches a schema that is not allowed")
+	}
+}
+
+func (v *validator) validateObject(n *node, obj map[string]interface{}, path string) {
+	for _, key := range n.required {
+		if _, ok := obj[key]; !ok {
+			v.report(path, "missing required property %q", key)
+		}
+	}
+
+	for _, key := range sortedKeys(obj) {
+		value, at := obj[key], path+"/"+escape(key)
+		var matched bool
+		if sub, ok := n.properties[key]; ok {
+			matched = true
+			v.validate(sub, value, at)
+		}
+		for _, pp := range n.patternProperties {
+			if pp.re.MatchString(key) {
+				matched = true
+				v.validate(pp.node, value, at)
+			}
+		}
+		if matched || n.additionalProperties == nil {
+			continue
+		}
+		if n.additionalProperties.forbidden {
+			v.report(path, "additional property %q is not allowed", key)
+			continue
+		}
+		v.validate(n.additionalProperties, value, at)
+	}
+}
+
+func (v *validator) validateArray(n *node, arr []interface{}, path string) {
+	if n.items != nil {
+		for i, item := range arr {
+			v.validate(n.items, item, path+"/"+strconv.Itoa(i))
+		}
+	}
+	if n.uniqueItems {
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if equal(arr[i], arr[j]) {
+					v.report(path, "items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(n *node, s string, path string) {
+	length := utf8.RuneCountInString(s)
+	if n.minLength != nil && length < *n.minLength {
+		v.report(path, "must be at least %d characters long", *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		v.report(path, "must be at most %d characters long", *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		v.report(path, "does not match pattern %q", n.pattern)
+	}
+}
+
+func (v *validator) validateNumber(n *node, num json.Number, path string) {
+	f, err := num.Float64()
+	if err != nil {
+		return
+	}
+	if n.minimum != nil && f < *n.minimum {
+		v.report(path, "must be greater than or equal to %v", *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		v.report(path, "must be less than or equal to %v", *n.maximum)
+	}
+}
+
+// validateOneOf requires the value to match exactly one schema.
+// If it matches none, the violations are reported for the schema which the value
+// was most likely meant to match, e.g. a code cell schema for an object with "cell_type": "code".
+func (v *validator) validateOneOf(schemas []*node, value interface{}, path string) {
+	var matched int
+	for _, sub := range schemas {
+		if valid(sub, value) {
+			matched++
+		}
+	}
+	switch {
+	case matched == 1:
+		return
+	case matched > 1:
+		v.report(path, "matches more than one of the allowed schemas")
+		return
+	}
+
+	if sub := discriminate(schemas, value); sub != nil {
+		v.validate(sub, value, path)
+		return
+	}
+	v.report(path, "does not match any of the allowed schemas")
+}
+
+// discriminate returns the only schema whose single-valued enum properties,
+// such as "cell_type" or "output_type", are matched by the object.
+func discriminate(schemas []*node, value interface{}) (found *node) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, sub := range schemas {
+		for sub.ref != nil {
+			sub = sub.ref
+		}
+		var keys int
+		for key, prop := range sub.properties {
+			for prop.ref != nil {
+				prop = prop.ref
+			}
+			if len(prop.enum) == 0 || len(prop.enum) > 2 {
+				continue
+			}
+			keys++
+			if !inEnum(prop.enum, obj[key]) {
+				keys = -1
+				break
+			}
+		}
+		if keys <= 0 {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = sub
+	}
+	return found
+}
+
+func matchType(types []string, value interface{}) bool {
+	for _, t := range types {
+		switch got := typeOf(value); {
+		case got == t:
+			return true
+		case t == "number" && got == "integer":
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of the value decoded with json.Decoder.UseNumber.
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if equal(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares JSON values. Numbers are equal if they have the same numeric value.
+func equal(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func formatEnum(enum []interface{}) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		b, _ := json.Marshal(e)
+		parts[i] = string(b)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func number(v interface{}) *float64 {
+	f, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+func integer(v interface{}) *int {
+	f, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	i := int(f)
+	return &i
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape encodes a reference token of a JSON pointer as per RFC 6901.
+func escape(tok string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(tok)
+}
+
+func unescape(tok string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+}
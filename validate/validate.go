@@ -0,0 +1,184 @@
+// Package validate checks Jupyter notebooks against the [nbformat JSON schemas].
+//
+// Schemas for v3.0 and v4.0 through v4.5 are embedded in the package. A document is validated
+// against the schema for its declared version, and newer minor versions of a known major version
+// are validated against the latest schema available for it.
+//
+// Validation is independent of decoding and can be used on its own or as a decode option:
+//
+//	if err := validate.Bytes(b); err != nil {
+//		var verr *validate.Error
+//		if errors.As(err, &verr) {
+//			// inspect verr.Violations
+//		}
+//	}
+//
+//	nb, err := decode.Bytes(b, validate.WithValidation())
+//
+// [nbformat JSON schemas]: https://github.com/jupyter/nbformat/tree/main/nbformat
+package validate
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/schema"
+)
+
+//go:embed schema/*.json
+var schemaFS embed.FS
+
+// Bytes validates raw notebook JSON. It returns *Error listing all violations
+// if the document does not conform to the schema of its version.
+func Bytes(b []byte) error {
+	if err := validateBytes(b); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return nil
+}
+
+// Reader validates notebook JSON read from r. The entire document is read into memory.
+func Reader(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return Bytes(b)
+}
+
+// WithValidation validates notebooks before decoding them.
+func WithValidation() decode.Option {
+	return decode.WithValidator(decode.ValidatorFunc(Bytes))
+}
+
+// Violation describes a value which does not conform to the schema.
+type Violation struct {
+	// Path is a [JSON pointer] to the value, e.g. "/cells/3/outputs/0". An empty path refers to the whole document.
+	//
+	// [JSON pointer]: https://datatracker.ietf.org/doc/html/rfc6901
+	Path string
+
+	// Message describes the violation.
+	Message string
+}
+
+func (v Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + v.Message
+}
+
+// Error is returned for documents which do not conform to the schema.
+type Error struct {
+	// Version is the version of the schema used for validation.
+	Version schema.Version
+
+	// Violations are listed depth-first, visiting object keys in alphabetical order.
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "notebook does not conform to %s schema", e.Version)
+	for i, v := range e.Violations {
+		if i == 0 {
+			sb.WriteString(": ")
+		} else {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(v.String())
+	}
+	return sb.String()
+}
+
+func validateBytes(b []byte) error {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	ver, ok := version(doc)
+	if !ok {
+		// Let the schema report the missing or malformed "nbformat".
+		ver = latest[4]
+	}
+	s, err := schemaFor(ver)
+	if err != nil {
+		return err
+	}
+
+	var v validator
+	v.validate(s, doc, "")
+	if len(v.violations) > 0 {
+		return &Error{Version: ver, Violations: v.violations}
+	}
+	return nil
+}
+
+// version reads the declared nbformat version and selects a schema for it.
+func version(doc interface{}) (schema.Version, bool) {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return schema.Version{}, false
+	}
+	major, ok := obj["nbformat"].(json.Number)
+	if !ok {
+		return schema.Version{}, false
+	}
+	n, err := major.Int64()
+	if err != nil {
+		return schema.Version{}, false
+	}
+
+	ver := schema.Version{Major: int(n)}
+	if minor, ok := obj["nbformat_minor"].(json.Number); ok {
+		if n, err := minor.Int64(); err == nil {
+			ver.Minor = int(n)
+		}
+	}
+	if last, ok := latest[ver.Major]; ok && ver.Minor > last.Minor {
+		ver = last
+	}
+	return ver, true
+}
+
+// latest is the latest schema version available for each major version.
+var latest = map[int]schema.Version{
+	3: {Major: 3, Minor: 0},
+	4: {Major: 4, Minor: 5},
+}
+
+var (
+	mu      sync.Mutex
+	schemas = make(map[schema.Version]*node)
+)
+
+// schemaFor loads and compiles the embedded schema for the version.
+func schemaFor(v schema.Version) (*node, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if s, ok := schemas[v]; ok {
+		return s, nil
+	}
+
+	data, err := schemaFS.ReadFile(fmt.Sprintf("schema/nbformat.v%d.%d.schema.json", v.Major, v.Minor))
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", v, decode.ErrUnsupportedVersion)
+	}
+	s, err := compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", v, err)
+	}
+	schemas[v] = s
+	return s, nil
+}
@@ -0,0 +1,160 @@
+package validate_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bevzzz/nb/decode"
+	"github.com/bevzzz/nb/schema"
+	_ "github.com/bevzzz/nb/schema/v4"
+	"github.com/bevzzz/nb/validate"
+)
+
+func TestBytes(t *testing.T) {
+	// v45 creates a v4.5 notebook with the cells.
+	v45 := func(cells ...string) string {
+		return `{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [` + strings.Join(cells, ",") + `]}`
+	}
+
+	for _, tt := range []struct {
+		name string
+		json string
+		want []validate.Violation
+	}{
+		{
+			name: "v4.5 notebook",
+			json: v45(
+				`{"id": "a1", "cell_type": "markdown", "metadata": {}, "source": ["# Title"], "attachments": {}}`,
+				`{"id": "a2", "cell_type": "code", "metadata": {"tags": ["x"]}, "source": "", "execution_count": 1, "outputs": [
+					{"output_type": "stream", "name": "stdout", "text": "hi"},
+					{"output_type": "execute_result", "execution_count": 1, "metadata": {}, "data": {"text/plain": ["1"], "application/json": {"a": 1}}}
+				]}`,
+			),
+		},
+		{
+			name: "v3.0 notebook",
+			json: `{"metadata": {}, "nbformat": 3, "nbformat_minor": 0, "worksheets": [{"cells": [
+				{"cell_type": "heading", "level": 1, "source": "Title", "metadata": {}},
+				{"cell_type": "code", "language": "python", "input": "1", "outputs": [{"output_type": "pyout", "prompt_number": 1, "text": "1"}]}
+			]}]}`,
+		},
+		{
+			name: "newer minor version is validated against the latest schema",
+			json: strings.Replace(v45(), `"nbformat_minor": 5`, `"nbformat_minor": 99`, 1),
+		},
+		{
+			name: "missing required keys",
+			json: `{"metadata": {}, "nbformat": 4, "cells": []}`,
+			want: []validate.Violation{
+				{Path: "", Message: `missing required property "nbformat_minor"`},
+			},
+		},
+		{
+			name: "wrong type",
+			json: `{"metadata": {}, "nbformat": 4, "nbformat_minor": "5", "cells": []}`,
+			want: []validate.Violation{
+				{Path: "/nbformat_minor", Message: "expected integer, got string"},
+			},
+		},
+		{
+			name: "v4.5 requires cell ids",
+			json: v45(`{"cell_type": "markdown", "metadata": {}, "source": ""}`),
+			want: []validate.Violation{
+				{Path: "/cells/0", Message: `missing required property "id"`},
+			},
+		},
+		{
+			name: "invalid cell id",
+			json: v45(`{"id": "not/valid", "cell_type": "raw", "metadata": {}, "source": ""}`),
+			want: []validate.Violation{
+				{Path: "/cells/0/id", Message: `does not match pattern "^[a-zA-Z0-9-_]+$"`},
+			},
+		},
+		{
+			name: "cell ids are not allowed before v4.5",
+			json: `{"metadata": {}, "nbformat": 4, "nbformat_minor": 4, "cells": [{"id": "a", "cell_type": "raw", "metadata": {}, "source": ""}]}`,
+			want: []validate.Violation{
+				{Path: "/cells/0", Message: `additional property "id" is not allowed`},
+			},
+		},
+		{
+			name: "violations are reported for the intended output type",
+			json: v45(`{"id": "a", "cell_type": "code", "metadata": {}, "source": "", "execution_count": null, "outputs": [
+				{"output_type": "stream", "name": 1, "text": []},
+				{"output_type": "display_data", "metadata": {}, "data": {"text/plain": 42}}
+			]}`),
+			want: []validate.Violation{
+				{Path: "/cells/0/outputs/0/name", Message: "expected string, got integer"},
+				{Path: "/cells/0/outputs/1/data/text~1plain", Message: "does not match any of the allowed schemas"},
+			},
+		},
+		{
+			name: "unknown cell type",
+			json: v45(`{"id": "a", "cell_type": "exotic", "metadata": {}, "source": ""}`),
+			want: []validate.Violation{
+				{Path: "/cells/0", Message: "does not match any of the allowed schemas"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Bytes([]byte(tt.json))
+
+			if tt.want == nil {
+				require.NoError(t, err)
+				return
+			}
+			var verr *validate.Error
+			require.ErrorAs(t, err, &verr)
+			require.Equal(t, tt.want, verr.Violations)
+		})
+	}
+
+	t.Run("testdata", func(t *testing.T) {
+		b, err := os.ReadFile("../testdata/notebook.ipynb")
+		require.NoError(t, err)
+
+		require.NoError(t, validate.Bytes(b))
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		err := validate.Bytes([]byte(`{"nbformat": 2, "nbformat_minor": 0}`))
+
+		require.ErrorIs(t, err, decode.ErrUnsupportedVersion)
+	})
+
+	t.Run("malformed JSON", func(t *testing.T) {
+		err := validate.Bytes([]byte(`{"nbformat": `))
+
+		require.Error(t, err)
+		require.False(t, errors.As(err, new(*validate.Error)))
+	})
+}
+
+func TestWithValidation(t *testing.T) {
+	invalid := `{"metadata": {}, "nbformat": 4, "nbformat_minor": 5, "cells": [{"cell_type": "markdown", "metadata": {}, "source": ""}]}`
+
+	t.Run("bytes", func(t *testing.T) {
+		_, err := decode.Bytes([]byte(invalid), validate.WithValidation())
+
+		var verr *validate.Error
+		require.ErrorAs(t, err, &verr)
+		require.Equal(t, schema.Version{Major: 4, Minor: 5}, verr.Version)
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		_, err := decode.Reader(strings.NewReader(invalid), validate.WithValidation())
+
+		require.ErrorAs(t, err, new(*validate.Error))
+	})
+
+	t.Run("valid notebook is decoded", func(t *testing.T) {
+		nb, err := decode.Bytes([]byte(strings.Replace(invalid, `{"cell_type"`, `{"id": "a", "cell_type"`, 1)), validate.WithValidation())
+
+		require.NoError(t, err)
+		require.Len(t, nb.Cells(), 1)
+	})
+}